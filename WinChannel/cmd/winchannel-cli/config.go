@@ -0,0 +1,46 @@
+package main
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+)
+
+// config is persisted between invocations so scripts only log in once. When
+// Token is set it takes precedence over Session.
+type config struct {
+    Server   string `json:"server"`
+    Username string `json:"username,omitempty"`
+    Password string `json:"password,omitempty"`
+    Session  string `json:"session,omitempty"`
+    Token    string `json:"token,omitempty"`
+    ClientID string `json:"client_id,omitempty"`
+    CACert   string `json:"ca_cert,omitempty"`
+}
+
+func defaultConfigPath() string {
+    if p := os.Getenv("WINCHANNEL_CONFIG"); p != "" { return p }
+    dir, err := os.UserConfigDir()
+    if err != nil { dir = "." }
+    return filepath.Join(dir, "winchannel", "cli.json")
+}
+
+func loadConfig(path string) (*config, error) {
+    cfg := &config{Server: "http://localhost:8000"}
+    b, err := os.ReadFile(path)
+    if os.IsNotExist(err) { return cfg, nil }
+    if err != nil { return nil, err }
+    if err := json.Unmarshal(b, cfg); err != nil { return nil, err }
+    return cfg, nil
+}
+
+// save writes the config with owner-only permissions since it holds the
+// session token and, if requested, the password.
+func (c *config) save(path string) error {
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil { return err }
+    b, err := json.MarshalIndent(c, "", "  ")
+    if err != nil { return err }
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, b, 0600); err != nil { return err }
+    return os.Rename(tmp, path)
+}
\ No newline at end of file
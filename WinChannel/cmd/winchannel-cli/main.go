@@ -0,0 +1,342 @@
+// Command winchannel-cli drives a WinChannel server from terminals and CI:
+// login, folder/ZIP upload, directory sync, listing, download and shared text.
+package main
+
+import (
+    "bufio"
+    "context"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+    "time"
+    "winchannel/internal/client"
+)
+
+const usage = `usage: winchannel-cli [-config FILE] [-server URL] [-cacert FILE] <command> [args]
+
+commands:
+  login [-u USER] [-p PASS] [-otp CODE] [-save-password]
+                                               log in and store the session
+  login -token TOKEN                           store a personal access token instead
+  logout                                       end the session
+  whoami                                       show the current user
+  discover [-t SECONDS] [-service TYPE]        find servers on the LAN via mDNS
+  upload [-id ID] [-mode MODE] [-batch-mb N] DIR
+                                               upload a folder, keeping structure
+  upload-zip [-id ID] [-mode MODE] FILE.zip    upload a ZIP for server-side extraction
+  sync [-id ID] [-delete] [-batch-mb N] DIR    mirror DIR into an upload
+  list                                         list uploads
+  download [-o FILE] ID                        download an upload as ZIP ("-o -" for stdout)
+  text get                                     print the shared text
+  text set [TEXT...]                           replace the shared text (stdin when no TEXT or "-")
+
+MODE is one of overwrite, append, keep_both, skip_identical.
+The password may also be given via WINCHANNEL_PASSWORD and a token via
+-token or WINCHANNEL_TOKEN.
+`
+
+func main() {
+    global := flag.NewFlagSet("winchannel-cli", flag.ExitOnError)
+    global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+    cfgPath := global.String("config", defaultConfigPath(), "config file")
+    server := global.String("server", "", "server base URL, e.g. http://192.168.1.10:8000")
+    token := global.String("token", os.Getenv("WINCHANNEL_TOKEN"), "personal access token (overrides the stored session)")
+    caCert := global.String("cacert", os.Getenv("WINCHANNEL_CACERT"), "PEM file of a CA to trust, e.g. the server's /api/tls/ca.crt")
+    global.Parse(os.Args[1:])
+    args := global.Args()
+    if len(args) == 0 { global.Usage(); os.Exit(2) }
+
+    cfg, err := loadConfig(*cfgPath)
+    if err != nil { fatalf("load config: %v", err) }
+    if *server != "" { cfg.Server = *server }
+    if *token != "" { cfg.Token = *token }
+    if *caCert != "" { cfg.CACert = *caCert }
+    auth := cfg.Session
+    if cfg.Token != "" { auth = cfg.Token }
+    app := &cli{cfg: cfg, cfgPath: *cfgPath, c: client.New(cfg.Server, auth)}
+    if host, err := os.Hostname(); err == nil { app.c.Device = "winchannel-cli on " + host }
+    if cfg.CACert != "" {
+        pem, err := os.ReadFile(cfg.CACert)
+        if err != nil { fatalf("read CA: %v", err) }
+        if err := app.c.TrustCA(pem); err != nil { fatalf("%s: %v", cfg.CACert, err) }
+    }
+
+    cmd, rest := args[0], args[1:]
+    switch cmd {
+    case "login":
+        err = app.login(rest)
+    case "logout":
+        err = app.logout()
+    case "whoami":
+        err = app.whoami()
+    case "upload":
+        err = app.upload(rest)
+    case "upload-zip":
+        err = app.uploadZip(rest)
+    case "sync":
+        err = app.sync(rest)
+    case "list":
+        err = app.list()
+    case "download":
+        err = app.download(rest)
+    case "text":
+        err = app.text(rest)
+    case "discover":
+        err = discover(rest)
+    default:
+        global.Usage(); os.Exit(2)
+    }
+    if errors.Is(err, client.ErrUnauthorized) { fatalf("not logged in or session expired; run: winchannel-cli login") }
+    if err != nil { fatalf("%s: %v", cmd, err) }
+}
+
+func fatalf(format string, a ...interface{}) {
+    fmt.Fprintf(os.Stderr, "winchannel-cli: "+format+"\n", a...)
+    os.Exit(1)
+}
+
+type cli struct {
+    cfg     *config
+    cfgPath string
+    c       *client.Client
+}
+
+// authed runs fn and, if the session has expired and a password was saved,
+// logs in again once and retries.
+func (a *cli) authed(fn func() error) error {
+    err := fn()
+    if !errors.Is(err, client.ErrUnauthorized) || a.cfg.Token != "" || a.cfg.Username == "" || a.cfg.Password == "" { return err }
+    if lerr := a.c.Login(a.cfg.Username, a.cfg.Password); lerr != nil { return err }
+    a.cfg.Session = a.c.Token
+    if serr := a.cfg.save(a.cfgPath); serr != nil { return serr }
+    return fn()
+}
+
+func (a *cli) login(args []string) error {
+    fs := flag.NewFlagSet("login", flag.ExitOnError)
+    user := fs.String("u", a.cfg.Username, "username")
+    pass := fs.String("p", os.Getenv("WINCHANNEL_PASSWORD"), "password")
+    savePass := fs.Bool("save-password", false, "store the password to renew expired sessions")
+    tok := fs.String("token", "", "store a personal access token instead of logging in")
+    otp := fs.String("otp", "", "two-factor code, prompted for when needed")
+    fs.Parse(args)
+    if *tok != "" {
+        a.c.Token = *tok
+        me, err := a.c.Me()
+        if err != nil { return err }
+        if !me.Authenticated { return errors.New("token rejected by server") }
+        a.cfg.Token = *tok
+        a.cfg.Username = me.Username
+        a.cfg.Session = ""
+        a.cfg.Password = ""
+        if err := a.cfg.save(a.cfgPath); err != nil { return err }
+        fmt.Printf("token for %s stored for %s\n", me.Username, a.cfg.Server)
+        return nil
+    }
+    if *user == "" { return errors.New("username required (-u)") }
+    stdin := bufio.NewReader(os.Stdin)
+    if *pass == "" {
+        p, err := prompt(stdin, "Password: ")
+        if err != nil { return err }
+        *pass = p
+    }
+    err := a.c.Login(*user, *pass)
+    if errors.Is(err, client.ErrTwoFactorRequired) {
+        if *otp == "" {
+            if *otp, err = prompt(stdin, "Two-factor code: "); err != nil { return err }
+        }
+        err = a.c.VerifyTwoFactor(*otp)
+    }
+    if err != nil { return err }
+    a.cfg.Token = ""
+    a.cfg.Username = *user
+    a.cfg.Session = a.c.Token
+    a.cfg.Password = ""
+    if *savePass { a.cfg.Password = *pass }
+    if err := a.cfg.save(a.cfgPath); err != nil { return err }
+    fmt.Printf("logged in to %s as %s\n", a.cfg.Server, *user)
+    return nil
+}
+
+func prompt(in *bufio.Reader, label string) (string, error) {
+    fmt.Fprint(os.Stderr, label)
+    line, err := in.ReadString('\n')
+    if err != nil && line == "" { return "", err }
+    return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (a *cli) logout() error {
+    var err error
+    if a.cfg.Token == "" { err = a.c.Logout() }
+    a.cfg.Token = ""
+    a.cfg.Session = ""
+    a.cfg.Password = ""
+    if serr := a.cfg.save(a.cfgPath); serr != nil { return serr }
+    return err
+}
+
+func (a *cli) whoami() error {
+    return a.authed(func() error {
+        me, err := a.c.Me()
+        if err != nil { return err }
+        if !me.Authenticated { return client.ErrUnauthorized }
+        fmt.Printf("%s (%s) @ %s\n", me.Username, me.Role, a.cfg.Server)
+        return nil
+    })
+}
+
+func (a *cli) upload(args []string) error {
+    fs := flag.NewFlagSet("upload", flag.ExitOnError)
+    id := fs.String("id", "", "upload id (default: folder name + timestamp)")
+    mode := fs.String("mode", "", "merge mode for an existing upload")
+    batchMB := fs.Int64("batch-mb", 256, "maximum megabytes per request")
+    fs.Parse(args)
+    if fs.NArg() != 1 { return errors.New("expected one directory") }
+    dir := fs.Arg(0)
+    if *id == "" { *id = client.DefaultUploadID(dir) }
+    files, err := client.WalkDir(dir)
+    if err != nil { return err }
+    var saved, skipped, rejected int
+    var size int64
+    for _, batch := range client.Batch(files, *batchMB*1024*1024) {
+        var res client.UploadResult
+        err := a.authed(func() (err error) { res, err = a.c.UploadFiles(*id, *mode, dir, batch); return })
+        if err != nil { return err }
+        saved += res.SavedFiles; skipped += res.SkippedFiles; rejected += res.RejectedFiles; size += res.SizeBytes
+        printRejected(res)
+    }
+    fmt.Printf("%s: saved %d, skipped %d, rejected %d, %d bytes\n", *id, saved, skipped, rejected, size)
+    return nil
+}
+
+func printRejected(res client.UploadResult) {
+    for _, f := range res.Files {
+        if f.Error != "" { fmt.Fprintf(os.Stderr, "  %s: %s (%s)\n", f.Name, f.Status, f.Error) }
+    }
+}
+
+func (a *cli) uploadZip(args []string) error {
+    fs := flag.NewFlagSet("upload-zip", flag.ExitOnError)
+    id := fs.String("id", "", "upload id (default: server generated)")
+    mode := fs.String("mode", "", "merge mode for an existing upload")
+    fs.Parse(args)
+    if fs.NArg() != 1 { return errors.New("expected one zip file") }
+    var res client.UploadResult
+    err := a.authed(func() (err error) { res, err = a.c.UploadZip(*id, *mode, fs.Arg(0)); return })
+    if err != nil { return err }
+    printRejected(res)
+    fmt.Printf("%s: saved %d, skipped %d, rejected %d, %d bytes\n", res.UploadID, res.SavedFiles, res.SkippedFiles, res.RejectedFiles, res.SizeBytes)
+    return nil
+}
+
+func (a *cli) sync(args []string) error {
+    fs := flag.NewFlagSet("sync", flag.ExitOnError)
+    id := fs.String("id", "", "upload id (default: folder name)")
+    del := fs.Bool("delete", false, "delete files on the server that are not in DIR")
+    batchMB := fs.Int64("batch-mb", 256, "maximum megabytes per request")
+    fs.Parse(args)
+    if fs.NArg() != 1 { return errors.New("expected one directory") }
+    dir := fs.Arg(0)
+    if *id == "" { *id = client.FolderName(dir) }
+    manifest, err := client.BuildManifest(dir)
+    if err != nil { return err }
+    return a.authed(func() error {
+        diff, err := a.c.SyncDiff(*id, manifest)
+        if err != nil { return err }
+        sizes := map[string]int64{}
+        for _, e := range manifest { sizes[e.Path] = e.Size }
+        var todo []client.LocalFile
+        for _, p := range append(diff.Missing, diff.Changed...) { todo = append(todo, client.LocalFile{Rel: p, Size: sizes[p]}) }
+        for _, batch := range client.Batch(todo, *batchMB*1024*1024) {
+            res, err := a.c.UploadFiles(*id, "overwrite", dir, batch)
+            if err != nil { return err }
+            printRejected(res)
+        }
+        res, err := a.c.SyncCommit(*id, manifest, *del)
+        if err != nil { return err }
+        fmt.Printf("%s: uploaded %d (missing %d, changed %d), unchanged %d, deleted %d, extra %d\n",
+            *id, len(todo), len(diff.Missing), len(diff.Changed), diff.Unchanged, len(res.Deleted), len(res.Diff.Extra))
+        if !res.InSync { return fmt.Errorf("not in sync after upload: missing %v changed %v", res.Diff.Missing, res.Diff.Changed) }
+        return nil
+    })
+}
+
+// discover needs no server or login, so it is not a cli method.
+func discover(args []string) error {
+    fs := flag.NewFlagSet("discover", flag.ExitOnError)
+    secs := fs.Int("t", 3, "seconds to wait for answers")
+    service := fs.String("service", "", "DNS-SD service type (default _winchannel._tcp)")
+    fs.Parse(args)
+    ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*secs)*time.Second)
+    defer cancel()
+    servers, err := client.Discover(ctx, *service)
+    if err != nil { return err }
+    if len(servers) == 0 { return errors.New("no servers found") }
+    for _, s := range servers { fmt.Printf("%s\t%s\t%s\n", s.URL, s.Instance, strings.Join(s.Addrs, ",")) }
+    return nil
+}
+
+func (a *cli) list() error {
+    return a.authed(func() error {
+        ups, err := a.c.ListUploads()
+        if err != nil { return err }
+        for _, u := range ups { fmt.Printf("%s\t%d files\t%d bytes\t%s\n", u.ID, u.FileCount, u.SizeBytes, u.CreatedAt) }
+        return nil
+    })
+}
+
+func (a *cli) download(args []string) error {
+    fs := flag.NewFlagSet("download", flag.ExitOnError)
+    out := fs.String("o", "", "output file (default ID.zip, - for stdout)")
+    fs.Parse(args)
+    if fs.NArg() != 1 { return errors.New("expected one upload id") }
+    id := fs.Arg(0)
+    if *out == "" { *out = id + ".zip" }
+    return a.authed(func() error {
+        if *out == "-" { return a.c.Download(id, os.Stdout) }
+        tmp := *out + ".part"
+        f, err := os.Create(tmp)
+        if err != nil { return err }
+        err = a.c.Download(id, f)
+        if cerr := f.Close(); err == nil { err = cerr }
+        if err != nil { os.Remove(tmp); return err }
+        return os.Rename(tmp, *out)
+    })
+}
+
+func (a *cli) text(args []string) error {
+    if len(args) == 0 { return errors.New("expected get or set") }
+    switch args[0] {
+    case "get":
+        return a.authed(func() error {
+            s, err := a.c.TextState()
+            if err != nil { return err }
+            fmt.Print(s.Content)
+            return nil
+        })
+    case "set":
+        var content string
+        if len(args) == 1 || (len(args) == 2 && args[1] == "-") {
+            b, err := io.ReadAll(os.Stdin)
+            if err != nil { return err }
+            content = string(b)
+        } else {
+            content = strings.Join(args[1:], " ")
+        }
+        if a.cfg.ClientID == "" {
+            host, _ := os.Hostname()
+            a.cfg.ClientID = "cli-" + host
+            _ = a.cfg.save(a.cfgPath)
+        }
+        return a.authed(func() error {
+            v, err := a.c.TextUpdate(content, a.cfg.ClientID)
+            if err != nil { return err }
+            fmt.Fprintf(os.Stderr, "version %d\n", v)
+            return nil
+        })
+    }
+    return fmt.Errorf("unknown text command %q", args[0])
+}
\ No newline at end of file
@@ -0,0 +1,31 @@
+// Package assets holds the file systems the HTML pages and static files are
+// served from: the copies embedded in the binary, or directories on disk
+// when overridden in the configuration.
+package assets
+
+import (
+    "io/fs"
+    "os"
+)
+
+var (
+    Templates fs.FS
+    Static    fs.FS
+)
+
+// Init selects the asset sources. embedded must contain templates/ and
+// static/; a non-empty dir replaces the corresponding embedded tree.
+func Init(embedded fs.FS, templatesDir, staticDir string) error {
+    var err error
+    if templatesDir != "" {
+        Templates = os.DirFS(templatesDir)
+    } else if Templates, err = fs.Sub(embedded, "templates"); err != nil {
+        return err
+    }
+    if staticDir != "" {
+        Static = os.DirFS(staticDir)
+    } else if Static, err = fs.Sub(embedded, "static"); err != nil {
+        return err
+    }
+    return nil
+}
\ No newline at end of file
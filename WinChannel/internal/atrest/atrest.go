@@ -0,0 +1,230 @@
+// Package atrest encrypts stored files with AES-256-GCM. Every file gets its
+// own random data key, sealed under the master key in a fixed-size header, so
+// rotating the master key rewrites headers only. Files without the header are
+// read as plaintext, which lets encryption be switched on for an existing data
+// directory.
+//
+// Layout: magic | key id | wrap nonce | sealed data key | nonce prefix,
+// followed by chunks of up to ChunkSize plaintext bytes, each sealed with the
+// data key under nonce prefix||counter. The last chunk is flagged in its
+// additional data so a truncated file fails to open instead of reading short.
+package atrest
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "sync/atomic"
+)
+
+const (
+    KeySize   = 32
+    ChunkSize = 64 << 10
+
+    idSize     = 8
+    nonceSize  = 12
+    tagSize    = 16
+    prefixSize = 8
+    wrapOff    = len(magic) + idSize
+    prefixOff  = wrapOff + nonceSize + KeySize + tagSize
+
+    // HeaderSize is the fixed length of the header in front of every
+    // encrypted file.
+    HeaderSize = prefixOff + prefixSize
+)
+
+const magic = "WCENC\x00\x01\x00"
+
+var (
+    ErrNoKey   = errors.New("atrest: file is encrypted with a key that is not loaded")
+    ErrCorrupt = errors.New("atrest: encrypted file is corrupt or truncated")
+)
+
+type masterKey struct {
+    id   [idSize]byte
+    aead cipher.AEAD
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    b, err := aes.NewCipher(key)
+    if err != nil { return nil, err }
+    return cipher.NewGCM(b)
+}
+
+func newMasterKey(raw []byte) (*masterKey, error) {
+    if len(raw) != KeySize { return nil, fmt.Errorf("atrest: master key must be %d bytes, got %d", KeySize, len(raw)) }
+    aead, err := newGCM(raw)
+    if err != nil { return nil, err }
+    k := &masterKey{aead: aead}
+    sum := sha256.Sum256(append([]byte("winchannel atrest key id\x00"), raw...))
+    copy(k.id[:], sum[:])
+    return k, nil
+}
+
+// Keyring holds the master key that seals new files and older keys that can
+// still open existing ones.
+type Keyring struct {
+    primary *masterKey
+    byID    map[[idSize]byte]*masterKey
+}
+
+// NewKeyring builds a keyring sealing with primary and opening with primary
+// or any of previous.
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+    k := &Keyring{byID: map[[idSize]byte]*masterKey{}}
+    for i, raw := range append([][]byte{primary}, previous...) {
+        mk, err := newMasterKey(raw)
+        if err != nil { return nil, err }
+        if i == 0 { k.primary = mk }
+        if _, dup := k.byID[mk.id]; !dup { k.byID[mk.id] = mk }
+    }
+    return k, nil
+}
+
+// ID identifies the primary key without revealing it.
+func (k *Keyring) ID() string { return hex.EncodeToString(k.primary.id[:]) }
+
+// GenerateKey returns a new random master key.
+func GenerateKey() []byte {
+    b := make([]byte, KeySize)
+    if _, err := rand.Read(b); err != nil { panic(err) }
+    return b
+}
+
+// ParseKey decodes a base64 master key.
+func ParseKey(s string) ([]byte, error) {
+    b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+    if err != nil { return nil, errors.New("atrest: master key is not valid base64") }
+    if len(b) != KeySize { return nil, fmt.Errorf("atrest: master key must be %d bytes, got %d", KeySize, len(b)) }
+    return b, nil
+}
+
+// ReadKeyFile loads a base64 master key from path.
+func ReadKeyFile(path string) ([]byte, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    k, err := ParseKey(string(b))
+    if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    return k, nil
+}
+
+// WriteKeyFile stores key base64 encoded in a new file readable only by the
+// owner. It refuses to overwrite an existing key.
+func WriteKeyFile(path string, key []byte) error {
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+    if err != nil { return err }
+    _, err = f.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+    if cerr := f.Close(); err == nil { err = cerr }
+    return err
+}
+
+var active atomic.Pointer[Keyring]
+
+// Enable seals files written from now on with k. nil turns encryption off;
+// encrypted files then no longer open.
+func Enable(k *Keyring) { active.Store(k) }
+
+// Enabled reports whether new files are encrypted.
+func Enabled() bool { return active.Load() != nil }
+
+// IsHeader reports whether b starts with an encrypted file header.
+func IsHeader(b []byte) bool { return len(b) >= HeaderSize && string(b[:len(magic)]) == magic }
+
+// header seals dek under the primary key. The key id and nonce prefix are
+// authenticated with it, so neither can be swapped between files.
+func (k *Keyring) header(dek []byte, prefix []byte) ([]byte, error) {
+    hdr := make([]byte, HeaderSize)
+    copy(hdr, magic)
+    copy(hdr[len(magic):], k.primary.id[:])
+    copy(hdr[prefixOff:], prefix)
+    nonce := hdr[wrapOff : wrapOff+nonceSize]
+    if _, err := rand.Read(nonce); err != nil { return nil, err }
+    k.primary.aead.Seal(hdr[wrapOff+nonceSize:wrapOff+nonceSize], nonce, dek, wrapAAD(hdr))
+    return hdr, nil
+}
+
+// openHeader returns the data key sealed in hdr.
+func (k *Keyring) openHeader(hdr []byte) ([]byte, error) {
+    if !IsHeader(hdr) { return nil, ErrCorrupt }
+    var id [idSize]byte
+    copy(id[:], hdr[len(magic):])
+    mk := k.byID[id]
+    if mk == nil { return nil, ErrNoKey }
+    dek, err := mk.aead.Open(nil, hdr[wrapOff:wrapOff+nonceSize], hdr[wrapOff+nonceSize:prefixOff], wrapAAD(hdr))
+    if err != nil { return nil, ErrCorrupt }
+    return dek, nil
+}
+
+func wrapAAD(hdr []byte) []byte {
+    return append(append([]byte(nil), hdr[:wrapOff]...), hdr[prefixOff:HeaderSize]...)
+}
+
+// chunkNonce is the nonce prefix followed by the big-endian chunk counter.
+func chunkNonce(dst []byte, prefix []byte, n uint32) []byte {
+    dst = append(dst[:0], prefix...)
+    return binary.BigEndian.AppendUint32(dst, n)
+}
+
+func chunkAAD(final bool) []byte {
+    if final { return []byte{1} }
+    return []byte{0}
+}
+
+// PlainSize returns the plaintext length of an encrypted file of size bytes.
+func PlainSize(size int64) int64 {
+    body := size - int64(HeaderSize)
+    if body <= 0 { return 0 }
+    chunks := (body + ChunkSize + tagSize - 1) / (ChunkSize + tagSize)
+    return body - chunks*tagSize
+}
+
+// Seal encrypts data as a whole file with the active key. It returns data
+// unchanged when encryption is off.
+func Seal(data []byte) ([]byte, error) {
+    k := active.Load()
+    if k == nil { return data, nil }
+    var buf bytes.Buffer
+    w, err := k.NewWriter(&buf)
+    if err != nil { return nil, err }
+    w.Write(data)
+    if err := w.Close(); err != nil { return nil, err }
+    return buf.Bytes(), nil
+}
+
+// Unseal reverses Seal. Data without a header is returned as is.
+func Unseal(data []byte) ([]byte, error) {
+    if !IsHeader(data) { return data, nil }
+    k := active.Load()
+    if k == nil { return nil, ErrNoKey }
+    r, err := k.newReader(data[:HeaderSize], bytes.NewReader(data[HeaderSize:]))
+    if err != nil { return nil, err }
+    out := make([]byte, 0, PlainSize(int64(len(data))))
+    buf := bytes.NewBuffer(out)
+    if _, err := buf.ReadFrom(r); err != nil { return nil, err }
+    return buf.Bytes(), nil
+}
+
+// ReadFile is os.ReadFile with transparent decryption.
+func ReadFile(path string) ([]byte, error) {
+    b, err := os.ReadFile(path)
+    if err != nil { return nil, err }
+    b, err = Unseal(b)
+    if err != nil { return nil, fmt.Errorf("%s: %w", path, err) }
+    return b, nil
+}
+
+// WriteFile is os.WriteFile encrypting with the active key, if any.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+    b, err := Seal(data)
+    if err != nil { return err }
+    return os.WriteFile(path, b, perm)
+}
\ No newline at end of file
@@ -0,0 +1,267 @@
+package atrest
+
+import (
+    "bufio"
+    "crypto/cipher"
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+var errClosed = errors.New("atrest: write after close")
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// NewWriter returns a writer that encrypts into w with the active key, or
+// passes data through when encryption is off. Close must be called to
+// finish the file; it does not close w.
+func NewWriter(w io.Writer) (io.WriteCloser, error) {
+    k := active.Load()
+    if k == nil { return nopCloser{w}, nil }
+    return k.NewWriter(w)
+}
+
+// NewWriter writes a header for a fresh data key to w and returns a writer
+// that encrypts into it.
+func (k *Keyring) NewWriter(w io.Writer) (io.WriteCloser, error) {
+    dek := make([]byte, KeySize+prefixSize)
+    if _, err := rand.Read(dek); err != nil { return nil, err }
+    hdr, err := k.header(dek[:KeySize], dek[KeySize:])
+    if err != nil { return nil, err }
+    aead, err := newGCM(dek[:KeySize])
+    if err != nil { return nil, err }
+    if _, err := w.Write(hdr); err != nil { return nil, err }
+    return &writer{w: w, aead: aead, prefix: hdr[prefixOff:], buf: make([]byte, 0, ChunkSize)}, nil
+}
+
+type writer struct {
+    w      io.Writer
+    aead   cipher.AEAD
+    prefix []byte
+    n      uint32
+    buf    []byte
+    out    []byte
+    nonce  []byte
+    err    error
+}
+
+// Write buffers a full chunk before sealing it, so the last chunk is only
+// known at Close.
+func (e *writer) Write(p []byte) (int, error) {
+    if e.err != nil { return 0, e.err }
+    n := 0
+    for len(p) > 0 {
+        if len(e.buf) == ChunkSize {
+            if err := e.seal(false); err != nil { return n, err }
+        }
+        c := copy(e.buf[len(e.buf):ChunkSize], p)
+        e.buf = e.buf[:len(e.buf)+c]
+        p = p[c:]
+        n += c
+    }
+    return n, nil
+}
+
+func (e *writer) seal(final bool) error {
+    e.nonce = chunkNonce(e.nonce, e.prefix, e.n)
+    e.out = e.aead.Seal(e.out[:0], e.nonce, e.buf, chunkAAD(final))
+    e.n++
+    e.buf = e.buf[:0]
+    if _, err := e.w.Write(e.out); err != nil { e.err = err }
+    return e.err
+}
+
+func (e *writer) Close() error {
+    if e.err != nil { return e.err }
+    err := e.seal(true)
+    if err == nil { e.err = errClosed }
+    return err
+}
+
+type reader struct {
+    r      *bufio.Reader
+    aead   cipher.AEAD
+    prefix []byte
+    n      uint32
+    buf    []byte
+    plain  []byte
+    nonce  []byte
+    done   bool
+}
+
+// newReader decrypts the body that follows hdr in r.
+func (k *Keyring) newReader(hdr []byte, r io.Reader) (*reader, error) {
+    dek, err := k.openHeader(hdr)
+    if err != nil { return nil, err }
+    aead, err := newGCM(dek)
+    if err != nil { return nil, err }
+    prefix := append([]byte(nil), hdr[prefixOff:HeaderSize]...)
+    return &reader{r: bufio.NewReader(r), aead: aead, prefix: prefix, buf: make([]byte, ChunkSize+tagSize)}, nil
+}
+
+func (d *reader) Read(p []byte) (int, error) {
+    for len(d.plain) == 0 {
+        if d.done { return 0, io.EOF }
+        if err := d.next(); err != nil { return 0, err }
+    }
+    n := copy(p, d.plain)
+    d.plain = d.plain[n:]
+    return n, nil
+}
+
+// next opens one chunk. A short chunk, or a full one with nothing after it,
+// must carry the final flag.
+func (d *reader) next() error {
+    n, err := io.ReadFull(d.r, d.buf)
+    final := false
+    switch {
+    case err == io.EOF || err == io.ErrUnexpectedEOF:
+        final = true
+    case err != nil:
+        return err
+    default:
+        if _, err := d.r.Peek(1); err == io.EOF { final = true } else if err != nil { return err }
+    }
+    d.nonce = chunkNonce(d.nonce, d.prefix, d.n)
+    plain, err := d.aead.Open(d.buf[:0], d.nonce, d.buf[:n], chunkAAD(final))
+    if err != nil { return ErrCorrupt }
+    d.n++
+    d.plain, d.done = plain, final
+    return nil
+}
+
+// File is a plaintext view of a stored file, encrypted or not.
+type File struct {
+    io.Reader
+    f         *os.File
+    size      int64
+    Encrypted bool
+}
+
+// Size is the plaintext length.
+func (f *File) Size() int64 { return f.size }
+
+// Stat describes the file on disk.
+func (f *File) Stat() (os.FileInfo, error) { return f.f.Stat() }
+
+func (f *File) Close() error { return f.f.Close() }
+
+// Open opens path for reading, decrypting it when it carries a header.
+func Open(path string) (*File, error) {
+    f, err := os.Open(path)
+    if err != nil { return nil, err }
+    fi, err := f.Stat()
+    if err != nil { f.Close(); return nil, err }
+    hdr := make([]byte, HeaderSize)
+    if _, err := io.ReadFull(f, hdr); err != nil || !IsHeader(hdr) {
+        if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF { f.Close(); return nil, err }
+        if _, err := f.Seek(0, io.SeekStart); err != nil { f.Close(); return nil, err }
+        return &File{Reader: f, f: f, size: fi.Size()}, nil
+    }
+    k := active.Load()
+    if k == nil { f.Close(); return nil, fmt.Errorf("%s: %w", path, ErrNoKey) }
+    r, err := k.newReader(hdr, f)
+    if err != nil { f.Close(); return nil, fmt.Errorf("%s: %w", path, err) }
+    return &File{Reader: r, f: f, size: PlainSize(fi.Size()), Encrypted: true}, nil
+}
+
+// IsEncrypted reports whether the file at path starts with a header.
+func IsEncrypted(path string) bool {
+    f, err := os.Open(path)
+    if err != nil { return false }
+    defer f.Close()
+    hdr := make([]byte, HeaderSize)
+    _, err = io.ReadFull(f, hdr)
+    return err == nil && IsHeader(hdr)
+}
+
+type plainInfo struct {
+    os.FileInfo
+    size int64
+}
+
+func (p plainInfo) Size() int64 { return p.size }
+
+// PlainInfo returns fi, reporting the plaintext size if the file at path is
+// encrypted.
+func PlainInfo(path string, fi os.FileInfo) os.FileInfo {
+    if !fi.Mode().IsRegular() || fi.Size() < int64(HeaderSize) || !IsEncrypted(path) { return fi }
+    return plainInfo{fi, PlainSize(fi.Size())}
+}
+
+// FindEncrypted returns the first encrypted file under root, or "" if there
+// is none.
+func FindEncrypted(root string) (string, error) {
+    var found string
+    err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if info.Mode().IsRegular() && info.Size() >= int64(HeaderSize) && IsEncrypted(p) { found = p; return filepath.SkipAll }
+        return nil
+    })
+    if os.IsNotExist(err) { err = nil }
+    return found, err
+}
+
+// rewrapTemp names the temp copy Rewrap writes next to path; a random
+// suffix follows.
+func rewrapTemp(path string) string { return "." + filepath.Base(path) + ".rewrap-" }
+
+// Rewrap seals the data key of the file at path under the primary key of k,
+// leaving the content as it is. Plaintext files and files already on the
+// primary key are skipped; the result reports whether the file changed. The
+// new file is written beside the old one and renamed over it, so a crash
+// leaves either version intact.
+func (k *Keyring) Rewrap(path string) (bool, error) {
+    f, err := os.Open(path)
+    if err != nil { return false, err }
+    defer f.Close()
+    hdr := make([]byte, HeaderSize)
+    if _, err := io.ReadFull(f, hdr); err != nil || !IsHeader(hdr) { return false, nil }
+    if string(hdr[len(magic):wrapOff]) == string(k.primary.id[:]) { return false, nil }
+    dek, err := k.openHeader(hdr)
+    if err != nil { return false, err }
+    next, err := k.header(dek, hdr[prefixOff:HeaderSize])
+    if err != nil { return false, err }
+    fi, err := f.Stat()
+    if err != nil { return false, err }
+    out, err := os.CreateTemp(filepath.Dir(path), rewrapTemp(path)+"*")
+    if err != nil { return false, err }
+    tmp := out.Name()
+    err = out.Chmod(fi.Mode().Perm())
+    if err == nil { _, err = out.Write(next) }
+    if err == nil { _, err = io.Copy(out, f) }
+    if err == nil { err = out.Sync() }
+    if cerr := out.Close(); err == nil { err = cerr }
+    // Keep the mtime: sync compares it with client manifests.
+    if err == nil { err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime()) }
+    if err == nil { err = os.Rename(tmp, path) }
+    if err != nil { os.Remove(tmp); return false, err }
+    if d, err := os.Open(filepath.Dir(path)); err == nil { d.Sync(); d.Close() }
+    return true, nil
+}
+
+// RewrapTree rewraps every regular file under root. It keeps going past
+// failures and reports them together. Temp copies left by an interrupted
+// run are removed.
+func (k *Keyring) RewrapTree(root string) (int, error) {
+    var changed int
+    var errs []error
+    err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil { errs = append(errs, err); return nil }
+        if !info.Mode().IsRegular() { return nil }
+        if name := info.Name(); strings.HasPrefix(name, ".") && strings.Contains(name, ".rewrap-") { os.Remove(p); return nil }
+        if info.Size() < int64(HeaderSize) { return nil }
+        ok, err := k.Rewrap(p)
+        if err != nil { errs = append(errs, fmt.Errorf("%s: %w", p, err)) }
+        if ok { changed++ }
+        return nil
+    })
+    if err != nil { errs = append(errs, err) }
+    return changed, errors.Join(errs...)
+}
\ No newline at end of file
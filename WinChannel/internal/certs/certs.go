@@ -0,0 +1,237 @@
+// Package certs runs a small private CA for LAN HTTPS: it creates a CA once,
+// issues a server certificate for localhost and every local address, and
+// reissues it before expiry or when the machine's addresses change.
+package certs
+
+import (
+    "crypto"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "log/slog"
+    "math/big"
+    "net"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+    "winchannel/internal/txn"
+)
+
+const (
+    caValidity     = 10 * 365 * 24 * time.Hour
+    serverValidity = 397 * 24 * time.Hour // longest lifetime Apple devices accept
+    renewBefore    = 30 * 24 * time.Hour
+    checkInterval  = 12 * time.Hour
+)
+
+// Manager owns the CA and the current server certificate in dir.
+type Manager struct {
+    dir   string
+    hosts func() []string
+    store txn.Store // writes a certificate and its key together
+    mu    sync.Mutex // serialises Check
+    ca    atomic.Pointer[authority]
+    leaf  atomic.Pointer[tls.Certificate]
+}
+
+// authority is a CA certificate with its key, swapped as one.
+type authority struct {
+    cert *x509.Certificate
+    key  crypto.Signer
+}
+
+func (m *Manager) CACertFile() string { return filepath.Join(m.dir, "ca.crt") }
+func (m *Manager) caKeyFile() string  { return filepath.Join(m.dir, "ca.key") }
+func (m *Manager) certFile() string   { return filepath.Join(m.dir, "server.crt") }
+func (m *Manager) keyFile() string    { return filepath.Join(m.dir, "server.key") }
+func (m *Manager) walFile() string    { return filepath.Join(m.dir, "wal.json") }
+
+// NewManager loads or creates the CA and a server certificate covering
+// hosts(). hosts is called again on every renewal check.
+func NewManager(dir string, hosts func() []string) (*Manager, error) {
+    if err := os.MkdirAll(dir, 0700); err != nil { return nil, err }
+    m := &Manager{dir: dir, hosts: hosts}
+    if _, err := m.store.Open(m.walFile()); err != nil { return nil, err }
+    if err := m.loadOrCreateCA(); err != nil { return nil, fmt.Errorf("ca: %w", err) }
+    if err := m.Check(); err != nil { return nil, err }
+    return m, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate so renewals apply
+// without restarting the listener.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+    return m.leaf.Load(), nil
+}
+
+// CAFingerprint is the SHA-256 of the CA certificate, for users to compare
+// when installing it on a device.
+func (m *Manager) CAFingerprint() string {
+    sum := sha256.Sum256(m.ca.Load().cert.Raw)
+    return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Run checks the certificate periodically until stop is closed.
+func (m *Manager) Run(stop <-chan struct{}) {
+    t := time.NewTicker(checkInterval)
+    defer t.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-t.C:
+            if err := m.Check(); err != nil { slog.Error("tls certificate renewal failed", "err", err) }
+        }
+    }
+}
+
+// Check makes sure the server certificate is loaded, not close to expiry and
+// valid for every current host, reissuing it otherwise.
+func (m *Manager) Check() error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if time.Until(m.ca.Load().cert.NotAfter) < renewBefore {
+        slog.Warn("local CA is about to expire; creating a new one, devices must install the new ca.crt")
+        if err := m.createCA(); err != nil { return fmt.Errorf("ca: %w", err) }
+        return m.issue()
+    }
+    if m.leaf.Load() == nil {
+        if c, err := tls.LoadX509KeyPair(m.certFile(), m.keyFile()); err == nil {
+            m.leaf.Store(&c)
+        }
+    }
+    c := m.leaf.Load()
+    if c == nil { return m.issue() }
+    leaf, err := x509.ParseCertificate(c.Certificate[0])
+    if err != nil { return m.issue() }
+    if time.Until(leaf.NotAfter) < renewBefore { return m.issue() }
+    if leaf.CheckSignatureFrom(m.ca.Load().cert) != nil { return m.issue() }
+    for _, h := range m.hosts() {
+        if leaf.VerifyHostname(h) != nil { return m.issue() }
+    }
+    return nil
+}
+
+func (m *Manager) loadOrCreateCA() error {
+    cert, key, err := loadPair(m.CACertFile(), m.caKeyFile())
+    if errors.Is(err, os.ErrNotExist) { return m.createCA() }
+    if err != nil { return err }
+    m.ca.Store(&authority{cert: cert, key: key})
+    return nil
+}
+
+func (m *Manager) createCA() error {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil { return err }
+    host, _ := os.Hostname()
+    now := time.Now()
+    tmpl := &x509.Certificate{
+        SerialNumber:          randSerial(),
+        Subject:               pkix.Name{CommonName: "WinChannel Local CA " + host, Organization: []string{"WinChannel"}},
+        NotBefore:             now.Add(-time.Hour),
+        NotAfter:              now.Add(caValidity),
+        KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+        BasicConstraintsValid: true,
+        IsCA:                  true,
+        MaxPathLenZero:        true,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil { return err }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil { return err }
+    if err := m.writePair(m.CACertFile(), m.caKeyFile(), der, key); err != nil { return err }
+    m.ca.Store(&authority{cert: cert, key: key})
+    slog.Info("created local CA", "file", m.CACertFile(), "sha256", m.CAFingerprint())
+    return nil
+}
+
+func (m *Manager) issue() error {
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil { return err }
+    hosts := m.hosts()
+    var dns []string
+    var ips []net.IP
+    for _, h := range hosts {
+        if ip := net.ParseIP(h); ip != nil { ips = append(ips, ip) } else { dns = append(dns, h) }
+    }
+    now := time.Now()
+    tmpl := &x509.Certificate{
+        SerialNumber: randSerial(),
+        Subject:      pkix.Name{CommonName: "WinChannel", Organization: []string{"WinChannel"}},
+        NotBefore:    now.Add(-time.Hour),
+        NotAfter:     now.Add(serverValidity),
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+        DNSNames:     dns,
+        IPAddresses:  ips,
+    }
+    ca := m.ca.Load()
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+    if err != nil { return err }
+    if err := m.writePair(m.certFile(), m.keyFile(), der, key); err != nil { return err }
+    c := &tls.Certificate{Certificate: [][]byte{der, ca.cert.Raw}, PrivateKey: key}
+    m.leaf.Store(c)
+    slog.Info("issued tls certificate", "hosts", hosts, "expires", tmpl.NotAfter.Format(time.RFC3339))
+    return nil
+}
+
+// DefaultHosts lists localhost, the machine name and the given addresses,
+// de-duplicated and sorted so certificate checks are stable.
+func DefaultHosts(addrs []string) []string {
+    set := map[string]bool{"localhost": true, "127.0.0.1": true, "::1": true}
+    if h, err := os.Hostname(); err == nil && h != "" {
+        h = strings.ToLower(strings.TrimSuffix(h, "."))
+        set[h] = true
+        if !strings.Contains(h, ".") { set[h+".local"] = true }
+    }
+    for _, a := range addrs { if a != "" { set[a] = true } }
+    out := make([]string, 0, len(set))
+    for h := range set { out = append(out, h) }
+    sort.Strings(out)
+    return out
+}
+
+func randSerial() *big.Int {
+    n, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+    return n
+}
+
+// writePair replaces a certificate and its key in one commit, so a crash
+// never leaves a key next to a certificate it does not belong to.
+func (m *Manager) writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+    kb, err := x509.MarshalPKCS8PrivateKey(key)
+    if err != nil { return err }
+    return m.store.Update(func(tx *txn.Tx) error {
+        tx.Write(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: kb}), 0600)
+        tx.Write(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+        return nil
+    })
+}
+
+func loadPair(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+    cb, err := os.ReadFile(certPath)
+    if err != nil { return nil, nil, err }
+    kb, err := os.ReadFile(keyPath)
+    if err != nil { return nil, nil, err }
+    cblk, _ := pem.Decode(cb)
+    kblk, _ := pem.Decode(kb)
+    if cblk == nil || kblk == nil { return nil, nil, errors.New("invalid PEM in " + filepath.Dir(certPath)) }
+    cert, err := x509.ParseCertificate(cblk.Bytes)
+    if err != nil { return nil, nil, err }
+    k, err := x509.ParsePKCS8PrivateKey(kblk.Bytes)
+    if err != nil { return nil, nil, err }
+    signer, ok := k.(crypto.Signer)
+    if !ok { return nil, nil, errors.New("unsupported CA key type") }
+    return cert, signer, nil
+}
\ No newline at end of file
@@ -0,0 +1,59 @@
+package certs
+
+import (
+    "crypto/x509"
+    "os"
+    "sync"
+    "testing"
+)
+
+func hosts() []string { return []string{"localhost", "127.0.0.1"} }
+
+func TestManagerReloadsPair(t *testing.T) {
+    dir := t.TempDir()
+    m, err := NewManager(dir, hosts)
+    if err != nil { t.Fatal(err) }
+    for _, f := range []string{m.caKeyFile(), m.keyFile()} {
+        fi, err := os.Stat(f)
+        if err != nil { t.Fatal(err) }
+        if fi.Mode().Perm() != 0600 { t.Fatalf("%s has mode %v", f, fi.Mode().Perm()) }
+    }
+    if _, err := os.Stat(m.walFile()); !os.IsNotExist(err) { t.Fatalf("commit record left behind: %v", err) }
+
+    again, err := NewManager(dir, hosts)
+    if err != nil { t.Fatal(err) }
+    if again.CAFingerprint() != m.CAFingerprint() { t.Fatal("restart created a new CA") }
+    if string(again.leaf.Load().Certificate[0]) != string(m.leaf.Load().Certificate[0]) { t.Fatal("restart reissued a valid server certificate") }
+}
+
+// TestCheckConcurrent renews the CA and the server certificate while other
+// goroutines read the fingerprint and the current certificate.
+func TestCheckConcurrent(t *testing.T) {
+    m, err := NewManager(t.TempDir(), hosts)
+    if err != nil { t.Fatal(err) }
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(2)
+        go func() {
+            defer wg.Done()
+            ca := *m.ca.Load()
+            expired := *ca.cert
+            expired.NotAfter = expired.NotBefore // force a new CA
+            m.ca.CompareAndSwap(m.ca.Load(), &authority{cert: &expired, key: ca.key})
+            if err := m.Check(); err != nil { t.Error(err) }
+        }()
+        go func() {
+            defer wg.Done()
+            if m.CAFingerprint() == "" { t.Error("empty fingerprint") }
+            m.GetCertificate(nil)
+        }()
+    }
+    wg.Wait()
+
+    caCert, _, err := loadPair(m.CACertFile(), m.caKeyFile())
+    if err != nil { t.Fatal(err) }
+    if !caCert.Equal(m.ca.Load().cert) { t.Fatal("CA on disk differs from the one in memory") }
+    leaf, err := x509.ParseCertificate(m.leaf.Load().Certificate[0])
+    if err != nil { t.Fatal(err) }
+    if err := leaf.CheckSignatureFrom(caCert); err != nil { t.Fatalf("server certificate not signed by the current CA: %v", err) }
+}
\ No newline at end of file
@@ -0,0 +1,423 @@
+package client
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+    "winchannel/internal/model"
+)
+
+const (
+    sessionCookie  = "SESSION"
+    csrfCookie     = "CSRF_TOKEN"
+    csrfHeader     = "X-CSRF-Token"
+    apiTokenPrefix = "wct_"
+)
+
+// Client talks to a WinChannel server using the same JSON and multipart
+// contracts as the web UI. Token is either the value of the SESSION cookie or
+// a personal access token (wct_...), which is sent as a bearer token.
+type Client struct {
+    BaseURL string
+    Token   string
+    HTTP    *http.Client
+    Device  string // sent as X-Device-Name so the session shows up under this name
+
+    pending string // 2FA pending login token between Login and VerifyTwoFactor
+    csrf    string // double-submit token, fetched lazily for cookie sessions
+}
+
+type UploadSummary struct {
+    ID        string `json:"id"`
+    FileCount int    `json:"file_count"`
+    SizeBytes int64  `json:"size_bytes"`
+    CreatedAt string `json:"created_at"`
+}
+
+type UploadResult struct {
+    OK            bool                     `json:"ok"`
+    UploadID      string                   `json:"upload_id"`
+    Mode          string                   `json:"mode"`
+    SavedFiles    int                      `json:"saved_files"`
+    SkippedFiles  int                      `json:"skipped_files"`
+    RejectedFiles int                      `json:"rejected_files"`
+    SizeBytes     int64                    `json:"size_bytes"`
+    Files         []model.UploadFileResult `json:"files"`
+}
+
+type TextState struct {
+    Content   string `json:"content"`
+    Version   int64  `json:"version"`
+    UpdatedAt string `json:"updated_at"`
+}
+
+type Me struct {
+    Authenticated bool   `json:"authenticated"`
+    Username      string `json:"username"`
+    Role          string `json:"role"`
+}
+
+var (
+    // ErrUnauthorized is returned when the server rejects the session.
+    ErrUnauthorized = errors.New("unauthorized")
+    // ErrTwoFactorRequired is returned by Login when the account has 2FA; call
+    // VerifyTwoFactor with a code to finish logging in.
+    ErrTwoFactorRequired = errors.New("two-factor code required")
+)
+
+// Error is a non-2xx reply decoded from the server's error envelope.
+type Error struct {
+    Status    int
+    Code      string
+    Message   string
+    RequestID string
+}
+
+func (e *Error) Error() string {
+    msg := fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+    if e.RequestID != "" { msg += " (request " + e.RequestID + ")" }
+    return msg
+}
+
+// Is lets callers use errors.Is(err, ErrUnauthorized) for 401 replies.
+func (e *Error) Is(target error) bool { return target == ErrUnauthorized && e.Status == http.StatusUnauthorized }
+
+// decodeError builds an *Error from resp, falling back to the raw body for
+// replies that do not use the envelope (e.g. from a proxy).
+func decodeError(resp *http.Response) error {
+    b, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+    var env struct {
+        Error struct {
+            Code      string `json:"code"`
+            Message   string `json:"message"`
+            RequestID string `json:"request_id"`
+        } `json:"error"`
+    }
+    e := &Error{Status: resp.StatusCode, Code: "http_error", Message: strings.TrimSpace(string(b))}
+    if json.Unmarshal(b, &env) == nil && env.Error.Code != "" {
+        e.Code, e.Message, e.RequestID = env.Error.Code, env.Error.Message, env.Error.RequestID
+    }
+    return e
+}
+
+func New(baseURL, token string) *Client {
+    return &Client{BaseURL: strings.TrimRight(baseURL, "/"), Token: token, HTTP: &http.Client{}}
+}
+
+// TrustCA adds the PEM certificates in caPEM (e.g. the server's local CA from
+// /api/tls/ca.crt) to the roots used for HTTPS.
+func (c *Client) TrustCA(caPEM []byte) error {
+    pool, err := x509.SystemCertPool()
+    if err != nil || pool == nil { pool = x509.NewCertPool() }
+    if !pool.AppendCertsFromPEM(caPEM) { return errors.New("no certificates found in CA file") }
+    t := http.DefaultTransport.(*http.Transport).Clone()
+    t.TLSClientConfig = &tls.Config{RootCAs: pool}
+    c.HTTP.Transport = t
+    return nil
+}
+
+func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+    req, err := http.NewRequest(method, c.BaseURL+path, body)
+    if err != nil { return nil, err }
+    req.Header.Set("User-Agent", "winchannel-cli")
+    if c.Device != "" { req.Header.Set("X-Device-Name", c.Device) }
+    if strings.HasPrefix(c.Token, apiTokenPrefix) {
+        req.Header.Set("Authorization", "Bearer "+c.Token)
+        return req, nil
+    }
+    if c.Token != "" { req.AddCookie(&http.Cookie{Name: sessionCookie, Value: c.Token}) }
+    if method != http.MethodGet && (c.Token != "" || c.pending != "") {
+        if err := c.ensureCSRF(); err != nil { return nil, err }
+        req.AddCookie(&http.Cookie{Name: csrfCookie, Value: c.csrf})
+        req.Header.Set(csrfHeader, c.csrf)
+    }
+    return req, nil
+}
+
+// ensureCSRF fetches a CSRF token once; the server only checks that the
+// cookie and header match, so it stays valid across requests.
+func (c *Client) ensureCSRF() error {
+    if c.csrf != "" { return nil }
+    resp, err := c.HTTP.Get(c.BaseURL + "/api/csrf")
+    if err != nil { return err }
+    defer resp.Body.Close()
+    var out struct{ Token string `json:"csrf_token"` }
+    if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { return fmt.Errorf("csrf: %v", err) }
+    if out.Token == "" { return errors.New("csrf: server returned no token") }
+    c.csrf = out.Token
+    return nil
+}
+
+func (c *Client) do(req *http.Request, out interface{}) error {
+    resp, err := c.HTTP.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 { return fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, decodeError(resp)) }
+    if out == nil { return nil }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) getJSON(path string, out interface{}) error {
+    req, err := c.newRequest(http.MethodGet, path, nil)
+    if err != nil { return err }
+    return c.do(req, out)
+}
+
+func (c *Client) postJSON(path string, in, out interface{}) error {
+    b, err := json.Marshal(in)
+    if err != nil { return err }
+    req, err := c.newRequest(http.MethodPost, path, bytes.NewReader(b))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    return c.do(req, out)
+}
+
+// Login authenticates and stores the session token on the client.
+func (c *Client) Login(username, password string) error {
+    b, _ := json.Marshal(map[string]string{"username": username, "password": password})
+    req, err := c.newRequest(http.MethodPost, "/api/auth/login", bytes.NewReader(b))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.HTTP.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 { return fmt.Errorf("login failed: %w", decodeError(resp)) }
+    return c.takeSession(resp)
+}
+
+func (c *Client) takeSession(resp *http.Response) error {
+    for _, ck := range resp.Cookies() {
+        if ck.Name == sessionCookie && ck.Value != "" { c.Token = ck.Value; return nil }
+    }
+    var out struct {
+        TwoFactorRequired bool   `json:"two_factor_required"`
+        PendingToken      string `json:"pending_token"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&out); err == nil && out.TwoFactorRequired {
+        c.pending = out.PendingToken
+        return ErrTwoFactorRequired
+    }
+    return errors.New("login succeeded but no session cookie was returned")
+}
+
+// VerifyTwoFactor completes a login that returned ErrTwoFactorRequired using
+// a TOTP or recovery code.
+func (c *Client) VerifyTwoFactor(code string) error {
+    b, _ := json.Marshal(map[string]string{"code": code, "pending_token": c.pending})
+    req, err := c.newRequest(http.MethodPost, "/api/auth/2fa/verify", bytes.NewReader(b))
+    if err != nil { return err }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := c.HTTP.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 { return fmt.Errorf("2fa failed: %w", decodeError(resp)) }
+    c.pending = ""
+    return c.takeSession(resp)
+}
+
+func (c *Client) Logout() error {
+    req, err := c.newRequest(http.MethodPost, "/api/auth/logout", nil)
+    if err != nil { return err }
+    err = c.do(req, nil)
+    c.Token = ""
+    return err
+}
+
+func (c *Client) Me() (Me, error) {
+    var m Me
+    err := c.getJSON("/api/auth/me", &m)
+    return m, err
+}
+
+func (c *Client) ListUploads() ([]UploadSummary, error) {
+    var out struct{ Uploads []UploadSummary `json:"uploads"` }
+    err := c.getJSON("/api/uploads", &out)
+    return out.Uploads, err
+}
+
+// Download streams the ZIP of an upload into w.
+func (c *Client) Download(uploadID string, w io.Writer) error {
+    req, err := c.newRequest(http.MethodGet, "/api/download/"+url.PathEscape(uploadID), nil)
+    if err != nil { return err }
+    resp, err := c.HTTP.Do(req)
+    if err != nil { return err }
+    defer resp.Body.Close()
+    if resp.StatusCode/100 != 2 { return fmt.Errorf("download %s: %w", uploadID, decodeError(resp)) }
+    _, err = io.Copy(w, resp.Body)
+    return err
+}
+
+func (c *Client) TextState() (TextState, error) {
+    var s TextState
+    err := c.getJSON("/api/text/state", &s)
+    return s, err
+}
+
+func (c *Client) TextUpdate(content, clientID string) (int64, error) {
+    var out struct{ Version int64 `json:"version"` }
+    err := c.postJSON("/api/text/update", map[string]string{"content": content, "client_id": clientID}, &out)
+    return out.Version, err
+}
+
+// UploadFiles sends the files at rels (slash separated, relative to root) to
+// /api/upload in a single streamed multipart request.
+func (c *Client) UploadFiles(uploadID, mode, root string, rels []string) (UploadResult, error) {
+    var res UploadResult
+    pr, pw := io.Pipe()
+    mw := multipart.NewWriter(pw)
+    go func() {
+        err := func() error {
+            if err := mw.WriteField("upload_id", uploadID); err != nil { return err }
+            if mode != "" {
+                if err := mw.WriteField("mode", mode); err != nil { return err }
+            }
+            for _, rel := range rels {
+                part, err := mw.CreateFormFile("files", rel)
+                if err != nil { return err }
+                f, err := os.Open(filepath.Join(root, filepath.FromSlash(rel)))
+                if err != nil { return err }
+                _, err = io.Copy(part, f)
+                f.Close()
+                if err != nil { return err }
+            }
+            return mw.Close()
+        }()
+        pw.CloseWithError(err)
+    }()
+    req, err := c.newRequest(http.MethodPost, "/api/upload", pr)
+    if err != nil { pr.Close(); return res, err }
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    err = c.do(req, &res)
+    pr.Close()
+    return res, err
+}
+
+// UploadZip sends a ZIP archive to /api/upload_zip for server-side extraction.
+func (c *Client) UploadZip(uploadID, mode, zipPath string) (UploadResult, error) {
+    var res UploadResult
+    f, err := os.Open(zipPath)
+    if err != nil { return res, err }
+    defer f.Close()
+    pr, pw := io.Pipe()
+    mw := multipart.NewWriter(pw)
+    go func() {
+        err := func() error {
+            if uploadID != "" {
+                if err := mw.WriteField("upload_id", uploadID); err != nil { return err }
+            }
+            if mode != "" {
+                if err := mw.WriteField("mode", mode); err != nil { return err }
+            }
+            part, err := mw.CreateFormFile("zip_file", filepath.Base(zipPath))
+            if err != nil { return err }
+            if _, err := io.Copy(part, f); err != nil { return err }
+            return mw.Close()
+        }()
+        pw.CloseWithError(err)
+    }()
+    req, err := c.newRequest(http.MethodPost, "/api/upload_zip", pr)
+    if err != nil { pr.Close(); return res, err }
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    err = c.do(req, &res)
+    pr.Close()
+    return res, err
+}
+
+func (c *Client) SyncDiff(uploadID string, files []model.SyncEntry) (model.SyncDiff, error) {
+    var out struct{ Diff model.SyncDiff `json:"diff"` }
+    err := c.postJSON("/api/sync/diff", map[string]interface{}{"upload_id": uploadID, "files": files}, &out)
+    return out.Diff, err
+}
+
+type SyncCommitResult struct {
+    InSync  bool           `json:"in_sync"`
+    Deleted []string       `json:"deleted"`
+    Diff    model.SyncDiff `json:"diff"`
+}
+
+func (c *Client) SyncCommit(uploadID string, files []model.SyncEntry, deleteExtra bool) (SyncCommitResult, error) {
+    var out SyncCommitResult
+    err := c.postJSON("/api/sync/commit", map[string]interface{}{"upload_id": uploadID, "files": files, "delete_extra": deleteExtra}, &out)
+    return out, err
+}
+
+// LocalFile is a regular file found by WalkDir.
+type LocalFile struct {
+    Rel  string
+    Size int64
+}
+
+// WalkDir lists regular files under root with slash separated relative paths.
+func WalkDir(root string) ([]LocalFile, error) {
+    var out []LocalFile
+    err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if !info.Mode().IsRegular() { return nil }
+        rel, err := filepath.Rel(root, p)
+        if err != nil { return err }
+        out = append(out, LocalFile{Rel: filepath.ToSlash(rel), Size: info.Size()})
+        return nil
+    })
+    return out, err
+}
+
+// BuildManifest hashes every regular file under root for the sync protocol.
+func BuildManifest(root string) ([]model.SyncEntry, error) {
+    var out []model.SyncEntry
+    err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if !info.Mode().IsRegular() { return nil }
+        rel, err := filepath.Rel(root, p)
+        if err != nil { return err }
+        f, err := os.Open(p)
+        if err != nil { return err }
+        defer f.Close()
+        h := sha256.New()
+        if _, err := io.Copy(h, f); err != nil { return err }
+        out = append(out, model.SyncEntry{Path: filepath.ToSlash(rel), Size: info.Size(), Mtime: info.ModTime().Unix(), SHA256: hex.EncodeToString(h.Sum(nil))})
+        return nil
+    })
+    return out, err
+}
+
+// Batch splits files into groups whose total size stays under maxBytes so a
+// single request never exceeds the server's MAX_UPLOAD_SIZE_MB.
+func Batch(files []LocalFile, maxBytes int64) [][]string {
+    var out [][]string
+    var cur []string
+    var size int64
+    for _, f := range files {
+        if len(cur) > 0 && size+f.Size > maxBytes {
+            out = append(out, cur); cur = nil; size = 0
+        }
+        cur = append(cur, f.Rel); size += f.Size
+    }
+    if len(cur) > 0 { out = append(out, cur) }
+    return out
+}
+
+// FolderName returns the last element of dir, resolving "." to a real name.
+func FolderName(dir string) string {
+    if abs, err := filepath.Abs(dir); err == nil { dir = abs }
+    base := filepath.Base(dir)
+    if base == "." || base == string(filepath.Separator) || base == "" { base = "folder" }
+    return base
+}
+
+// DefaultUploadID mirrors the web UI: folder name plus a millisecond suffix.
+func DefaultUploadID(dir string) string {
+    return fmt.Sprintf("%s-%d", FolderName(dir), time.Now().UnixNano()/int64(time.Millisecond))
+}
\ No newline at end of file
@@ -0,0 +1,125 @@
+package client
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/binary"
+    "net"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+    "winchannel/internal/mdns"
+)
+
+// Server is a WinChannel instance found on the local network.
+type Server struct {
+    Instance string            `json:"instance"`
+    Host     string            `json:"host"`
+    Port     int               `json:"port"`
+    Addrs    []string          `json:"addrs"`
+    TXT      map[string]string `json:"txt"`
+    URL      string            `json:"url"`
+}
+
+// Discover browses for service (mdns.ServiceWinChannel when empty) with
+// multicast DNS until ctx is done, re-sending the query every second, and
+// returns the servers that answered.
+func Discover(ctx context.Context, service string) ([]Server, error) {
+    return discover(ctx, service, mdns.Group)
+}
+
+// discover sends the browse query to dst: the mDNS group, or a single
+// responder when multicast is unavailable.
+func discover(ctx context.Context, service string, dst *net.UDPAddr) ([]Server, error) {
+    if service == "" { service = mdns.ServiceWinChannel }
+    service = mdns.Fqdn(service)
+    if !strings.HasSuffix(service, ".local.") { service += "local." }
+    conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+    if err != nil { return nil, err }
+    defer conn.Close()
+
+    var idb [2]byte
+    rand.Read(idb[:])
+    q := (&mdns.Message{ID: binary.BigEndian.Uint16(idb[:]), Questions: []mdns.Question{{Name: service, Type: mdns.TypePTR, Class: mdns.ClassIN}}}).Pack()
+
+    var records []mdns.Record
+    buf := make([]byte, 9000)
+    next := time.Now()
+    for {
+        if ctx.Err() != nil { break }
+        if !time.Now().Before(next) {
+            if _, err := conn.WriteToUDP(q, dst); err != nil { return nil, err }
+            next = time.Now().Add(time.Second)
+        }
+        deadline := next
+        if d, ok := ctx.Deadline(); ok && d.Before(deadline) { deadline = d }
+        conn.SetReadDeadline(deadline)
+        n, _, err := conn.ReadFromUDP(buf)
+        if err != nil {
+            if ne, ok := err.(net.Error); ok && ne.Timeout() { continue }
+            return nil, err
+        }
+        m, err := mdns.Unpack(buf[:n])
+        if err != nil || !m.Response { continue }
+        records = append(records, m.Answers...)
+        records = append(records, m.Extras...)
+    }
+    return collectServers(service, records), nil
+}
+
+// collectServers joins PTR, SRV, TXT and address records into servers.
+func collectServers(service string, records []mdns.Record) []Server {
+    lower := strings.ToLower
+    srv := map[string]mdns.Record{}
+    txt := map[string][]string{}
+    addrs := map[string][]string{}
+    var instances []string
+    seenInst := map[string]bool{}
+    for _, r := range records {
+        switch r.Type {
+        case mdns.TypePTR:
+            if strings.EqualFold(r.Name, service) && r.TTL > 0 && !seenInst[lower(r.Target)] {
+                seenInst[lower(r.Target)] = true
+                instances = append(instances, r.Target)
+            }
+        case mdns.TypeSRV:
+            srv[lower(r.Name)] = r
+        case mdns.TypeTXT:
+            txt[lower(r.Name)] = r.Text
+        case mdns.TypeA, mdns.TypeAAAA:
+            if r.IP == nil { continue }
+            k, ip := lower(r.Name), r.IP.String()
+            dup := false
+            for _, a := range addrs[k] { if a == ip { dup = true } }
+            if !dup { addrs[k] = append(addrs[k], ip) }
+        }
+    }
+    var out []Server
+    for _, inst := range instances {
+        s, ok := srv[lower(inst)]
+        if !ok { continue }
+        sv := Server{
+            Instance: inst,
+            Host:     s.Target,
+            Port:     int(s.Port),
+            Addrs:    addrs[lower(s.Target)],
+            TXT:      map[string]string{},
+        }
+        if n := len(inst) - len(service) - 1; n > 0 && strings.EqualFold(inst[n:], "."+service) { sv.Instance = inst[:n] }
+        for _, kv := range txt[lower(inst)] {
+            k, v, _ := strings.Cut(kv, "=")
+            sv.TXT[lower(k)] = v
+        }
+        sort.SliceStable(sv.Addrs, func(i, j int) bool { return strings.Contains(sv.Addrs[j], ":") && !strings.Contains(sv.Addrs[i], ":") })
+        host := strings.TrimSuffix(sv.Host, ".")
+        if len(sv.Addrs) > 0 { host = sv.Addrs[0] }
+        scheme := sv.TXT["scheme"]
+        if scheme == "" { scheme = "http" }
+        path := sv.TXT["path"]
+        if path == "" { path = "/" }
+        sv.URL = scheme + "://" + net.JoinHostPort(host, strconv.Itoa(sv.Port)) + path
+        out = append(out, sv)
+    }
+    return out
+}
\ No newline at end of file
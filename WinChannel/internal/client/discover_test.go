@@ -0,0 +1,40 @@
+package client
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+    "winchannel/internal/mdns"
+)
+
+// TestDiscoverResponder starts a responder and browses for it. Where
+// multicast does not reach it, the query goes straight to 127.0.0.1:5353,
+// which the responder answers as a legacy unicast query.
+func TestDiscoverResponder(t *testing.T) {
+    r, err := mdns.NewResponder(mdns.Service{
+        Instance: "Test box",
+        Host:     "wc-test",
+        Port:     8123,
+        Text:     []string{"path=/app/", "scheme=https"},
+        Addrs:    func() []net.IP { return []net.IP{net.IPv4(127, 0, 0, 1)} },
+    }, nil)
+    if err != nil { t.Skipf("cannot join the mDNS group: %v", err) }
+    defer r.Close()
+
+    find := func(dst *net.UDPAddr) []Server {
+        ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+        defer cancel()
+        found, err := discover(ctx, "", dst)
+        if err != nil { t.Fatal(err) }
+        return found
+    }
+    found := find(mdns.Group)
+    if len(found) == 0 { found = find(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: mdns.Port}) }
+
+    var s *Server
+    for i := range found { if found[i].Instance == "Test box" { s = &found[i] } }
+    if s == nil { t.Fatalf("responder not found among %+v", found) }
+    if s.Host != "wc-test.local." || s.Port != 8123 { t.Fatalf("host/port = %s %d", s.Host, s.Port) }
+    if s.URL != "https://127.0.0.1:8123/app/" { t.Fatalf("url = %s", s.URL) }
+}
\ No newline at end of file
@@ -0,0 +1,340 @@
+// Package config builds the server configuration from defaults, an optional
+// JSON file, environment variables and command-line flags, in that order of
+// precedence (later wins).
+package config
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "net"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "winchannel/internal/atrest"
+)
+
+// TLS serves HTTPS from Cert/Key, or with Auto from a certificate issued by
+// a local CA kept under the data directory.
+type TLS struct {
+    Enabled bool   `json:"enabled"`
+    Auto    bool   `json:"auto"`
+    Cert    string `json:"cert"`
+    Key     string `json:"key"`
+}
+
+type Login struct {
+    MaxFailures    int `json:"max_failures"`
+    LockoutMinutes int `json:"lockout_minutes"`
+}
+
+type Log struct {
+    Level      string `json:"level"`
+    Format     string `json:"format"`
+    File       string `json:"file"`
+    MaxSizeMB  int    `json:"max_size_mb"`
+    MaxBackups int    `json:"max_backups"`
+    Access     bool   `json:"access"`
+}
+
+// MDNS controls the multicast DNS advertisement.
+type MDNS struct {
+    Enabled   bool   `json:"enabled"`
+    Hostname  string `json:"hostname"`  // advertised as <hostname>.local
+    Instance  string `json:"instance"`  // service instance name, default "WinChannel on <machine>"
+    Interface string `json:"interface"` // network interface to join the group on, "" for default
+}
+
+// Encryption stores uploads and text encrypted with AES-256-GCM. The master
+// key comes from KeyFile or Key (base64, 32 bytes); PreviousKeyFiles still
+// open files sealed before a key rotation.
+type Encryption struct {
+    Enabled          bool     `json:"enabled"`
+    KeyFile          string   `json:"key_file"`
+    Key              string   `json:"key"`
+    PreviousKeyFiles []string `json:"previous_key_files"`
+}
+
+type Config struct {
+    Port                   int        `json:"port"`
+    DataDir                string     `json:"data_dir"`
+    TemplatesDir           string     `json:"templates_dir"`
+    StaticDir              string     `json:"static_dir"`
+    MaxUploadSizeMB        int        `json:"max_upload_size_mb"`
+    ClipboardMaxItems      int        `json:"clipboard_max_items"`
+    ClipboardMaxMB         int        `json:"clipboard_max_mb"`
+    TransferRetentionDays  int        `json:"transfer_retention_days"`
+    ShutdownTimeoutSeconds int        `json:"shutdown_timeout_seconds"`
+    TrustProxy             bool       `json:"trust_proxy"`
+    CSRFTrustedOrigins     []string   `json:"csrf_trusted_origins"`
+    MetricsToken           string     `json:"metrics_token"`
+    TLS                    TLS        `json:"tls"`
+    Login                  Login      `json:"login"`
+    Log                    Log        `json:"log"`
+    MDNS                   MDNS       `json:"mdns"`
+    Encryption             Encryption `json:"encryption"`
+}
+
+// Default is the configuration used when nothing is set.
+func Default() *Config {
+    return &Config{
+        Port:                   8000,
+        DataDir:                "storage",
+        MaxUploadSizeMB:        512,
+        ClipboardMaxItems:      100,
+        ClipboardMaxMB:         16,
+        TransferRetentionDays:  30,
+        ShutdownTimeoutSeconds: 30,
+        Login:                  Login{MaxFailures: 10, LockoutMinutes: 15},
+        Log:                    Log{Level: "info", Format: "text", MaxSizeMB: 10, MaxBackups: 5, Access: true},
+        MDNS:                   MDNS{Enabled: true, Hostname: "winchannel"},
+    }
+}
+
+var current atomic.Pointer[Config]
+
+// Get returns the active configuration. It must not be modified.
+func Get() *Config {
+    if c := current.Load(); c != nil { return c }
+    c := Default()
+    current.CompareAndSwap(nil, c)
+    return current.Load()
+}
+
+// Set makes c the active configuration.
+func Set(c *Config) { current.Store(c) }
+
+// Loader remembers where the configuration came from so it can be rebuilt
+// on reload with the same file and flags.
+type Loader struct {
+    fs          *flag.FlagSet
+    file        string
+    PrintConfig bool
+
+    port, maxUpload                   int
+    dataDir, templatesDir, staticDir  string
+    logLevel, logFormat, cert, key    string
+    tls, tlsAuto                      bool
+}
+
+// NewLoader registers the server flags on fs.
+func NewLoader(fs *flag.FlagSet) *Loader {
+    l := &Loader{fs: fs}
+    fs.StringVar(&l.file, "config", os.Getenv("WINCHANNEL_CONFIG"), "path to a JSON config file (env WINCHANNEL_CONFIG)")
+    fs.BoolVar(&l.PrintConfig, "print-config", false, "print the effective configuration and exit")
+    fs.IntVar(&l.port, "port", 0, "listen port")
+    fs.StringVar(&l.dataDir, "data-dir", "", "storage directory (users, uploads, text)")
+    fs.StringVar(&l.templatesDir, "templates-dir", "", "serve HTML templates from this directory instead of the built-in copy")
+    fs.StringVar(&l.staticDir, "static-dir", "", "serve static assets from this directory instead of the built-in copy")
+    fs.IntVar(&l.maxUpload, "max-upload-size-mb", 0, "maximum upload request size in MB")
+    fs.StringVar(&l.logLevel, "log-level", "", "debug, info, warn or error")
+    fs.StringVar(&l.logFormat, "log-format", "", "text or json")
+    fs.BoolVar(&l.tls, "tls", false, "serve HTTPS with -tls-cert and -tls-key")
+    fs.BoolVar(&l.tlsAuto, "tls-auto", false, "serve HTTPS with a certificate from a built-in local CA")
+    fs.StringVar(&l.cert, "tls-cert", "", "TLS certificate file")
+    fs.StringVar(&l.key, "tls-key", "", "TLS private key file")
+    return l
+}
+
+// File is the config file in use, "" if none.
+func (l *Loader) File() string { return l.file }
+
+// Load builds and validates a fresh configuration.
+func (l *Loader) Load() (*Config, error) {
+    c := Default()
+    if l.file != "" {
+        b, err := os.ReadFile(l.file)
+        if err != nil { return nil, err }
+        dec := json.NewDecoder(strings.NewReader(string(b)))
+        dec.DisallowUnknownFields()
+        if err := dec.Decode(c); err != nil { return nil, fmt.Errorf("%s: %w", l.file, err) }
+        c.resolveRelativeTo(filepath.Dir(l.file))
+    }
+    if err := applyEnv(c); err != nil { return nil, err }
+    l.applyFlags(c)
+    if c.TLS.Auto { c.TLS.Enabled = true }
+    if c.DataDir != "" {
+        if abs, err := filepath.Abs(c.DataDir); err == nil { c.DataDir = abs }
+    }
+    if err := c.Validate(); err != nil { return nil, err }
+    return c, nil
+}
+
+// resolveRelativeTo anchors relative paths from a config file at the file's
+// directory, so the server finds its data no matter where it is started.
+func (c *Config) resolveRelativeTo(dir string) {
+    ps := []*string{&c.DataDir, &c.TemplatesDir, &c.StaticDir, &c.TLS.Cert, &c.TLS.Key, &c.Encryption.KeyFile}
+    for i := range c.Encryption.PreviousKeyFiles { ps = append(ps, &c.Encryption.PreviousKeyFiles[i]) }
+    for _, p := range ps {
+        if *p != "" && !filepath.IsAbs(*p) { *p = filepath.Join(dir, *p) }
+    }
+}
+
+func applyEnv(c *Config) error {
+    var errs []error
+    envInt := func(k string, dst *int) {
+        if v := os.Getenv(k); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil { errs = append(errs, fmt.Errorf("%s: not a number: %q", k, v)); return }
+            *dst = n
+        }
+    }
+    envStr := func(k string, dst *string) { if v := os.Getenv(k); v != "" { *dst = v } }
+    envBool := func(k string, dst *bool) { if v := os.Getenv(k); v != "" { *dst = v == "1" || strings.EqualFold(v, "true") } }
+
+    envInt("PORT", &c.Port)
+    envStr("DATA_DIR", &c.DataDir)
+    envStr("TEMPLATES_DIR", &c.TemplatesDir)
+    envStr("STATIC_DIR", &c.StaticDir)
+    envInt("MAX_UPLOAD_SIZE_MB", &c.MaxUploadSizeMB)
+    envInt("CLIPBOARD_MAX_ITEMS", &c.ClipboardMaxItems)
+    envInt("CLIPBOARD_MAX_MB", &c.ClipboardMaxMB)
+    envInt("TRANSFER_RETENTION_DAYS", &c.TransferRetentionDays)
+    envInt("SHUTDOWN_TIMEOUT_SECONDS", &c.ShutdownTimeoutSeconds)
+    envBool("TRUST_PROXY", &c.TrustProxy)
+    if v := os.Getenv("CSRF_TRUSTED_ORIGINS"); v != "" {
+        c.CSRFTrustedOrigins = nil
+        for _, o := range strings.Split(v, ",") { if o = strings.TrimSpace(o); o != "" { c.CSRFTrustedOrigins = append(c.CSRFTrustedOrigins, o) } }
+    }
+    envStr("METRICS_TOKEN", &c.MetricsToken)
+    envBool("ENABLE_TLS", &c.TLS.Enabled)
+    envBool("TLS_AUTO", &c.TLS.Auto)
+    envStr("TLS_CERT", &c.TLS.Cert)
+    envStr("TLS_KEY", &c.TLS.Key)
+    envInt("LOGIN_MAX_FAILURES", &c.Login.MaxFailures)
+    envInt("LOGIN_LOCKOUT_MINUTES", &c.Login.LockoutMinutes)
+    envStr("LOG_LEVEL", &c.Log.Level)
+    envStr("LOG_FORMAT", &c.Log.Format)
+    envStr("LOG_FILE", &c.Log.File)
+    envInt("LOG_MAX_SIZE_MB", &c.Log.MaxSizeMB)
+    envInt("LOG_MAX_BACKUPS", &c.Log.MaxBackups)
+    envBool("ACCESS_LOG", &c.Log.Access)
+    envBool("MDNS_ENABLED", &c.MDNS.Enabled)
+    envStr("MDNS_HOSTNAME", &c.MDNS.Hostname)
+    envStr("MDNS_INSTANCE", &c.MDNS.Instance)
+    envStr("MDNS_INTERFACE", &c.MDNS.Interface)
+    envBool("ENCRYPTION_ENABLED", &c.Encryption.Enabled)
+    envStr("ENCRYPTION_KEY_FILE", &c.Encryption.KeyFile)
+    envStr("ENCRYPTION_KEY", &c.Encryption.Key)
+    return errors.Join(errs...)
+}
+
+// applyFlags copies only the flags given on the command line.
+func (l *Loader) applyFlags(c *Config) {
+    l.fs.Visit(func(f *flag.Flag) {
+        switch f.Name {
+        case "port":
+            c.Port = l.port
+        case "data-dir":
+            c.DataDir = l.dataDir
+        case "templates-dir":
+            c.TemplatesDir = l.templatesDir
+        case "static-dir":
+            c.StaticDir = l.staticDir
+        case "max-upload-size-mb":
+            c.MaxUploadSizeMB = l.maxUpload
+        case "log-level":
+            c.Log.Level = l.logLevel
+        case "log-format":
+            c.Log.Format = l.logFormat
+        case "tls":
+            c.TLS.Enabled = l.tls
+        case "tls-auto":
+            c.TLS.Auto = l.tlsAuto
+        case "tls-cert":
+            c.TLS.Cert = l.cert
+        case "tls-key":
+            c.TLS.Key = l.key
+        }
+    })
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+    var errs []error
+    bad := func(format string, args ...interface{}) { errs = append(errs, fmt.Errorf(format, args...)) }
+    if c.Port < 1 || c.Port > 65535 { bad("port: must be 1-65535, got %d", c.Port) }
+    if c.DataDir == "" { bad("data_dir: must not be empty") }
+    for name, d := range map[string]string{"data_dir": c.DataDir, "templates_dir": c.TemplatesDir, "static_dir": c.StaticDir} {
+        if d == "" { continue }
+        if fi, err := os.Stat(d); err == nil && !fi.IsDir() { bad("%s: %s is not a directory", name, d) }
+        if name != "data_dir" {
+            if _, err := os.Stat(d); err != nil { bad("%s: %v", name, err) }
+        }
+    }
+    if c.MaxUploadSizeMB <= 0 { bad("max_upload_size_mb: must be positive, got %d", c.MaxUploadSizeMB) }
+    if c.ClipboardMaxItems < 1 || c.ClipboardMaxItems > 10000 { bad("clipboard_max_items: must be 1-10000, got %d", c.ClipboardMaxItems) }
+    if c.ClipboardMaxMB < 1 || c.ClipboardMaxMB > 1024 { bad("clipboard_max_mb: must be 1-1024, got %d", c.ClipboardMaxMB) }
+    if c.TransferRetentionDays < 1 || c.TransferRetentionDays > 3650 { bad("transfer_retention_days: must be 1-3650, got %d", c.TransferRetentionDays) }
+    if c.ShutdownTimeoutSeconds < 0 { bad("shutdown_timeout_seconds: must not be negative") }
+    for _, o := range c.CSRFTrustedOrigins {
+        if !strings.HasPrefix(o, "http://") && !strings.HasPrefix(o, "https://") { bad("csrf_trusted_origins: %q must start with http:// or https://", o) }
+    }
+    if c.TLS.Enabled && !c.TLS.Auto && (c.TLS.Cert == "" || c.TLS.Key == "") { bad("tls: cert and key are required when enabled without auto") }
+    if c.Login.MaxFailures <= 0 { bad("login.max_failures: must be positive") }
+    if c.Login.LockoutMinutes <= 0 { bad("login.lockout_minutes: must be positive") }
+    switch strings.ToLower(c.Log.Level) {
+    case "debug", "info", "warn", "warning", "error":
+    default:
+        bad("log.level: unknown level %q", c.Log.Level)
+    }
+    switch strings.ToLower(c.Log.Format) {
+    case "text", "json":
+    default:
+        bad("log.format: must be text or json, got %q", c.Log.Format)
+    }
+    if c.MDNS.Enabled {
+        if c.MDNS.Hostname == "" || strings.ContainsAny(c.MDNS.Hostname, ". ") { bad("mdns.hostname: must be a single label without dots or spaces, got %q", c.MDNS.Hostname) }
+        if c.MDNS.Interface != "" {
+            if _, err := net.InterfaceByName(c.MDNS.Interface); err != nil { bad("mdns.interface: %v", err) }
+        }
+    }
+    if c.Log.MaxSizeMB < 0 || c.Log.MaxBackups < 0 { bad("log: max_size_mb and max_backups must not be negative") }
+    if c.Encryption.Enabled {
+        if (c.Encryption.KeyFile == "") == (c.Encryption.Key == "") { bad("encryption: set exactly one of key_file and key when enabled") }
+        if c.Encryption.Key != "" {
+            if _, err := atrest.ParseKey(c.Encryption.Key); err != nil { bad("encryption.key: %v", err) }
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Redacted returns a copy safe to print or log.
+func (c *Config) Redacted() *Config {
+    cp := *c
+    if cp.MetricsToken != "" { cp.MetricsToken = "<redacted>" }
+    if cp.Encryption.Key != "" { cp.Encryption.Key = "<redacted>" }
+    return &cp
+}
+
+// Reload merges the settings that can change at runtime from next into a copy
+// of c. It returns the merged config and the names of changed settings that
+// need a restart and were therefore ignored.
+func (c *Config) Reload(next *Config) (*Config, []string) {
+    merged := *c
+    merged.MaxUploadSizeMB = next.MaxUploadSizeMB
+    merged.ClipboardMaxItems = next.ClipboardMaxItems
+    merged.ClipboardMaxMB = next.ClipboardMaxMB
+    merged.TransferRetentionDays = next.TransferRetentionDays
+    merged.ShutdownTimeoutSeconds = next.ShutdownTimeoutSeconds
+    merged.TrustProxy = next.TrustProxy
+    merged.CSRFTrustedOrigins = next.CSRFTrustedOrigins
+    merged.MetricsToken = next.MetricsToken
+    merged.Login = next.Login
+    merged.Log.Level = next.Log.Level
+    merged.Log.Access = next.Log.Access
+
+    var ignored []string
+    if next.Port != c.Port { ignored = append(ignored, "port") }
+    if next.DataDir != c.DataDir || next.TemplatesDir != c.TemplatesDir || next.StaticDir != c.StaticDir { ignored = append(ignored, "data_dir/templates_dir/static_dir") }
+    if next.TLS != c.TLS { ignored = append(ignored, "tls") }
+    if next.MDNS != c.MDNS { ignored = append(ignored, "mdns") }
+    if next.Encryption.Enabled != c.Encryption.Enabled || next.Encryption.KeyFile != c.Encryption.KeyFile || next.Encryption.Key != c.Encryption.Key || strings.Join(next.Encryption.PreviousKeyFiles, "\x00") != strings.Join(c.Encryption.PreviousKeyFiles, "\x00") {
+        ignored = append(ignored, "encryption")
+    }
+    if next.Log.Format != c.Log.Format || next.Log.File != c.Log.File || next.Log.MaxSizeMB != c.Log.MaxSizeMB || next.Log.MaxBackups != c.Log.MaxBackups { ignored = append(ignored, "log.format/file/rotation") }
+    return &merged, ignored
+}
\ No newline at end of file
@@ -0,0 +1,67 @@
+package dao
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "io"
+    "os"
+    "sync"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+)
+
+// auditMu serialises appends so concurrent entries never interleave.
+var auditMu sync.Mutex
+
+// AppendAudit writes one NDJSON line to the audit log. The file is only ever
+// opened for appending.
+func AppendAudit(e model.AuditEntry) error {
+    b, err := json.Marshal(e)
+    if err != nil { return err }
+    auditMu.Lock()
+    defer auditMu.Unlock()
+    if err := os.MkdirAll(paths.StorageDir, 0755); err != nil { return err }
+    f, err := os.OpenFile(paths.AuditFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil { return err }
+    if _, err := f.Write(append(b, '\n')); err != nil { f.Close(); return err }
+    return f.Close()
+}
+
+// maxAuditLine bounds one audit entry on read. Longer lines are skipped so a
+// single oversized entry cannot end every scan.
+const maxAuditLine = 1 << 20
+
+// readAuditLine returns the next line without its newline. A line longer
+// than maxAuditLine is consumed and returned as nil.
+func readAuditLine(r *bufio.Reader) ([]byte, error) {
+    var line []byte
+    long := false
+    for {
+        chunk, err := r.ReadSlice('\n')
+        if !long {
+            if len(line)+len(chunk) > maxAuditLine { long, line = true, nil } else { line = append(line, chunk...) }
+        }
+        if err == bufio.ErrBufferFull { continue }
+        return bytes.TrimRight(line, "\r\n"), err
+    }
+}
+
+// ScanAudit calls fn for every entry in file order until fn returns false.
+// Malformed and oversized lines are skipped.
+func ScanAudit(fn func(model.AuditEntry) bool) error {
+    f, err := os.Open(paths.AuditFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    defer f.Close()
+    br := bufio.NewReaderSize(f, 64*1024)
+    for {
+        line, err := readAuditLine(br)
+        if len(line) > 0 {
+            var e model.AuditEntry
+            if json.Unmarshal(line, &e) == nil && !fn(e) { return nil }
+        }
+        if err == io.EOF { return nil }
+        if err != nil { return err }
+    }
+}
\ No newline at end of file
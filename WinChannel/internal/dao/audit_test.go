@@ -0,0 +1,23 @@
+package dao
+
+import (
+    "os"
+    "strings"
+    "testing"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+)
+
+func TestScanAuditSkipsOversizedLines(t *testing.T) {
+    paths.SetStorageDir(t.TempDir())
+    if err := AppendAudit(model.AuditEntry{Action: "first"}); err != nil { t.Fatal(err) }
+    f, err := os.OpenFile(paths.AuditFile, os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil { t.Fatal(err) }
+    f.WriteString(`{"action":"huge","actor":"` + strings.Repeat("a", 3*maxAuditLine) + "\"}\n")
+    f.Close()
+    if err := AppendAudit(model.AuditEntry{Action: "last"}); err != nil { t.Fatal(err) }
+
+    var got []string
+    if err := ScanAudit(func(e model.AuditEntry) bool { got = append(got, e.Action); return true }); err != nil { t.Fatal(err) }
+    if strings.Join(got, ",") != "first,last" { t.Fatalf("scanned %v, want [first last]", got) }
+}
\ No newline at end of file
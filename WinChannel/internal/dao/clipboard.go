@@ -0,0 +1,38 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "winchannel/internal/atrest"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var Clipboard = &model.ClipboardStore{}
+
+// LoadClipboard reads the history. A file that cannot be decrypted or parsed
+// is an error: starting empty would overwrite it on the next save.
+func LoadClipboard() error {
+    Clipboard.Mu.Lock()
+    defer Clipboard.Mu.Unlock()
+    Clipboard.Items = nil
+    b, err := atrest.ReadFile(paths.ClipboardFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    if err := json.Unmarshal(b, &Clipboard.Items); err != nil { return fmt.Errorf("%s: %w", paths.ClipboardFile, err) }
+    return nil
+}
+
+// SaveClipboard replaces the history atomically; the caller holds
+// Clipboard.Mu.
+func SaveClipboard() error {
+    b, err := json.Marshal(Clipboard.Items)
+    if err == nil { b, err = atrest.Seal(b) }
+    if err != nil { return err }
+    return Store.Update(func(tx *txn.Tx) error {
+        tx.Write(paths.ClipboardFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
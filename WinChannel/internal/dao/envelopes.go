@@ -0,0 +1,37 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var Envelopes = &model.EnvelopeStore{M: map[string]model.Envelope{}}
+
+// LoadEnvelopes reads the file envelopes. A file that does not parse is an
+// error: without its envelope an encrypted upload cannot be opened again.
+func LoadEnvelopes() error {
+    Envelopes.Mu.Lock()
+    defer Envelopes.Mu.Unlock()
+    Envelopes.M = map[string]model.Envelope{}
+    b, err := os.ReadFile(paths.EnvelopesFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    if err := json.Unmarshal(b, &Envelopes.M); err != nil { return fmt.Errorf("%s: %w", paths.EnvelopesFile, err) }
+    if Envelopes.M == nil { Envelopes.M = map[string]model.Envelope{} }
+    return nil
+}
+
+// SaveEnvelopes replaces the file envelopes atomically; the caller holds
+// Envelopes.Mu.
+func SaveEnvelopes() error {
+    b, err := json.Marshal(Envelopes.M)
+    if err != nil { return err }
+    return Store.Update(func(tx *txn.Tx) error {
+        tx.Write(paths.EnvelopesFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
@@ -0,0 +1,40 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var PublicKeys = &model.PublicKeyStore{M: map[string]model.PublicKey{}}
+
+// LoadPublicKeys reads the registry. A file that does not parse is an error:
+// starting empty would drop every registered device on the next save.
+func LoadPublicKeys() error {
+    PublicKeys.Mu.Lock()
+    defer PublicKeys.Mu.Unlock()
+    PublicKeys.M = map[string]model.PublicKey{}
+    b, err := os.ReadFile(paths.KeysFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    var list []model.PublicKey
+    if err := json.Unmarshal(b, &list); err != nil { return fmt.Errorf("%s: %w", paths.KeysFile, err) }
+    for _, k := range list { PublicKeys.M[k.ID] = k }
+    return nil
+}
+
+// SavePublicKeys replaces the registry atomically; the caller holds
+// PublicKeys.Mu.
+func SavePublicKeys() error {
+    list := make([]model.PublicKey, 0, len(PublicKeys.M))
+    for _, k := range PublicKeys.M { list = append(list, k) }
+    b, err := json.MarshalIndent(list, "", "  ")
+    if err != nil { return err }
+    return Store.Update(func(tx *txn.Tx) error {
+        tx.Write(paths.KeysFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
@@ -0,0 +1,57 @@
+package dao
+
+import (
+    "encoding/json"
+    "os"
+    "time"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+// sessionsFile is the saved form of the session store. Sessions are keyed by
+// model.SessionKey; files from before hashing were a bare map keyed by the
+// cookie value and are converted on load.
+type sessionsFile struct {
+    Hashed map[string]model.Session `json:"hashed"`
+}
+
+// LoadSessions restores cookie sessions saved at the last shutdown, dropping
+// any that have expired since.
+func LoadSessions(s *model.SessionStore) {
+    b, err := os.ReadFile(paths.SessionsFile)
+    if err != nil { return }
+    var f sessionsFile
+    if err := json.Unmarshal(b, &f); err != nil { return }
+    if f.Hashed == nil {
+        legacy := map[string]model.Session{}
+        if err := json.Unmarshal(b, &legacy); err != nil { return }
+        f.Hashed = map[string]model.Session{}
+        for tok, sess := range legacy { f.Hashed[model.SessionKey(tok)] = sess }
+    }
+    now := time.Now()
+    s.Mu.Lock()
+    defer s.Mu.Unlock()
+    for key, sess := range f.Hashed {
+        if sess.TokenID == "" && now.Before(sess.Expires) { s.M[key] = sess }
+    }
+}
+
+// SaveSessions writes the unexpired cookie sessions so users stay signed in
+// across a restart. Only the session hashes are written, and the file is
+// replaced atomically so a crash during shutdown cannot tear it.
+func SaveSessions(s *model.SessionStore) error {
+    now := time.Now()
+    f := sessionsFile{Hashed: map[string]model.Session{}}
+    s.Mu.Lock()
+    for key, sess := range s.M {
+        if sess.TokenID == "" && now.Before(sess.Expires) { f.Hashed[key] = sess }
+    }
+    s.Mu.Unlock()
+    b, err := json.Marshal(f)
+    if err != nil { return err }
+    return Store.Update(func(tx *txn.Tx) error {
+        tx.Write(paths.SessionsFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
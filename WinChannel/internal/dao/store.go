@@ -0,0 +1,14 @@
+package dao
+
+import (
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+// Store commits the shared text state and users.json. Its lock is the one
+// writer lock for both.
+var Store = &txn.Store{}
+
+// OpenStore finishes a commit a crash interrupted. Call it before loading
+// anything Store writes.
+func OpenStore() (bool, error) { return Store.Open(paths.WALFile) }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package dao
+
+import (
+    "encoding/json"
+    "os"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var Tokens = &model.TokenStore{M: map[string]model.APIToken{}}
+
+func LoadTokens() {
+    Tokens.Mu.Lock()
+    defer Tokens.Mu.Unlock()
+    Tokens.M = map[string]model.APIToken{}
+    b, err := os.ReadFile(paths.TokensFile)
+    if err != nil { return }
+    var list []model.APIToken
+    if err := json.Unmarshal(b, &list); err != nil { return }
+    for _, t := range list { Tokens.M[t.Hash] = t }
+}
+
+// SaveTokens replaces tokens.json atomically. The snapshot is taken under the
+// store lock, so concurrent saves land in order and a revoked token cannot be
+// written back by an older snapshot.
+func SaveTokens() error {
+    return Store.Update(func(tx *txn.Tx) error {
+        Tokens.Mu.Lock()
+        list := make([]model.APIToken, 0, len(Tokens.M))
+        for _, t := range Tokens.M { list = append(list, t) }
+        Tokens.Mu.Unlock()
+        b, err := json.MarshalIndent(list, "", "  ")
+        if err != nil { return err }
+        tx.Write(paths.TokensFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
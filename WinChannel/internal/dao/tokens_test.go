@@ -0,0 +1,44 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "sync"
+    "testing"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+)
+
+// TestSaveTokensConcurrent creates and revokes tokens from many goroutines;
+// whatever order the saves run in, the file must end up matching memory.
+func TestSaveTokensConcurrent(t *testing.T) {
+    paths.SetStorageDir(t.TempDir())
+    if _, err := OpenStore(); err != nil { t.Fatal(err) }
+    Tokens.Mu.Lock(); Tokens.M = map[string]model.APIToken{}; Tokens.Mu.Unlock()
+
+    var wg sync.WaitGroup
+    for i := 0; i < 40; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            h := fmt.Sprintf("hash-%d", i)
+            Tokens.Mu.Lock(); Tokens.M[h] = model.APIToken{ID: fmt.Sprint(i), Hash: h}; Tokens.Mu.Unlock()
+            if err := SaveTokens(); err != nil { t.Error(err) }
+            if i%2 == 0 {
+                Tokens.Mu.Lock(); delete(Tokens.M, h); Tokens.Mu.Unlock()
+                if err := SaveTokens(); err != nil { t.Error(err) }
+            }
+        }(i)
+    }
+    wg.Wait()
+
+    b, err := os.ReadFile(paths.TokensFile)
+    if err != nil { t.Fatal(err) }
+    var list []model.APIToken
+    if err := json.Unmarshal(b, &list); err != nil { t.Fatal(err) }
+    if len(list) != 20 { t.Fatalf("file holds %d tokens, want 20", len(list)) }
+    for _, tok := range list {
+        if _, ok := Tokens.M[tok.Hash]; !ok { t.Fatalf("revoked token %s written back", tok.ID) }
+    }
+}
\ No newline at end of file
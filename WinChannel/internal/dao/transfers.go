@@ -0,0 +1,45 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "winchannel/internal/atrest"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var Transfers = &model.TransferStore{M: map[string]model.Transfer{}}
+
+// LoadTransfers reads the transfer log. A file that cannot be decrypted or
+// parsed is an error: starting empty would overwrite it on the next save.
+func LoadTransfers() error {
+    Transfers.Mu.Lock()
+    defer Transfers.Mu.Unlock()
+    Transfers.M = map[string]model.Transfer{}
+    b, err := atrest.ReadFile(paths.TransfersFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    var list []model.Transfer
+    if err := json.Unmarshal(b, &list); err != nil { return fmt.Errorf("%s: %w", paths.TransfersFile, err) }
+    for _, t := range list { Transfers.M[t.ID] = t }
+    return nil
+}
+
+// SaveTransfers replaces transfers.json atomically. The snapshot is taken
+// under the store lock, so a receipt saved by one request cannot be
+// overwritten by an older snapshot from another.
+func SaveTransfers() error {
+    return Store.Update(func(tx *txn.Tx) error {
+        Transfers.Mu.Lock()
+        list := make([]model.Transfer, 0, len(Transfers.M))
+        for _, t := range Transfers.M { list = append(list, t) }
+        Transfers.Mu.Unlock()
+        b, err := json.MarshalIndent(list, "", "  ")
+        if err == nil { b, err = atrest.Seal(b) }
+        if err != nil { return err }
+        tx.Write(paths.TransfersFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
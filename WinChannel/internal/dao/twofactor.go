@@ -0,0 +1,45 @@
+package dao
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/txn"
+)
+
+var TwoFactor = &model.TwoFactorStore{M: map[string]*model.TwoFactor{}}
+
+type twoFactorFile struct {
+    RequireAdmin bool                        `json:"require_admin_2fa"`
+    Users        map[string]*model.TwoFactor `json:"users"`
+}
+
+// LoadTwoFactor reads the enrollments. A file that exists but does not parse
+// is an error: starting without it would silently switch 2FA off.
+func LoadTwoFactor() error {
+    TwoFactor.Mu.Lock()
+    defer TwoFactor.Mu.Unlock()
+    TwoFactor.M = map[string]*model.TwoFactor{}
+    TwoFactor.RequireAdmin = false
+    b, err := os.ReadFile(paths.TwoFAFile)
+    if os.IsNotExist(err) { return nil }
+    if err != nil { return err }
+    var f twoFactorFile
+    if err := json.Unmarshal(b, &f); err != nil { return fmt.Errorf("%s: %w", paths.TwoFAFile, err) }
+    if f.Users != nil { TwoFactor.M = f.Users }
+    TwoFactor.RequireAdmin = f.RequireAdmin
+    return nil
+}
+
+// SaveTwoFactor replaces the file atomically. It must be called with
+// TwoFactor.Mu held.
+func SaveTwoFactor() error {
+    b, err := json.MarshalIndent(twoFactorFile{RequireAdmin: TwoFactor.RequireAdmin, Users: TwoFactor.M}, "", "  ")
+    if err != nil { return err }
+    return Store.Update(func(tx *txn.Tx) error {
+        tx.Write(paths.TwoFAFile, b, 0600)
+        return nil
+    })
+}
\ No newline at end of file
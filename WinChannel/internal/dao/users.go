@@ -5,48 +5,33 @@ import (
     "os"
     "winchannel/internal/model"
     "winchannel/internal/paths"
+    "winchannel/internal/txn"
 )
 
 var Users = &model.UserStore{Users: map[string]string{}}
 
 func LoadUsers() {
-    Users.Mu.Lock()
-    defer Users.Mu.Unlock()
-    if _, err := os.Stat(paths.UsersFile); err != nil {
-        _ = os.MkdirAll(paths.StorageDir, 0755)
-        f, _ := os.Create(paths.UsersFile)
-        if f != nil {
-            _ = json.NewEncoder(f).Encode(map[string]string{})
-            f.Close()
-        }
-        Users.Users = map[string]string{}
-        return
-    }
-    f, err := os.Open(paths.UsersFile)
-    if err != nil {
-        Users.Users = map[string]string{}
-        return
-    }
-    defer f.Close()
     m := map[string]string{}
-    if err := json.NewDecoder(f).Decode(&m); err != nil {
-        Users.Users = map[string]string{}
-        return
+    if b, err := os.ReadFile(paths.UsersFile); os.IsNotExist(err) {
+        _ = SaveUsers()
+    } else if err == nil {
+        if err := json.Unmarshal(b, &m); err != nil { m = map[string]string{} }
     }
+    Users.Mu.Lock()
     Users.Users = m
+    Users.Mu.Unlock()
 }
 
+// SaveUsers replaces users.json atomically. The snapshot is taken under the
+// store lock, so concurrent saves land in order and none overwrites a newer
+// state with an older one.
 func SaveUsers() error {
-    Users.Mu.Lock()
-    defer Users.Mu.Unlock()
-    tmp := Users.Users
-    if err := os.MkdirAll(paths.StorageDir, 0755); err != nil {
-        return err
-    }
-    f, err := os.Create(paths.UsersFile)
-    if err != nil {
-        return err
-    }
-    defer f.Close()
-    return json.NewEncoder(f).Encode(tmp)
+    return Store.Update(func(tx *txn.Tx) error {
+        Users.Mu.Lock()
+        b, err := json.Marshal(Users.Users)
+        Users.Mu.Unlock()
+        if err != nil { return err }
+        tx.Write(paths.UsersFile, append(b, '\n'), 0600)
+        return nil
+    })
 }
\ No newline at end of file
@@ -5,14 +5,13 @@ import (
     "net/http"
     "strings"
     "winchannel/internal/dao"
+    "winchannel/internal/model"
     "winchannel/internal/util"
     "winchannel/internal/service"
     "golang.org/x/crypto/bcrypt"
 )
 
 func AdminUsersList(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodGet { http.Error(w, "method not allowed", 405); return }
     type u struct { Username string `json:"username"`; Role string `json:"role"` }
     var list []u
     list = append(list, u{Username: "dreamstartooo", Role: "admin"})
@@ -25,51 +24,71 @@ func AdminUsersList(w http.ResponseWriter, r *http.Request) {
 }
 
 func AdminUsersCreate(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Username, Password string }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
     in.Username = strings.TrimSpace(in.Username)
-    if in.Username == "" || in.Password == "" { http.Error(w, "empty username or password", 400); return }
-    if in.Username == "dreamstartooo" { http.Error(w, "reserved admin username", 400); return }
+    if in.Username == "" || in.Password == "" { util.BadRequest(w, r, "empty username or password"); return }
+    if in.Username == "dreamstartooo" { util.BadRequest(w, r, "reserved admin username"); return }
     dao.Users.Mu.Lock()
-    if _, exists := dao.Users.Users[in.Username]; exists { dao.Users.Mu.Unlock(); http.Error(w, "user exists", 409); return }
+    if _, exists := dao.Users.Users[in.Username]; exists { dao.Users.Mu.Unlock(); util.WriteError(w, r, http.StatusConflict, util.CodeConflict, "user exists"); return }
     dao.Users.Mu.Unlock()
     hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
-    if err != nil { http.Error(w, "hash error", 500); return }
+    if err != nil { util.InternalError(w, r, err); return }
     dao.Users.Mu.Lock(); dao.Users.Users[in.Username] = string(hash); dao.Users.Mu.Unlock()
-    if err := dao.SaveUsers(); err != nil { http.Error(w, "save error", 500); return }
+    if err := dao.SaveUsers(); err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "admin.user.create", in.Username, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
 }
 
 func AdminUsersUpdatePassword(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Username, NewPassword string }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
     in.Username = strings.TrimSpace(in.Username)
-    if in.Username == "dreamstartooo" { http.Error(w, "cannot modify admin", 400); return }
+    if in.Username == "dreamstartooo" { util.BadRequest(w, r, "cannot modify admin"); return }
     dao.Users.Mu.Lock()
-    if _, exists := dao.Users.Users[in.Username]; !exists { dao.Users.Mu.Unlock(); http.Error(w, "user not found", 404); return }
+    if _, exists := dao.Users.Users[in.Username]; !exists { dao.Users.Mu.Unlock(); util.NotFound(w, r, "user not found"); return }
     dao.Users.Mu.Unlock()
     hash, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
-    if err != nil { http.Error(w, "hash error", 500); return }
+    if err != nil { util.InternalError(w, r, err); return }
     dao.Users.Mu.Lock(); dao.Users.Users[in.Username] = string(hash); dao.Users.Mu.Unlock()
-    if err := dao.SaveUsers(); err != nil { http.Error(w, "save error", 500); return }
+    if err := dao.SaveUsers(); err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "admin.user.password", in.Username, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
 }
 
 func AdminUsersDelete(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Username string }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
     in.Username = strings.TrimSpace(in.Username)
-    if in.Username == "dreamstartooo" { http.Error(w, "cannot delete admin", 400); return }
+    if in.Username == "dreamstartooo" { util.BadRequest(w, r, "cannot delete admin"); return }
     dao.Users.Mu.Lock()
-    if _, exists := dao.Users.Users[in.Username]; !exists { dao.Users.Mu.Unlock(); http.Error(w, "user not found", 404); return }
+    if _, exists := dao.Users.Users[in.Username]; !exists { dao.Users.Mu.Unlock(); util.NotFound(w, r, "user not found"); return }
     delete(dao.Users.Users, in.Username)
     dao.Users.Mu.Unlock()
-    if err := dao.SaveUsers(); err != nil { http.Error(w, "save error", 500); return }
+    if err := dao.SaveUsers(); err != nil { util.InternalError(w, r, err); return }
+    if err := service.RevokeUserTokens(in.Username); err != nil { util.InternalError(w, r, err); return }
+    if err := service.RemoveTwoFactor(in.Username); err != nil { util.InternalError(w, r, err); return }
+    service.RevokeUserSessions(in.Username, "")
+    if err := service.DeleteUserPublicKeys(in.Username); err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "admin.user.delete", in.Username, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
+
+// AdminLockouts lists accounts and client IPs with recent failed logins.
+func AdminLockouts(w http.ResponseWriter, r *http.Request) {
+    accounts, ips := service.LoginLockouts()
+    util.WriteJSON(w, map[string]interface{}{"accounts": accounts, "ips": ips})
+}
+
+// AdminLockoutsUnlock clears failures for an account and/or an IP.
+func AdminLockoutsUnlock(w http.ResponseWriter, r *http.Request) {
+    var in struct{ Username, IP string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    in.Username = strings.TrimSpace(in.Username); in.IP = strings.TrimSpace(in.IP)
+    if in.Username == "" && in.IP == "" { util.BadRequest(w, r, "username or ip required"); return }
+    found := false
+    if in.Username != "" && service.UnlockAccount(in.Username) { found = true }
+    if in.IP != "" && service.UnlockIP(in.IP) { found = true }
+    service.Audit(r, "admin.lockout.unlock", in.Username+" "+in.IP, model.AuditSuccess, map[string]interface{}{"username": in.Username, "ip": in.IP, "cleared": found})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "cleared": found})
 }
\ No newline at end of file
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+const (
+    defaultAuditLimit = 500
+    maxAuditLimit     = 10000
+)
+
+// parseAuditTime accepts RFC3339 or unix seconds.
+func parseAuditTime(v string) (time.Time, error) {
+    if v == "" { return time.Time{}, nil }
+    if n, err := strconv.ParseInt(v, 10, 64); err == nil { return time.Unix(n, 0).UTC(), nil }
+    return time.Parse(time.RFC3339, v)
+}
+
+// csvCell defuses a value a spreadsheet would run as a formula. Actor, user
+// agent and target come from clients, so every cell goes through it.
+func csvCell(v string) string {
+    if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) { return "'" + v }
+    return v
+}
+
+// GET /api/admin/audit?actor=&action=&result=&since=&until=&limit=&format=json|csv|ndjson
+func AdminAudit(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    f := service.AuditFilter{Actor: q.Get("actor"), Action: q.Get("action"), Result: q.Get("result")}
+    var err error
+    if f.Since, err = parseAuditTime(q.Get("since")); err != nil { util.BadRequest(w, r, "invalid since"); return }
+    if f.Until, err = parseAuditTime(q.Get("until")); err != nil { util.BadRequest(w, r, "invalid until"); return }
+
+    format := q.Get("format")
+    if format == "" { format = "json" }
+    switch format {
+    case "json":
+        limit := defaultAuditLimit
+        if v := q.Get("limit"); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n <= 0 { util.BadRequest(w, r, "invalid limit"); return }
+            if n > maxAuditLimit { n = maxAuditLimit }
+            limit = n
+        }
+        entries, err := service.QueryAudit(f, limit)
+        if err != nil { util.InternalError(w, r, err); return }
+        if entries == nil { entries = []model.AuditEntry{} }
+        util.WriteJSON(w, map[string]interface{}{"ok": true, "entries": entries, "count": len(entries)})
+    case "ndjson":
+        w.Header().Set("Content-Type", "application/x-ndjson")
+        w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+        enc := json.NewEncoder(w)
+        _ = service.ScanAuditFiltered(f, func(e model.AuditEntry) bool { return enc.Encode(e) == nil })
+    case "csv":
+        w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+        w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+        cw := csv.NewWriter(w)
+        _ = cw.Write([]string{"time", "actor", "ip", "user_agent", "action", "target", "result", "request_id", "details"})
+        _ = service.ScanAuditFiltered(f, func(e model.AuditEntry) bool {
+            details := ""
+            if len(e.Details) > 0 { b, _ := json.Marshal(e.Details); details = string(b) }
+            row := []string{e.Time.Format(time.RFC3339), e.Actor, e.IP, e.UserAgent, e.Action, e.Target, e.Result, e.RequestID, details}
+            for i := range row { row[i] = csvCell(row[i]) }
+            return cw.Write(row) == nil
+        })
+        cw.Flush()
+    default:
+        util.BadRequest(w, r, "format must be json, csv or ndjson")
+    }
+}
\ No newline at end of file
@@ -2,9 +2,12 @@ package handlers
 
 import (
     "encoding/json"
+    "math"
+    "net"
     "net/http"
     "strconv"
     "strings"
+    "winchannel/internal/config"
     "winchannel/internal/dao"
     "winchannel/internal/model"
     "winchannel/internal/service"
@@ -12,59 +15,125 @@ import (
     "golang.org/x/crypto/bcrypt"
 )
 
+// maxAuthBody bounds the JSON bodies of the unauthenticated auth endpoints.
+const maxAuthBody = 16 << 10
+
+// decodeAuthJSON reads a small JSON body into v, replying with 400 if it is
+// malformed or larger than maxAuthBody.
+func decodeAuthJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+    r.Body = http.MaxBytesReader(w, r.Body, maxAuthBody)
+    if err := json.NewDecoder(r.Body).Decode(v); err != nil { util.BadJSON(w, r, err); return false }
+    return true
+}
+
 func AuthRegister(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Username, Password string }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if !decodeAuthJSON(w, r, &in) { return }
     in.Username = strings.TrimSpace(in.Username)
-    if in.Username == "" || in.Password == "" { http.Error(w, "empty username or password", 400); return }
-    if in.Username == "dreamstartooo" { http.Error(w, "reserved admin username", 400); return }
+    if in.Username == "" || in.Password == "" { util.BadRequest(w, r, "empty username or password"); return }
+    if len(in.Username) > service.MaxUsernameLen { util.BadRequest(w, r, "username too long"); return }
+    if in.Username == "dreamstartooo" { util.BadRequest(w, r, "reserved admin username"); return }
     dao.Users.Mu.Lock()
-    if _, exists := dao.Users.Users[in.Username]; exists { dao.Users.Mu.Unlock(); http.Error(w, "user exists", 409); return }
+    if _, exists := dao.Users.Users[in.Username]; exists { dao.Users.Mu.Unlock(); util.WriteError(w, r, http.StatusConflict, util.CodeConflict, "user exists"); return }
     dao.Users.Mu.Unlock()
     hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
-    if err != nil { http.Error(w, "hash error", 500); return }
+    if err != nil { util.InternalError(w, r, err); return }
     dao.Users.Mu.Lock(); dao.Users.Users[in.Username] = string(hash); dao.Users.Mu.Unlock()
-    if err := dao.SaveUsers(); err != nil { http.Error(w, "save error", 500); return }
-    _ = service.SetSession(w, in.Username, "user")
+    if err := dao.SaveUsers(); err != nil { util.InternalError(w, r, err); return }
+    _ = service.SetSession(w, r, in.Username, "user")
+    service.AuditAs(r, in.Username, "auth.register", in.Username, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true, "username": in.Username, "role": "user"})
 }
 
+// dummyHash is compared against when the username is unknown so that both
+// failure paths cost one bcrypt comparison.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("winchannel-dummy-password"), bcrypt.DefaultCost)
+
+// loginFailed records the failure and replies with the same message whether
+// the account exists or not.
+func loginFailed(w http.ResponseWriter, r *http.Request, username, ip string) {
+    service.LoginFailed(username, ip)
+    service.AuditAs(r, username, "auth.login", username, model.AuditFailure, nil)
+    util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "invalid username or password")
+}
+
 func AuthLogin(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Username, Password string }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if !decodeAuthJSON(w, r, &in) { return }
     in.Username = strings.TrimSpace(in.Username)
+    // No account can have a longer name; reject before the name reaches the
+    // throttle tables or the audit log.
+    if len(in.Username) > service.MaxUsernameLen { util.BadRequest(w, r, "username too long"); return }
+    ip := util.ClientIP(r)
+    if ok, wait := service.LoginAllowed(in.Username, ip); !ok {
+        service.AuditAs(r, in.Username, "auth.login", in.Username, model.AuditDenied, map[string]interface{}{"reason": "throttled"})
+        w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        util.WriteError(w, r, http.StatusTooManyRequests, util.CodeTooManyRequests, "too many login attempts, retry later")
+        return
+    }
     if in.Username == "dreamstartooo" {
-        if in.Password != "123456" { http.Error(w, "invalid admin password", 401); return }
-        _ = service.SetSession(w, in.Username, "admin")
-        util.WriteJSON(w, map[string]interface{}{"ok": true, "username": in.Username, "role": "admin"})
+        if in.Password != "123456" { loginFailed(w, r, in.Username, ip); return }
+        service.LoginSucceeded(in.Username, ip)
+        completeLogin(w, r, in.Username, "admin")
         return
     }
     dao.Users.Mu.Lock(); hash, ok := dao.Users.Users[in.Username]; dao.Users.Mu.Unlock()
-    if !ok { http.Error(w, "user not found", 404); return }
-    if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(in.Password)); err != nil { http.Error(w, "invalid password", 401); return }
-    _ = service.SetSession(w, in.Username, "user")
-    util.WriteJSON(w, map[string]interface{}{"ok": true, "username": in.Username, "role": "user"})
+    if !ok {
+        _ = bcrypt.CompareHashAndPassword(dummyHash, []byte(in.Password))
+        loginFailed(w, r, in.Username, ip)
+        return
+    }
+    if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(in.Password)); err != nil { loginFailed(w, r, in.Username, ip); return }
+    service.LoginSucceeded(in.Username, ip)
+    completeLogin(w, r, in.Username, "user")
 }
 
 func AuthLogout(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
+    if s, ok := service.GetSession(r); ok { service.AuditAs(r, s.Username, "auth.logout", s.Username, model.AuditSuccess, nil) }
     service.ClearSession(w, r)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
 }
 
+// AuthCSRF returns the CSRF token for the double-submit check, setting the
+// cookie if needed.
+func AuthCSRF(w http.ResponseWriter, r *http.Request) {
+    tok, err := service.EnsureCSRFToken(w, r)
+    if err != nil { util.InternalError(w, r, err); return }
+    util.WriteJSON(w, map[string]interface{}{"csrf_token": tok, "header": service.CSRFHeader})
+}
+
 func AuthMe(w http.ResponseWriter, r *http.Request) {
     if s, ok := service.GetSession(r); ok {
-        util.WriteJSON(w, map[string]interface{}{"authenticated": true, "username": s.Username, "role": s.Role})
+        resp := map[string]interface{}{"authenticated": true, "username": s.Username, "role": s.Role}
+        if s.TokenID != "" { resp["token_id"] = s.TokenID; resp["scopes"] = s.Scopes }
+        util.WriteJSON(w, resp)
         return
     }
     util.WriteJSON(w, map[string]interface{}{"authenticated": false})
 }
 
+// GET /api/info[?all=1]: every URL the server is reachable on, localhost
+// first. Virtual adapters (VMs, containers) are only listed with all=1.
 func ApiInfo(w http.ResponseWriter, r *http.Request) {
-    portStr := util.GetenvDefault("PORT", "8000")
-    port, _ := strconv.Atoi(portStr)
-    ip := util.GetLocalIP()
-    util.WriteJSON(w, model.InfoResponse{HostIP: ip, Port: port, Urls: []string{"http://localhost:" + portStr + "/", "http://" + ip + ":" + portStr + "/"}})
+    util.WriteJSON(w, serverInfo(r.URL.Query().Get("all") == "1"))
+}
+
+func serverInfo(all bool) model.InfoResponse {
+    cfg := config.Get()
+    portStr := strconv.Itoa(cfg.Port)
+    info := model.InfoResponse{HostIP: "127.0.0.1", Port: cfg.Port, Urls: []string{serverScheme() + "://localhost:" + portStr + "/"}}
+    info.Addresses = util.LocalAddrs(all)
+    for i := range info.Addresses {
+        a := &info.Addresses[i]
+        a.URL = serverScheme() + "://" + net.JoinHostPort(a.IP, portStr) + "/"
+        info.Urls = append(info.Urls, a.URL)
+    }
+    if len(info.Addresses) > 0 { info.HostIP = info.Addresses[0].IP }
+    if info.Addresses == nil { info.Addresses = []model.InterfaceAddr{} }
+    return info
+}
+
+func serverScheme() string {
+    if config.Get().TLS.Enabled { return "https" }
+    return "http"
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "strconv"
+    "winchannel/internal/metrics"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// GET /api/clipboard[?q=&pinned=1&limit=n]: clipboard history, pinned
+// snippets first, then newest first.
+func ClipboardList(w http.ResponseWriter, r *http.Request) {
+    qs := r.URL.Query()
+    limit := 0
+    if v := qs.Get("limit"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 { util.BadRequest(w, r, "limit must be a non-negative integer"); return }
+        limit = n
+    }
+    util.WriteJSON(w, map[string]interface{}{"items": service.ListSnippets(qs.Get("q"), qs.Get("pinned") == "1", limit)})
+}
+
+// POST /api/clipboard/push {"content", "envelope", "client_id"}: saves a
+// snippet; with an envelope the content is base64 ciphertext.
+func ClipboardPush(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        Content  string          `json:"content"`
+        Envelope *model.Envelope `json:"envelope"`
+        ClientID string          `json:"client_id"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    sn, err := service.PushSnippet(r, in.Content, in.Envelope, in.ClientID)
+    if errors.Is(err, service.ErrSnippetEmpty) || errors.Is(err, service.ErrEnvelope) { util.BadRequest(w, r, err.Error()); return }
+    if errors.Is(err, service.ErrClipboardFull) { util.WriteError(w, r, http.StatusRequestEntityTooLarge, util.CodePayloadTooLarge, err.Error()); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "snippet": sn})
+}
+
+// POST /api/clipboard/pin {"id", "pinned"}
+func ClipboardPin(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        ID     string `json:"id"`
+        Pinned bool   `json:"pinned"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    sn, err := service.PinSnippet(in.ID, in.Pinned)
+    if errors.Is(err, service.ErrSnippetNotFound) { util.NotFound(w, r, err.Error()); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "snippet": sn})
+}
+
+// POST /api/clipboard/delete {"id"}
+func ClipboardDelete(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    err := service.DeleteSnippet(in.ID)
+    if errors.Is(err, service.ErrSnippetNotFound) { util.NotFound(w, r, err.Error()); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
+
+// POST /api/clipboard/restore {"id", "client_id"}: copies a snippet back
+// into the live text document as a new version.
+func ClipboardRestore(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        ID       string `json:"id"`
+        ClientID string `json:"client_id"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    sn, ok := service.GetSnippet(in.ID)
+    if !ok { util.NotFound(w, r, service.ErrSnippetNotFound.Error()); return }
+    v, err := writeTextState(sn.Content, sn.Envelope, in.ClientID)
+    if err != nil { util.InternalError(w, r, err); return }
+    metrics.TextUpdates.Inc()
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "version": v})
+}
\ No newline at end of file
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// GET /api/devices: the caller's signed-in devices, most recently used first.
+func DevicesList(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    util.WriteJSON(w, map[string]interface{}{"devices": service.ListDevices(r, s.Username)})
+}
+
+// POST /api/devices/rename {"id", "name"}
+func DevicesRename(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID, Name string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    if in.ID == "" || strings.TrimSpace(in.Name) == "" { util.BadRequest(w, r, "missing id or name"); return }
+    s, _ := service.GetSession(r)
+    if !service.RenameDevice(s.Username, in.ID, in.Name) { util.NotFound(w, r, "device not found"); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
+
+// POST /api/devices/revoke {"id"}: signs one of the caller's devices out.
+// Revoking the current device also clears its cookie.
+func DevicesRevoke(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    if in.ID == "" { util.BadRequest(w, r, "missing id"); return }
+    s, _ := service.GetSession(r)
+    current := in.ID == service.CurrentSessionID(r)
+    dev, ok := service.RevokeDevice(s.Username, in.ID)
+    if !ok { util.NotFound(w, r, "device not found"); return }
+    service.AuditAs(r, s.Username, "device.revoke", in.ID, model.AuditSuccess, map[string]interface{}{"device": dev.Device})
+    if current { service.ClearSession(w, r) }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "current": current})
+}
+
+// POST /api/devices/logout_all {"keep_current": bool}: signs the caller out
+// everywhere, optionally keeping the device making the request.
+func DevicesLogoutAll(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        KeepCurrent bool `json:"keep_current"`
+    }
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    }
+    s, _ := service.GetSession(r)
+    keep := ""
+    if in.KeepCurrent { keep = service.CurrentSessionID(r) }
+    n := service.RevokeUserSessions(s.Username, keep)
+    service.AuditAs(r, s.Username, "device.logout_all", s.Username, model.AuditSuccess, map[string]interface{}{"revoked": n, "kept_current": in.KeepCurrent})
+    if !in.KeepCurrent { service.ClearSession(w, r) }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "revoked": n})
+}
+
+// GET /api/admin/sessions[?username=]: active cookie sessions of all users.
+func AdminSessionsList(w http.ResponseWriter, r *http.Request) {
+    util.WriteJSON(w, map[string]interface{}{"sessions": service.ListDevices(r, strings.TrimSpace(r.URL.Query().Get("username")))})
+}
+
+// POST /api/admin/sessions/revoke {"id"} or {"username"}: ends one session
+// or every session of a user.
+func AdminSessionsRevoke(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID, Username string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    in.ID, in.Username = strings.TrimSpace(in.ID), strings.TrimSpace(in.Username)
+    switch {
+    case in.ID != "":
+        dev, ok := service.RevokeDevice("", in.ID)
+        if !ok { util.NotFound(w, r, "session not found"); return }
+        service.Audit(r, "admin.session.revoke", dev.Username, model.AuditSuccess, map[string]interface{}{"id": in.ID, "device": dev.Device})
+        util.WriteJSON(w, map[string]interface{}{"ok": true, "revoked": 1})
+    case in.Username != "":
+        n := service.RevokeUserSessions(in.Username, "")
+        service.Audit(r, "admin.session.revoke", in.Username, model.AuditSuccess, map[string]interface{}{"revoked": n})
+        util.WriteJSON(w, map[string]interface{}{"ok": true, "revoked": n})
+    default:
+        util.BadRequest(w, r, "missing id or username")
+    }
+}
\ No newline at end of file
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+    "winchannel/internal/service"
+)
+
+// eventsPing keeps idle streams alive through proxies and NAT.
+const eventsPing = 25 * time.Second
+
+// GET /api/events: server-sent events for the caller - inbox arrivals
+// ("transfer") and receipts for items they sent ("transfer.receipt").
+// Browsers reconnect by themselves when the stream ends.
+func Events(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    rc := http.NewResponseController(w)
+    _ = rc.SetWriteDeadline(time.Time{}) // the server's write timeout would cut the stream
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-store")
+    w.Header().Set("X-Accel-Buffering", "no")
+    sub := service.Subscribe(s.Username, service.CurrentSessionID(r))
+    defer service.Unsubscribe(sub)
+
+    io.WriteString(w, "retry: 3000\nevent: ready\ndata: {}\n\n")
+    if err := rc.Flush(); err != nil { return }
+    ping := time.NewTicker(eventsPing)
+    defer ping.Stop()
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case ev, ok := <-sub.C:
+            if !ok { return }
+            b, err := json.Marshal(ev.Data)
+            if err != nil { continue }
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b)
+        case <-ping.C:
+            io.WriteString(w, ": ping\n\n")
+        }
+        if err := rc.Flush(); err != nil { return }
+    }
+}
\ No newline at end of file
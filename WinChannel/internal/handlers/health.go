@@ -0,0 +1,22 @@
+package handlers
+
+import (
+    "net/http"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// PartialPrefix is exported so shutdown can sweep abandoned upload temp files.
+const PartialPrefix = partialPrefix
+
+// GET /healthz: the process is up and serving.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "status": "ok"})
+}
+
+// GET /readyz: storage is writable and the server is not shutting down.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+    if service.Draining() { util.WriteError(w, r, http.StatusServiceUnavailable, util.CodeUnavailable, "shutting down"); return }
+    if err := service.CheckStorage(); err != nil { util.WriteError(w, r, http.StatusServiceUnavailable, util.CodeUnavailable, err.Error()); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "status": "ready"})
+}
\ No newline at end of file
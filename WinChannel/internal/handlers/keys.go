@@ -0,0 +1,62 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "path/filepath"
+    "strings"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// GET /api/keys[?username=]: registered device public keys, so a sender can
+// wrap a content key for each recipient device.
+func KeysList(w http.ResponseWriter, r *http.Request) {
+    util.WriteJSON(w, map[string]interface{}{"keys": service.ListPublicKeys(strings.TrimSpace(r.URL.Query().Get("username")))})
+}
+
+// POST /api/keys/register {"alg", "key", "device"}: registers a public key
+// (base64 SPKI) for the caller. device defaults to the current device name.
+func KeysRegister(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        Alg    string `json:"alg"`
+        Key    string `json:"key"`
+        Device string `json:"device"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    s, _ := service.GetSession(r)
+    if in.Device == "" { in.Device = s.Device }
+    k, err := service.RegisterPublicKey(s.Username, in.Device, in.Alg, in.Key)
+    if errors.Is(err, service.ErrPublicKey) { util.BadRequest(w, r, err.Error()); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "key.register", k.ID, model.AuditSuccess, map[string]interface{}{"alg": k.Alg, "device": k.Device})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "key": k})
+}
+
+// POST /api/keys/delete {"kid"}: removes one of the caller's keys; admins
+// may remove any.
+func KeysDelete(w http.ResponseWriter, r *http.Request) {
+    var in struct{ KeyID string `json:"kid"` }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    s, _ := service.GetSession(r)
+    owner := s.Username
+    if s.Role == "admin" { owner = "" }
+    err := service.DeletePublicKey(owner, strings.TrimSpace(in.KeyID))
+    if errors.Is(err, service.ErrPublicKeyNotFound) { util.NotFound(w, r, err.Error()); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "key.delete", in.KeyID, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
+
+// GET /api/envelopes?upload_id=: envelopes of the client-side encrypted
+// files in an upload, keyed by path.
+func UploadEnvelopes(w http.ResponseWriter, r *http.Request) {
+    id := r.URL.Query().Get("upload_id")
+    if id == "" { util.BadRequest(w, r, "missing upload_id"); return }
+    dir := filepath.Join(paths.UploadsDir, id)
+    if !util.IsSafePath(paths.UploadsDir, dir) || filepath.Clean(dir) == filepath.Clean(paths.UploadsDir) { util.BadRequest(w, r, "invalid upload id"); return }
+    util.WriteJSON(w, map[string]interface{}{"upload_id": id, "files": service.FileEnvelopes(dir)})
+}
\ No newline at end of file
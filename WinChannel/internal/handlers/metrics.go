@@ -0,0 +1,19 @@
+package handlers
+
+import (
+    "net/http"
+    "winchannel/internal/metrics"
+    "winchannel/internal/service"
+)
+
+// GET /metrics in the Prometheus text format.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    metrics.WriteAll(w)
+    _, _, version := readTextState()
+    uploads, bytes := service.StorageUsage()
+    metrics.WriteGauge(w, "winchannel_active_sessions", "Unexpired cookie sessions.", float64(service.ActiveSessions()))
+    metrics.WriteGauge(w, "winchannel_text_version", "Current shared text version.", float64(version))
+    metrics.WriteGauge(w, "winchannel_uploads", "Upload directories in storage.", float64(uploads))
+    metrics.WriteGauge(w, "winchannel_storage_bytes", "Bytes used by uploads.", float64(bytes))
+}
\ No newline at end of file
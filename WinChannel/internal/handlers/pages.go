@@ -1,12 +1,30 @@
 package handlers
 
 import (
+    "bytes"
+    "io"
     "net/http"
-    "path/filepath"
-    "winchannel/internal/paths"
+    "winchannel/internal/assets"
     "winchannel/internal/service"
+    "winchannel/internal/util"
 )
 
+// serveTemplate sends one of the HTML pages from the configured asset source.
+func serveTemplate(w http.ResponseWriter, r *http.Request, name string) {
+    f, err := assets.Templates.Open(name)
+    if err != nil { util.NotFound(w, r, "page not found"); return }
+    defer f.Close()
+    fi, err := f.Stat()
+    if err != nil { util.InternalError(w, r, err); return }
+    rs, ok := f.(io.ReadSeeker)
+    if !ok {
+        b, err := io.ReadAll(f)
+        if err != nil { util.InternalError(w, r, err); return }
+        rs = bytes.NewReader(b)
+    }
+    http.ServeContent(w, r, fi.Name(), fi.ModTime(), rs)
+}
+
 func ServeIndex(w http.ResponseWriter, r *http.Request) {
     if _, ok := service.GetSession(r); ok {
         http.Redirect(w, r, "/app", http.StatusFound)
@@ -16,7 +34,7 @@ func ServeIndex(w http.ResponseWriter, r *http.Request) {
 }
 
 func ServeLogin(w http.ResponseWriter, r *http.Request) {
-    http.ServeFile(w, r, filepath.Join(paths.BaseDir, "templates", "login.html"))
+    serveTemplate(w, r, "login.html")
 }
 
 func ServeApp(w http.ResponseWriter, r *http.Request) {
@@ -24,7 +42,7 @@ func ServeApp(w http.ResponseWriter, r *http.Request) {
         http.Redirect(w, r, "/login", http.StatusFound)
         return
     }
-    http.ServeFile(w, r, filepath.Join(paths.BaseDir, "templates", "app.html"))
+    serveTemplate(w, r, "app.html")
 }
 
 func ServeUsersPage(w http.ResponseWriter, r *http.Request) {
@@ -36,5 +54,5 @@ func ServeUsersPage(w http.ResponseWriter, r *http.Request) {
         }
         return
     }
-    http.ServeFile(w, r, filepath.Join(paths.BaseDir, "templates", "users.html"))
+    serveTemplate(w, r, "users.html")
 }
\ No newline at end of file
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "io"
+    "net"
+    "net/http"
+    "net/url"
+    "strconv"
+    "time"
+    "winchannel/internal/model"
+    "winchannel/internal/qrcode"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+const (
+    qrDefaultScale = 8
+    qrMaxScale     = 20
+)
+
+// pairBaseURL picks the server URL a phone should open. An explicit choice
+// must be one the server advertises; otherwise the address the browser used
+// wins if it is one of those and not loopback, else the first network URL.
+func pairBaseURL(r *http.Request, want string) (string, bool) {
+    info := serverInfo(true)
+    if want != "" {
+        for _, u := range info.Urls { if u == want { return u, true } }
+        return "", false
+    }
+    // The Host header is the client's to choose, so it is only trusted when
+    // it names one of our own network addresses.
+    if host, _, err := net.SplitHostPort(r.Host); err == nil && host != "localhost" {
+        if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+            self := serverScheme() + "://" + r.Host + "/"
+            for _, u := range info.Urls { if u == self { return u, true } }
+        }
+    }
+    if len(info.Urls) > 1 { return info.Urls[1], true }
+    return info.Urls[0], true
+}
+
+func writeQR(w http.ResponseWriter, r *http.Request, content, format string, scale int) {
+    code, err := qrcode.Encode([]byte(content), qrcode.Medium)
+    if err != nil { util.BadRequest(w, r, err.Error()); return }
+    w.Header().Set("Cache-Control", "no-store")
+    switch format {
+    case "svg":
+        w.Header().Set("Content-Type", "image/svg+xml")
+        io.WriteString(w, code.SVG(scale))
+    default:
+        b, err := code.PNG(scale)
+        if err != nil { util.InternalError(w, r, err); return }
+        w.Header().Set("Content-Type", "image/png")
+        w.Write(b)
+    }
+}
+
+func qrParams(w http.ResponseWriter, r *http.Request) (format string, scale int, ok bool) {
+    q := r.URL.Query()
+    format = q.Get("format")
+    if format == "" { format = "png" }
+    if format != "png" && format != "svg" { util.BadRequest(w, r, "format must be png or svg"); return "", 0, false }
+    scale = qrDefaultScale
+    if v := q.Get("scale"); v != "" {
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 1 || n > qrMaxScale { util.BadRequest(w, r, "scale must be 1-"+strconv.Itoa(qrMaxScale)); return "", 0, false }
+        scale = n
+    }
+    return format, scale, true
+}
+
+// GET /api/qr[?url=...&format=png|svg&scale=N]: QR code of a server URL,
+// without credentials.
+func PairQR(w http.ResponseWriter, r *http.Request) {
+    format, scale, ok := qrParams(w, r)
+    if !ok { return }
+    base, ok := pairBaseURL(r, r.URL.Query().Get("url"))
+    if !ok { util.BadRequest(w, r, "url is not one of the server's advertised URLs"); return }
+    writeQR(w, r, base, format, scale)
+}
+
+// POST /api/pair: issues a one-time pairing link for the caller's account
+// and returns it with the QR code inline, so the token never appears in an
+// image URL. Opening the link on another device signs it in.
+func PairCreate(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        URL   string `json:"url"`
+        Scale int    `json:"scale"`
+    }
+    if r.ContentLength != 0 {
+        if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    }
+    if in.Scale == 0 { in.Scale = qrDefaultScale }
+    if in.Scale < 1 || in.Scale > qrMaxScale { util.BadRequest(w, r, "scale must be 1-"+strconv.Itoa(qrMaxScale)); return }
+    base, ok := pairBaseURL(r, in.URL)
+    if !ok { util.BadRequest(w, r, "url is not one of the server's advertised URLs"); return }
+    s, _ := service.GetSession(r)
+    tok, expires, err := service.CreatePairing(s)
+    if err != nil { util.InternalError(w, r, err); return }
+    link := base + "pair?token=" + url.QueryEscape(tok)
+    code, err := qrcode.Encode([]byte(link), qrcode.Medium)
+    if err != nil { util.InternalError(w, r, err); return }
+    png, err := code.PNG(in.Scale)
+    if err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "auth.pair.create", s.Username, model.AuditSuccess, map[string]interface{}{"url": base})
+    util.WriteJSON(w, map[string]interface{}{
+        "ok":         true,
+        "pair_url":   link,
+        "expires_at": expires.UTC().Format(time.RFC3339),
+        "qr_svg":     code.SVG(in.Scale),
+        "qr_png":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+    })
+}
+
+// GET /pair?token=...: the page a pairing link opens. It only asks for
+// confirmation; the token is redeemed by PairRedeem, so link previews and
+// prefetchers that follow the link cannot use it up.
+func ServePair(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Referrer-Policy", "no-referrer")
+    w.Header().Set("Cache-Control", "no-store")
+    serveTemplate(w, r, "pair.html")
+}
+
+// POST /api/pair/redeem {"token"}: redeems a pairing link and starts a
+// session on this device. The token is single use.
+func PairRedeem(w http.ResponseWriter, r *http.Request) {
+    var in struct{ Token string `json:"token"` }
+    if !decodeAuthJSON(w, r, &in) { return }
+    username, role, ok := service.RedeemPairing(in.Token)
+    if !ok {
+        service.AuditAs(r, "", "auth.pair", "", model.AuditFailure, nil)
+        util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "pairing link expired or already used")
+        return
+    }
+    if err := service.SetSession(w, r, username, role); err != nil { util.InternalError(w, r, err); return }
+    service.AuditAs(r, username, "auth.pair", username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "username": username, "role": role})
+}
\ No newline at end of file
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+type syncRequest struct {
+    UploadID    string            `json:"upload_id"`
+    Files       []model.SyncEntry `json:"files"`
+    DeleteExtra bool              `json:"delete_extra"`
+}
+
+// decodeSyncRequest parses the manifest body and resolves the upload root.
+func decodeSyncRequest(w http.ResponseWriter, r *http.Request) (syncRequest, string, bool) {
+    var in syncRequest
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return in, "", false }
+    in.UploadID = strings.TrimSpace(in.UploadID)
+    root, ok := uploadDir(in.UploadID)
+    if !ok { util.BadRequest(w, r, "invalid upload_id"); return in, "", false }
+    seen := map[string]bool{}
+    for i, e := range in.Files {
+        p, err := service.CleanSyncPath(e.Path)
+        if err != nil { util.BadRequest(w, r, err.Error()); return in, "", false }
+        if seen[p] { util.BadRequest(w, r, "duplicate path: "+p); return in, "", false }
+        seen[p] = true
+        in.Files[i].Path = p
+    }
+    return in, root, true
+}
+
+// SyncDiff compares a client manifest with an upload and tells the client which
+// files it still has to send.
+func SyncDiff(w http.ResponseWriter, r *http.Request) {
+    in, root, ok := decodeSyncRequest(w, r)
+    if !ok { return }
+    remote, err := service.ScanUpload(root, partialPrefix)
+    if err != nil { util.InternalError(w, r, err); return }
+    d := service.DiffManifest(root, in.Files, remote)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "upload_id": in.UploadID, "diff": d})
+}
+
+// SyncCommit finishes a sync round: optionally removes files that are not in
+// the manifest, stamps client mtimes on matching files and on files the client
+// has just uploaded, and reports whatever still differs.
+func SyncCommit(w http.ResponseWriter, r *http.Request) {
+    in, root, ok := decodeSyncRequest(w, r)
+    if !ok { return }
+    if err := os.MkdirAll(root, 0755); err != nil { util.InternalError(w, r, err); return }
+    remote, err := service.ScanUpload(root, partialPrefix)
+    if err != nil { util.InternalError(w, r, err); return }
+    d := service.DiffManifest(root, in.Files, remote)
+    deleted := []string{}
+    if in.DeleteExtra {
+        for _, p := range d.Extra {
+            target := filepath.Join(root, filepath.FromSlash(p))
+            if !util.IsSafePath(root, target) { continue }
+            if err := os.Remove(target); err == nil { service.SetFileEnvelope(target, nil); service.ForgetHash(target); deleted = append(deleted, p) }
+        }
+        pruneEmptyDirs(root)
+    }
+    entries := map[string]model.SyncEntry{}
+    for _, e := range in.Files { entries[e.Path] = e }
+    pending := map[string]bool{}
+    for _, p := range d.Missing { pending[p] = true }
+    for _, p := range d.Changed {
+        // Without a hash only size and mtime compare, and an upload leaves its
+        // own mtime; a file the client just sent takes the client's instead.
+        e, fi := entries[p], remote[p]
+        if e.SHA256 == "" && fi.Size() == e.Size && service.TakeUpload(filepath.Join(root, filepath.FromSlash(p)), fi) { continue }
+        pending[p] = true
+    }
+    for _, e := range in.Files {
+        if pending[e.Path] || e.Mtime <= 0 { continue }
+        mt := time.Unix(e.Mtime, 0)
+        _ = os.Chtimes(filepath.Join(root, filepath.FromSlash(e.Path)), mt, mt)
+    }
+    remote, _ = service.ScanUpload(root, partialPrefix)
+    d = service.DiffManifest(root, in.Files, remote)
+    service.Audit(r, "sync.commit", in.UploadID, model.AuditSuccess, map[string]interface{}{"files": len(in.Files), "deleted": len(deleted), "delete_extra": in.DeleteExtra})
+    inSync := len(d.Missing) == 0 && len(d.Changed) == 0 && (!in.DeleteExtra || len(d.Extra) == 0)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "in_sync": inSync, "upload_id": in.UploadID, "deleted": deleted, "diff": d})
+}
+
+// pruneEmptyDirs removes directories left empty under root, deepest first.
+func pruneEmptyDirs(root string) {
+    var dirs []string
+    filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err == nil && info.IsDir() && p != root { dirs = append(dirs, p) }
+        return nil
+    })
+    for i := len(dirs) - 1; i >= 0; i-- {
+        if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 { os.Remove(dirs[i]) }
+    }
+}
\ No newline at end of file
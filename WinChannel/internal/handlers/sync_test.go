@@ -0,0 +1,59 @@
+package handlers
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+)
+
+func syncCommit(t *testing.T, uploadID string, files []model.SyncEntry) (inSync bool, d model.SyncDiff) {
+    t.Helper()
+    b, _ := json.Marshal(map[string]interface{}{"upload_id": uploadID, "files": files})
+    rec := httptest.NewRecorder()
+    SyncCommit(rec, httptest.NewRequest(http.MethodPost, "/api/sync/commit", bytes.NewReader(b)))
+    if rec.Code != http.StatusOK { t.Fatalf("commit: %d %s", rec.Code, rec.Body) }
+    var out struct {
+        InSync bool           `json:"in_sync"`
+        Diff   model.SyncDiff `json:"diff"`
+    }
+    if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil { t.Fatal(err) }
+    return out.InSync, out.Diff
+}
+
+// TestSyncCommitStampsUploads syncs with a manifest that has no hashes: a file
+// the client has just uploaded takes the client's mtime, one it never sent
+// stays changed.
+func TestSyncCommitStampsUploads(t *testing.T) {
+    paths.SetStorageDir(t.TempDir())
+    if err := paths.EnsureDirs(); err != nil { t.Fatal(err) }
+    if _, err := dao.OpenStore(); err != nil { t.Fatal(err) }
+    root := filepath.Join(paths.UploadsDir, "site")
+    if err := os.MkdirAll(root, 0755); err != nil { t.Fatal(err) }
+    old := time.Unix(1600000000, 0)
+    stale := filepath.Join(root, "stale.txt")
+    os.WriteFile(stale, []byte("other"), 0644)
+    os.Chtimes(stale, old, old)
+
+    files := []model.SyncEntry{
+        {Path: "a.txt", Size: 5, Mtime: old.Unix()},
+        {Path: "stale.txt", Size: 5, Mtime: old.Unix() + 60},
+    }
+    if res := saveUploadFile(root, "a.txt", strings.NewReader("hello"), model.MergeOverwrite); res.Status != model.FileCreated { t.Fatalf("upload: %+v", res) }
+    inSync, d := syncCommit(t, "site", files)
+    if inSync || len(d.Changed) != 1 || d.Changed[0] != "stale.txt" { t.Fatalf("first commit: in_sync=%v diff=%+v, want only stale.txt changed", inSync, d) }
+    if fi, _ := os.Stat(filepath.Join(root, "a.txt")); !fi.ModTime().Equal(old) { t.Fatalf("a.txt mtime %v, want the client's %v", fi.ModTime(), old) }
+
+    // The client sends the stale file; the next commit converges.
+    if res := saveUploadFile(root, "stale.txt", strings.NewReader("fresh"), model.MergeOverwrite); res.Status != model.FileOverwritten { t.Fatalf("upload: %+v", res) }
+    if inSync, d := syncCommit(t, "site", files); !inSync { t.Fatalf("second commit not in sync: %+v", d) }
+    if inSync, d := syncCommit(t, "site", files); !inSync { t.Fatalf("third commit not in sync: %+v", d) }
+}
\ No newline at end of file
@@ -9,70 +9,99 @@ import (
     "strconv"
     "strings"
     "time"
+    "winchannel/internal/atrest"
+    "winchannel/internal/dao"
+    "winchannel/internal/metrics"
+    "winchannel/internal/model"
     "winchannel/internal/paths"
     "winchannel/internal/service"
+    "winchannel/internal/txn"
     "winchannel/internal/util"
 )
 
-func readTextState() (string, int64) {
-    curPath := filepath.Join(paths.TextDir, "current.txt")
-    verPath := filepath.Join(paths.TextDir, "version.txt")
+// textPath names a file of the shared text state.
+func textPath(name string) string { return filepath.Join(paths.TextDir, name) }
+
+// loadTextState reads the text, its envelope (nil while it is plaintext) and
+// its version. The caller holds the store lock so the three match.
+func loadTextState() (string, *model.Envelope, int64) {
     content := ""
     version := int64(0)
-    if b, err := os.ReadFile(curPath); err == nil { content = string(b) }
-    if b, err := os.ReadFile(verPath); err == nil {
+    var env *model.Envelope
+    if b, err := atrest.ReadFile(textPath("current.txt")); err == nil { content = string(b) }
+    if b, err := os.ReadFile(textPath("version.txt")); err == nil {
         if v, err2 := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64); err2 == nil { version = v }
     }
-    return content, version
+    if b, err := os.ReadFile(textPath("envelope.json")); err == nil {
+        var e model.Envelope
+        if json.Unmarshal(b, &e) == nil { env = &e }
+    }
+    return content, env, version
 }
 
-func writeTextState(content string, clientID string) int64 {
-    curPath := filepath.Join(paths.TextDir, "current.txt")
-    verPath := filepath.Join(paths.TextDir, "version.txt")
-    histPath := filepath.Join(paths.TextDir, "history.ndjson")
-    os.MkdirAll(paths.TextDir, 0755)
-    os.WriteFile(curPath, []byte(content), 0644)
-    _, old := readTextState()
-    version := old + 1
-    os.WriteFile(verPath, []byte(strconv.FormatInt(version, 10)), 0644)
-    entry := map[string]interface{}{"version": version, "client_id": clientID, "timestamp": float64(time.Now().Unix())}
-    f, err := os.OpenFile(histPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-    if err == nil {
-        enc := json.NewEncoder(f)
-        enc.Encode(entry)
-        f.Close()
-    }
-    return version
+// readTextState returns a consistent snapshot of the text state.
+func readTextState() (content string, env *model.Envelope, version int64) {
+    dao.Store.View(func() { content, env, version = loadTextState() })
+    return
+}
+
+// writeTextState stores content as the next version. The text, envelope,
+// version and history entry are committed together under the store lock, so
+// concurrent updates get distinct versions and a crash never leaves the text
+// and version out of step.
+func writeTextState(content string, env *model.Envelope, clientID string) (int64, error) {
+    var version int64
+    err := dao.Store.Update(func(tx *txn.Tx) error {
+        _, _, old := loadTextState()
+        version = old + 1
+        sealed, err := atrest.Seal([]byte(content))
+        if err != nil { return err }
+        tx.Write(textPath("current.txt"), sealed, 0644)
+        if env != nil {
+            b, err := json.Marshal(env)
+            if err != nil { return err }
+            tx.Write(textPath("envelope.json"), b, 0644)
+        } else {
+            tx.Remove(textPath("envelope.json"))
+        }
+        tx.Write(textPath("version.txt"), []byte(strconv.FormatInt(version, 10)), 0644)
+        entry := map[string]interface{}{"version": version, "client_id": clientID, "timestamp": float64(time.Now().Unix()), "encrypted": env != nil}
+        line, err := json.Marshal(entry)
+        if err != nil { return err }
+        return tx.Append(textPath("history.ndjson"), append(line, '\n'), 0644)
+    })
+    return version, err
 }
 
 func ApiTextState(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
-    c, v := readTextState()
-    util.WriteJSON(w, map[string]interface{}{"content": c, "version": v, "updated_at": time.Now().Format(time.RFC3339)})
+    c, env, v := readTextState()
+    util.WriteJSON(w, map[string]interface{}{"content": c, "envelope": env, "version": v, "updated_at": time.Now().Format(time.RFC3339)})
 }
 
 func ApiTextUpdate(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
     var body struct{
         Content string `json:"content"`
+        Envelope *model.Envelope `json:"envelope"`
         ClientID string `json:"client_id"`
     }
     dec := json.NewDecoder(r.Body)
-    if err := dec.Decode(&body); err != nil { http.Error(w, err.Error(), 400); return }
-    v := writeTextState(body.Content, body.ClientID)
+    if err := dec.Decode(&body); err != nil { util.BadJSON(w, r, err); return }
+    if err := service.ValidateSealed(body.Envelope, body.Content); err != nil { util.BadRequest(w, r, err.Error()); return }
+    v, err := writeTextState(body.Content, body.Envelope, body.ClientID)
+    if err != nil { util.InternalError(w, r, err); return }
+    metrics.TextUpdates.Inc()
     util.WriteJSON(w, map[string]interface{}{"ok": true, "version": v})
 }
 
 func ApiTextHistory(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
     qs := r.URL.Query()
     afterStr := qs.Get("after_version")
     after := int64(-1)
     if afterStr != "" { if v, err := strconv.ParseInt(afterStr, 10, 64); err == nil { after = v } }
-    histPath := filepath.Join(paths.TextDir, "history.ndjson")
     var items []map[string]interface{}
-    f, err := os.Open(histPath)
-    if err == nil {
+    dao.Store.View(func() {
+        f, err := os.Open(textPath("history.ndjson"))
+        if err != nil { return }
         defer f.Close()
         s := bufio.NewScanner(f)
         for s.Scan() {
@@ -81,6 +110,6 @@ func ApiTextHistory(w http.ResponseWriter, r *http.Request) {
                 if v, ok := m["version"].(float64); ok { if int64(v) > after { items = append(items, m) } }
             }
         }
-    }
+    })
     util.WriteJSON(w, map[string]interface{}{"items": items})
 }
\ No newline at end of file
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "sync"
+    "testing"
+    "winchannel/internal/dao"
+    "winchannel/internal/paths"
+)
+
+func TestWriteTextStateConcurrent(t *testing.T) {
+    paths.SetStorageDir(t.TempDir())
+    if err := paths.EnsureDirs(); err != nil { t.Fatal(err) }
+    if _, err := dao.OpenStore(); err != nil { t.Fatal(err) }
+
+    const n = 40
+    versions := make([]int64, n)
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            v, err := writeTextState(fmt.Sprintf("from %d", i), nil, fmt.Sprintf("client-%d", i))
+            if err != nil { t.Error(err) }
+            versions[i] = v
+        }(i)
+    }
+    wg.Wait()
+
+    writer := map[int64]int{}
+    for i, v := range versions {
+        if v < 1 || v > n { t.Fatalf("version %d out of range 1..%d", v, n) }
+        if j, dup := writer[v]; dup { t.Fatalf("writers %d and %d both got version %d", j, i, v) }
+        writer[v] = i
+    }
+    content, env, version := readTextState()
+    if version != n { t.Fatalf("version = %d, want %d", version, n) }
+    if env != nil { t.Fatalf("unexpected envelope %+v", env) }
+    if want := fmt.Sprintf("from %d", writer[n]); content != want { t.Fatalf("content = %q, want %q from the writer of version %d", content, want, n) }
+
+    f, err := os.Open(textPath("history.ndjson"))
+    if err != nil { t.Fatal(err) }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    var next int64 = 1
+    for sc.Scan() {
+        var e struct {
+            Version  int64  `json:"version"`
+            ClientID string `json:"client_id"`
+        }
+        if err := json.Unmarshal(sc.Bytes(), &e); err != nil { t.Fatalf("history line %d: %v", next, err) }
+        if e.Version != next { t.Fatalf("history line %d has version %d", next, e.Version) }
+        if want := fmt.Sprintf("client-%d", writer[e.Version]); e.ClientID != want { t.Fatalf("history version %d from %q, want %q", e.Version, e.ClientID, want) }
+        next++
+    }
+    if next != n+1 { t.Fatalf("history has %d entries, want %d", next-1, n) }
+}
\ No newline at end of file
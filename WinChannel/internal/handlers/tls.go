@@ -0,0 +1,30 @@
+package handlers
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/pem"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "winchannel/internal/config"
+    "winchannel/internal/paths"
+    "winchannel/internal/util"
+)
+
+// GET /api/tls/ca.crt: the local CA certificate for installing on devices
+// when tls.auto is on. The SHA-256 fingerprint is sent in X-CA-SHA256 so it
+// can be compared with the one printed at startup.
+func TLSCACert(w http.ResponseWriter, r *http.Request) {
+    if !config.Get().TLS.Auto { util.NotFound(w, r, "automatic TLS is not enabled"); return }
+    b, err := os.ReadFile(filepath.Join(paths.TLSDir, "ca.crt"))
+    if err != nil { util.NotFound(w, r, "CA certificate not found"); return }
+    if blk, _ := pem.Decode(b); blk != nil {
+        sum := sha256.Sum256(blk.Bytes)
+        w.Header().Set("X-CA-SHA256", strings.ToUpper(hex.EncodeToString(sum[:])))
+    }
+    w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+    w.Header().Set("Content-Disposition", `attachment; filename="winchannel-ca.crt"`)
+    w.Write(b)
+}
\ No newline at end of file
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "time"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// TokensList returns the caller's tokens; admins may pass all=1 to see every
+// user's tokens. Hashes are never returned.
+func TokensList(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    owner := s.Username
+    if r.URL.Query().Get("all") == "1" {
+        if s.Role != "admin" { util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "admin required"); return }
+        owner = ""
+    }
+    util.WriteJSON(w, map[string]interface{}{"tokens": service.ListTokens(owner)})
+}
+
+func TokensCreate(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    var in struct {
+        Name          string   `json:"name"`
+        Scopes        []string `json:"scopes"`
+        ExpiresInDays int      `json:"expires_in_days"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    in.Name = strings.TrimSpace(in.Name)
+    if in.Name == "" { util.BadRequest(w, r, "empty name"); return }
+    if in.ExpiresInDays < 0 || in.ExpiresInDays > 3650 { util.BadRequest(w, r, "invalid expires_in_days"); return }
+    scopes, err := service.NormalizeScopes(in.Scopes, s.Role)
+    if err != nil { util.BadRequest(w, r, err.Error()); return }
+    plain, t, err := service.CreateToken(s.Username, s.Role, in.Name, scopes, time.Duration(in.ExpiresInDays)*24*time.Hour)
+    if err != nil { util.InternalError(w, r, err); return }
+    t.Hash = ""
+    service.Audit(r, "token.create", t.ID, model.AuditSuccess, map[string]interface{}{"name": t.Name, "scopes": t.Scopes})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "token": plain, "info": t})
+}
+
+// TokensRevoke deletes one of the caller's tokens; admins may revoke any.
+func TokensRevoke(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    var in struct{ ID string `json:"id"` }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    owner := s.Username
+    if s.Role == "admin" { owner = "" }
+    found, err := service.RevokeToken(strings.TrimSpace(in.ID), owner)
+    if err != nil { util.InternalError(w, r, err); return }
+    if !found { util.NotFound(w, r, "token not found"); return }
+    service.Audit(r, "token.revoke", in.ID, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
\ No newline at end of file
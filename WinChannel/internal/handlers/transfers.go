@@ -0,0 +1,79 @@
+package handlers
+
+import (
+    "encoding/json"
+    "errors"
+    "net/http"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// POST /api/transfers/send: pushes text, a file of an upload, or a whole
+// upload to a user, optionally to one of their devices.
+func TransfersSend(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        To       string          `json:"to"`
+        ToDevice string          `json:"to_device"`
+        Kind     string          `json:"kind"`
+        UploadID string          `json:"upload_id"`
+        Path     string          `json:"path"`
+        Text     string          `json:"text"`
+        Envelope *model.Envelope `json:"envelope"`
+        Note     string          `json:"note"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    s, _ := service.GetSession(r)
+    t, err := service.SendTransfer(r, s, model.Transfer{
+        To: in.To, ToDevice: in.ToDevice, Kind: in.Kind, UploadID: in.UploadID, Path: in.Path, Text: in.Text, Envelope: in.Envelope, Note: in.Note,
+    })
+    switch {
+    case errors.Is(err, service.ErrTransferRecipient), errors.Is(err, service.ErrTransferDevice), errors.Is(err, service.ErrTransferSource):
+        util.NotFound(w, r, err.Error())
+        return
+    case errors.Is(err, service.ErrTransferKind), errors.Is(err, service.ErrTransferText), errors.Is(err, service.ErrEnvelope):
+        util.BadRequest(w, r, err.Error())
+        return
+    case err != nil:
+        util.InternalError(w, r, err)
+        return
+    }
+    service.Audit(r, "transfer.send", t.To, model.AuditSuccess, map[string]interface{}{"id": t.ID, "kind": t.Kind, "upload_id": t.UploadID, "path": t.Path})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "transfer": t})
+}
+
+// GET /api/transfers/inbox: items sent to the caller (on this device).
+// Listing counts as delivery.
+func TransfersInbox(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    util.WriteJSON(w, map[string]interface{}{"transfers": service.Inbox(s.Username, service.CurrentSessionID(r))})
+}
+
+// GET /api/transfers/sent: items the caller sent, with their receipt status.
+func TransfersSent(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    util.WriteJSON(w, map[string]interface{}{"transfers": service.SentTransfers(s.Username)})
+}
+
+// POST /api/transfers/read {"id"}: marks an inbox item read and notifies
+// the sender.
+func TransfersRead(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    s, _ := service.GetSession(r)
+    t, ok := service.MarkTransferRead(s.Username, service.CurrentSessionID(r), in.ID)
+    if !ok { util.NotFound(w, r, "transfer not found"); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "transfer": t})
+}
+
+// POST /api/transfers/delete {"id"}: the sender or the recipient removes a
+// transfer. The referenced upload is kept.
+func TransfersDelete(w http.ResponseWriter, r *http.Request) {
+    var in struct{ ID string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    s, _ := service.GetSession(r)
+    ok, err := service.DeleteTransfer(s.Username, in.ID)
+    if err != nil { util.InternalError(w, r, err); return }
+    if !ok { util.NotFound(w, r, "transfer not found"); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
\ No newline at end of file
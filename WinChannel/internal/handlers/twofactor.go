@@ -0,0 +1,152 @@
+package handlers
+
+import (
+    "encoding/json"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// completeLogin is called once the password has been verified. Accounts with
+// 2FA get a pending login instead of a session.
+func completeLogin(w http.ResponseWriter, r *http.Request, username, role string) {
+    if service.TwoFactorEnabled(username) {
+        tok, err := service.StartPendingLogin(w, username, role)
+        if err != nil { util.InternalError(w, r, err); return }
+        service.AuditAs(r, username, "auth.login", username, model.AuditSuccess, map[string]interface{}{"pending_2fa": true})
+        util.WriteJSON(w, map[string]interface{}{"ok": true, "two_factor_required": true, "pending_token": tok})
+        return
+    }
+    _ = service.SetSession(w, r, username, role)
+    service.AuditAs(r, username, "auth.login", username, model.AuditSuccess, nil)
+    resp := map[string]interface{}{"ok": true, "username": username, "role": role}
+    if role == "admin" && service.AdminTwoFactorRequired() { resp["two_factor_setup_required"] = true }
+    util.WriteJSON(w, resp)
+}
+
+// AuthTwoFactorVerify exchanges a pending login plus a TOTP or recovery code
+// for a full session.
+func AuthTwoFactorVerify(w http.ResponseWriter, r *http.Request) {
+    var in struct {
+        Code         string `json:"code"`
+        PendingToken string `json:"pending_token"`
+    }
+    if !decodeAuthJSON(w, r, &in) { return }
+    tok, p, ok := service.PendingFromRequest(r, in.PendingToken)
+    if !ok { util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "login expired, sign in again"); return }
+    ip := util.ClientIP(r)
+    if ok, wait := service.LoginAllowed(p.Username, ip); !ok {
+        service.AuditAs(r, p.Username, "auth.2fa.verify", p.Username, model.AuditDenied, map[string]interface{}{"reason": "throttled"})
+        w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+        util.WriteError(w, r, http.StatusTooManyRequests, util.CodeTooManyRequests, "too many login attempts, retry later")
+        return
+    }
+    if !service.VerifySecondFactor(p.Username, in.Code, true) {
+        service.FailPendingLogin(tok)
+        service.LoginFailed(p.Username, ip)
+        service.AuditAs(r, p.Username, "auth.2fa.verify", p.Username, model.AuditFailure, nil)
+        util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "invalid code")
+        return
+    }
+    service.FinishPendingLogin(w, tok)
+    service.LoginSucceeded(p.Username, ip)
+    _ = service.SetSession(w, r, p.Username, p.Role)
+    service.AuditAs(r, p.Username, "auth.2fa.verify", p.Username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "username": p.Username, "role": p.Role})
+}
+
+func AuthTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    enabled, left := service.TwoFactorStatus(s.Username)
+    util.WriteJSON(w, map[string]interface{}{"enabled": enabled, "recovery_codes_left": left, "admin_required": service.AdminTwoFactorRequired()})
+}
+
+// AuthTwoFactorSetup starts enrollment and returns the secret and otpauth URI
+// to render as a QR code.
+func AuthTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    secret, uri, err := service.BeginTwoFactorSetup(s.Username)
+    if err != nil { util.InternalError(w, r, err); return }
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "secret": secret, "otpauth_uri": uri})
+}
+
+func readCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+    var in struct{ Code string `json:"code"` }
+    if !decodeAuthJSON(w, r, &in) { return "", false }
+    in.Code = strings.TrimSpace(in.Code)
+    if in.Code == "" { util.BadRequest(w, r, "empty code"); return "", false }
+    return in.Code, true
+}
+
+func twoFactorError(w http.ResponseWriter, r *http.Request, err error) {
+    switch err {
+    case service.ErrTwoFactorBadCode:
+        util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, err.Error())
+    case service.ErrTwoFactorNotPending:
+        util.WriteError(w, r, http.StatusConflict, util.CodeConflict, err.Error())
+    case service.ErrTwoFactorEnforced:
+        util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, err.Error())
+    default:
+        util.InternalError(w, r, err)
+    }
+}
+
+// AuthTwoFactorEnable confirms enrollment; recovery codes are shown once.
+func AuthTwoFactorEnable(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    code, ok := readCode(w, r)
+    if !ok { return }
+    codes, err := service.ConfirmTwoFactorSetup(s.Username, code)
+    if err != nil { service.Audit(r, "auth.2fa.enable", s.Username, model.AuditFailure, nil); twoFactorError(w, r, err); return }
+    service.Audit(r, "auth.2fa.enable", s.Username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "recovery_codes": codes})
+}
+
+func AuthTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    code, ok := readCode(w, r)
+    if !ok { return }
+    if err := service.DisableTwoFactor(s.Username, s.Role, code); err != nil { service.Audit(r, "auth.2fa.disable", s.Username, model.AuditFailure, nil); twoFactorError(w, r, err); return }
+    service.Audit(r, "auth.2fa.disable", s.Username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
+
+func AuthTwoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    code, ok := readCode(w, r)
+    if !ok { return }
+    codes, err := service.RegenerateRecoveryCodes(s.Username, code)
+    if err != nil { service.Audit(r, "auth.2fa.recovery_codes", s.Username, model.AuditFailure, nil); twoFactorError(w, r, err); return }
+    service.Audit(r, "auth.2fa.recovery_codes", s.Username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "recovery_codes": codes})
+}
+
+// AdminSecurityGet reports whether 2FA is mandatory for the admin role.
+func AdminSecurityGet(w http.ResponseWriter, r *http.Request) {
+    util.WriteJSON(w, map[string]interface{}{"require_admin_2fa": service.AdminTwoFactorRequired()})
+}
+
+// AdminSecuritySet toggles mandatory 2FA for the admin role.
+func AdminSecuritySet(w http.ResponseWriter, r *http.Request) {
+    s, _ := service.GetSession(r)
+    var in struct{ RequireAdmin2FA bool `json:"require_admin_2fa"` }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    if err := service.SetAdminTwoFactorRequired(s.Username, in.RequireAdmin2FA); err != nil { util.WriteError(w, r, http.StatusConflict, util.CodeConflict, err.Error()); return }
+    service.Audit(r, "admin.security", "require_admin_2fa", model.AuditSuccess, map[string]interface{}{"require_admin_2fa": in.RequireAdmin2FA})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "require_admin_2fa": in.RequireAdmin2FA})
+}
+
+// AdminUsersReset2FA removes a user's enrollment, e.g. after a lost device.
+func AdminUsersReset2FA(w http.ResponseWriter, r *http.Request) {
+    var in struct{ Username string }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
+    in.Username = strings.TrimSpace(in.Username)
+    if in.Username == "dreamstartooo" && service.AdminTwoFactorRequired() { util.BadRequest(w, r, "admin 2fa is enforced"); return }
+    if err := service.RemoveTwoFactor(in.Username); err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "admin.user.reset_2fa", in.Username, model.AuditSuccess, nil)
+    util.WriteJSON(w, map[string]interface{}{"ok": true})
+}
\ No newline at end of file
@@ -2,22 +2,31 @@ package handlers
 
 import (
     "archive/zip"
+    "crypto/sha256"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
+    "mime"
+    "mime/multipart"
     "net/http"
     "os"
     "path/filepath"
     "strconv"
     "strings"
+    "sync"
     "time"
+    "winchannel/internal/atrest"
+    "winchannel/internal/config"
+    "winchannel/internal/metrics"
+    "winchannel/internal/model"
     "winchannel/internal/paths"
     "winchannel/internal/service"
     "winchannel/internal/util"
 )
 
 func ListUploads(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
     type item struct {
         ID         string `json:"id"`
         FileCount  int    `json:"file_count"`
@@ -33,7 +42,7 @@ func ListUploads(w http.ResponseWriter, r *http.Request) {
         var size int64
         filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
             if err != nil { return nil }
-            if !info.IsDir() { count++; size += info.Size() }
+            if !info.IsDir() { count++; size += atrest.PlainInfo(path, info).Size() }
             return nil
         })
         fi, _ := os.Stat(dirPath)
@@ -43,50 +52,209 @@ func ListUploads(w http.ResponseWriter, r *http.Request) {
     util.WriteJSON(w, map[string]interface{}{"uploads": items})
 }
 
-func HandleUpload(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
-    maxMB, _ := strconv.Atoi(util.GetenvDefault("MAX_UPLOAD_SIZE_MB", "512"))
+// partialPrefix marks in-flight temp files inside an upload directory.
+const partialPrefix = ".partial-"
+
+// commitMu serialises the check-then-rename step so two requests merging into
+// the same upload cannot both decide a name is free.
+var commitMu sync.Mutex
+
+// parseUploadForm applies max_upload_size_mb and parses the multipart body,
+// answering 413 when the limit is exceeded.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+    maxMB := config.Get().MaxUploadSizeMB
     r.Body = http.MaxBytesReader(w, r.Body, int64(maxMB)*1024*1024)
     if err := r.ParseMultipartForm(int64(maxMB) * 1024 * 1024); err != nil {
-        http.Error(w, fmt.Sprintf("parse form: %v", err), http.StatusBadRequest)
-        return
+        var tooLarge *http.MaxBytesError
+        if errors.As(err, &tooLarge) {
+            util.WriteErrorDetails(w, r, http.StatusRequestEntityTooLarge, util.CodePayloadTooLarge, "upload exceeds size limit", map[string]int{"max_upload_size_mb": maxMB})
+            return false
+        }
+        util.WriteErrorDetails(w, r, http.StatusBadRequest, util.CodeBadRequest, "invalid multipart form", err.Error())
+        return false
+    }
+    return true
+}
+
+func mergeModeFromRequest(r *http.Request) (string, bool) {
+    mode := strings.TrimSpace(r.FormValue("mode"))
+    if mode == "" { return model.MergeOverwrite, true }
+    return mode, model.ValidMergeMode(mode)
+}
+
+// uploadFilename returns the client supplied relative path of a multipart file.
+// mime/multipart strips directories from FileHeader.Filename, which would
+// flatten folder uploads, so the raw Content-Disposition is consulted first.
+func uploadFilename(fh *multipart.FileHeader) string {
+    name := fh.Filename
+    if _, params, err := mime.ParseMediaType(fh.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+        name = params["filename"]
+    }
+    return strings.ReplaceAll(name, "\\", "/")
+}
+
+// keepBothName returns "name (n).ext" for the first n that does not exist yet.
+func keepBothName(target string) string {
+    ext := filepath.Ext(target)
+    base := strings.TrimSuffix(target, ext)
+    for i := 1; ; i++ {
+        cand := fmt.Sprintf("%s (%d)%s", base, i, ext)
+        if _, err := os.Stat(cand); os.IsNotExist(err) { return cand }
+    }
+}
+
+// copySealed streams src into f, encrypted when encryption at rest is on, and
+// closes f.
+func copySealed(f *os.File, src io.Reader) (int64, error) {
+    enc, err := atrest.NewWriter(f)
+    var n int64
+    if err == nil { n, err = io.Copy(enc, src) }
+    if err == nil { err = enc.Close() }
+    if cerr := f.Close(); err == nil { err = cerr }
+    return n, err
+}
+
+// saveUploadFile writes src to rel under destRoot according to mode. The data
+// is streamed into a temp file first so a rejected or identical file never
+// touches the existing copy.
+func saveUploadFile(destRoot, rel string, src io.Reader, mode string) model.UploadFileResult {
+    res := model.UploadFileResult{Name: filepath.ToSlash(rel)}
+    target := filepath.Join(destRoot, filepath.FromSlash(rel))
+    if !util.IsSafePath(destRoot, target) || target == filepath.Clean(destRoot) {
+        res.Status = model.FileRejected; res.Error = "invalid_path"; return res
+    }
+    if strings.HasPrefix(filepath.Base(target), partialPrefix) {
+        res.Status = model.FileRejected; res.Error = "reserved_name"; return res
+    }
+    if mode == model.MergeAppend {
+        if _, err := os.Stat(target); err == nil { res.Status = model.FileRejected; res.Error = "exists"; return res }
+    }
+    if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil { res.Status = model.FileFailed; res.Error = err.Error(); return res }
+    tmp, err := os.CreateTemp(filepath.Dir(target), partialPrefix+"*")
+    if err != nil { res.Status = model.FileFailed; res.Error = err.Error(); return res }
+    h := sha256.New()
+    n, err := copySealed(tmp, io.TeeReader(src, h))
+    if err != nil { os.Remove(tmp.Name()); res.Status = model.FileFailed; res.Error = err.Error(); return res }
+    res.SizeBytes = n
+    res.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+    commitMu.Lock()
+    defer commitMu.Unlock()
+    res.Status = model.FileCreated
+    if fi, err := os.Stat(target); err == nil {
+        if fi.IsDir() { os.Remove(tmp.Name()); res.Status = model.FileRejected; res.Error = "is_directory"; return res }
+        switch mode {
+        case model.MergeAppend:
+            os.Remove(tmp.Name()); res.Status = model.FileRejected; res.Error = "exists"; return res
+        case model.MergeKeepBoth:
+            target = keepBothName(target)
+            res.Status = model.FileRenamed
+        case model.MergeSkipIdentical:
+            if sum, err := service.FileHash(target, fi); err == nil && sum == res.SHA256 {
+                os.Remove(tmp.Name()); res.Status = model.FileSkipped; return res
+            }
+            res.Status = model.FileOverwritten
+        default:
+            res.Status = model.FileOverwritten
+        }
+    }
+    if err := os.Rename(tmp.Name(), target); err != nil {
+        os.Remove(tmp.Name()); res.Status = model.FileFailed; res.Error = err.Error(); return res
     }
+    service.SetFileEnvelope(target, nil)
+    service.ForgetHash(target)
+    if fi, err := os.Stat(target); err == nil { service.NoteUpload(target, fi) }
+    rel, _ = filepath.Rel(destRoot, target)
+    res.SavedAs = filepath.ToSlash(rel)
+    return res
+}
+
+// summarizeResults counts files that ended up on disk and the bytes they hold.
+func summarizeResults(results []model.UploadFileResult) (saved, skipped, rejected int, size int64) {
+    for _, res := range results {
+        switch res.Status {
+        case model.FileCreated, model.FileOverwritten, model.FileRenamed:
+            saved++; size += res.SizeBytes
+        case model.FileSkipped:
+            skipped++
+        default:
+            rejected++
+        }
+    }
+    return
+}
+
+// uploadEnvelopes reads the optional "envelopes" form field: a JSON object
+// mapping file names as sent to the envelopes of client-side encrypted files.
+func uploadEnvelopes(r *http.Request) (map[string]*model.Envelope, error) {
+    envs := map[string]*model.Envelope{}
+    v := r.FormValue("envelopes")
+    if v == "" { return envs, nil }
+    if err := json.Unmarshal([]byte(v), &envs); err != nil { return nil, fmt.Errorf("envelopes: %v", err) }
+    for name, e := range envs {
+        if e == nil { delete(envs, name); continue }
+        if err := service.ValidateEnvelope(e); err != nil { return nil, fmt.Errorf("%s: %v", name, err) }
+    }
+    return envs, nil
+}
+
+// uploadDir returns the directory of upload id, or false when id is empty or
+// could resolve to the uploads root or outside it.
+func uploadDir(id string) (string, bool) {
+    if id == "" || strings.ContainsAny(id, "/\\") || strings.Contains(id, "..") { return "", false }
+    root := filepath.Join(paths.UploadsDir, id)
+    if !util.IsSafePath(paths.UploadsDir, root) || root == filepath.Clean(paths.UploadsDir) { return "", false }
+    return root, true
+}
+
+func HandleUpload(w http.ResponseWriter, r *http.Request) {
+    if !parseUploadForm(w, r) { return }
+    mode, ok := mergeModeFromRequest(r)
+    if !ok { util.BadRequest(w, r, "invalid mode"); return }
+    envs, err := uploadEnvelopes(r)
+    if err != nil { util.BadRequest(w, r, err.Error()); return }
     uploadID := r.FormValue("upload_id")
     if uploadID == "" { uploadID = fmt.Sprintf("upload-%d", util.NowTs()) }
-    destRoot := filepath.Join(paths.UploadsDir, uploadID)
-    if err := os.MkdirAll(destRoot, 0755); err != nil { http.Error(w, err.Error(), 500); return }
+    destRoot, ok := uploadDir(uploadID)
+    if !ok { util.BadRequest(w, r, "invalid upload_id"); return }
+    if err := os.MkdirAll(destRoot, 0755); err != nil { util.InternalError(w, r, err); return }
     files := r.MultipartForm.File["files"]
-    var saved int
-    var bytesSaved int64
+    results := make([]model.UploadFileResult, 0, len(files))
     for _, fh := range files {
-        rel := fh.Filename
-        rel = filepath.FromSlash(rel)
-        target := filepath.Join(destRoot, rel)
-        if !util.IsSafePath(destRoot, target) { continue }
-        if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil { continue }
-        src, err := fh.Open(); if err != nil { continue }
-        defer src.Close()
-        out, err := os.Create(target); if err != nil { continue }
-        n, _ := io.Copy(out, src)
-        out.Close()
-        bytesSaved += n; saved++
+        src, err := fh.Open()
+        if err != nil {
+            results = append(results, model.UploadFileResult{Name: uploadFilename(fh), Status: model.FileFailed, Error: err.Error()})
+            continue
+        }
+        res := saveUploadFile(destRoot, uploadFilename(fh), src, mode)
+        src.Close()
+        if e := envs[uploadFilename(fh)]; e != nil && res.SavedAs != "" {
+            service.SetFileEnvelope(filepath.Join(destRoot, filepath.FromSlash(res.SavedAs)), e)
+            res.Encrypted = true
+        }
+        results = append(results, res)
     }
-    util.WriteJSON(w, map[string]interface{}{"ok": true, "upload_id": uploadID, "saved_files": saved, "size_bytes": bytesSaved})
+    saved, skipped, rejected, bytesSaved := summarizeResults(results)
+    metrics.UploadBytes.Add(bytesSaved)
+    service.Audit(r, "upload.files", uploadID, model.AuditSuccess, map[string]interface{}{"mode": mode, "saved": saved, "skipped": skipped, "rejected": rejected, "bytes": bytesSaved})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "upload_id": uploadID, "mode": mode, "saved_files": saved, "skipped_files": skipped, "rejected_files": rejected, "size_bytes": bytesSaved, "files": results})
 }
 
 func HandleDownload(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
     prefix := "/api/download/"
     uploadID := strings.TrimPrefix(r.URL.Path, prefix)
-    if uploadID == "" { http.NotFound(w, r); return }
+    if uploadID == "" { util.NotFound(w, r, "upload not found"); return }
     dirPath := filepath.Join(paths.UploadsDir, uploadID)
+    if !util.IsSafePath(paths.UploadsDir, dirPath) { util.BadRequest(w, r, "invalid upload id"); return }
     if fi, err := os.Stat(dirPath); err != nil || !fi.IsDir() {
-        util.WriteJSON(w, map[string]string{"error": "not_found"}); return
+        util.NotFound(w, r, "upload not found"); return
     }
+    if rel := r.URL.Query().Get("path"); rel != "" { downloadFile(w, r, dirPath, rel); return }
     w.Header().Set("Content-Type", "application/zip")
     w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", uploadID))
-    zw := zip.NewWriter(w)
-    defer zw.Close()
+    cw := &countingWriter{w: w}
+    zw := zip.NewWriter(cw)
+    defer func() { zw.Close(); metrics.DownloadBytes.Add(cw.n) }()
     filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
         if err != nil { return nil }
         if info.IsDir() { return nil }
@@ -95,78 +263,124 @@ func HandleDownload(w http.ResponseWriter, r *http.Request) {
         hdr := &zip.FileHeader{Name: rel, Method: zip.Deflate}
         hdr.SetModTime(info.ModTime())
         writer, err := zw.CreateHeader(hdr); if err != nil { return nil }
-        f, err := os.Open(path); if err != nil { return nil }
+        f, err := atrest.Open(path); if err != nil { return nil }
         defer f.Close()
         io.Copy(writer, f)
         return nil
     })
 }
 
-func safeExtractZip(zr *zip.Reader, destRoot string, maxFiles int) (int, int64) {
-    var count int
-    var total int64
+// EnvelopeHeader carries the envelope of a client-side encrypted file on
+// single-file downloads.
+const EnvelopeHeader = "X-WinChannel-Envelope"
+
+// downloadFile sends a single file of an upload as-is (GET
+// /api/download/{id}?path=a/b.txt), as referenced by file transfers.
+// Files are always sent as attachments, never for inline display.
+func downloadFile(w http.ResponseWriter, r *http.Request, dirPath, rel string) {
+    filePath := filepath.Join(dirPath, filepath.FromSlash(rel))
+    if !util.IsSafePath(dirPath, filePath) { util.BadRequest(w, r, "invalid path"); return }
+    f, err := atrest.Open(filePath)
+    if os.IsNotExist(err) { util.NotFound(w, r, "file not found"); return }
+    if err != nil { util.InternalError(w, r, err); return }
+    defer f.Close()
+    fi, err := f.Stat()
+    if err != nil || !fi.Mode().IsRegular() { util.NotFound(w, r, "file not found"); return }
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(filePath)}))
+    if e, ok := service.FileEnvelope(filePath); ok {
+        b, _ := json.Marshal(e)
+        w.Header().Set(EnvelopeHeader, string(b))
+    }
+    w.Header().Set("Content-Length", strconv.FormatInt(f.Size(), 10))
+    cw := &countingWriter{w: w}
+    io.Copy(cw, f)
+    metrics.DownloadBytes.Add(cw.n)
+}
+
+// countingWriter counts bytes written through it.
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+    n, err := c.w.Write(p)
+    c.n += int64(n)
+    return n, err
+}
+
+func safeExtractZip(zr *zip.Reader, destRoot string, maxFiles int, mode string) []model.UploadFileResult {
+    var results []model.UploadFileResult
     for _, f := range zr.File {
         name := f.Name
         if name == "" || strings.HasSuffix(name, "/") { continue }
-        target := filepath.Join(destRoot, filepath.FromSlash(name))
-        if !util.IsSafePath(destRoot, target) { continue }
-        if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil { continue }
-        rc, err := f.Open(); if err != nil { continue }
-        out, err := os.Create(target); if err != nil { rc.Close(); continue }
-        n, _ := io.Copy(out, rc)
-        out.Close(); rc.Close()
-        total += n; count++
-        if count > maxFiles { break }
+        if len(results) >= maxFiles { break }
+        rc, err := f.Open()
+        if err != nil {
+            results = append(results, model.UploadFileResult{Name: name, Status: model.FileFailed, Error: err.Error()})
+            continue
+        }
+        results = append(results, saveUploadFile(destRoot, name, rc, mode))
+        rc.Close()
     }
-    return count, total
+    return results
 }
 
 func HandleUploadZip(w http.ResponseWriter, r *http.Request) {
-    if !service.RequireAuth(w, r) { return }
-    maxMB, _ := strconv.Atoi(util.GetenvDefault("MAX_UPLOAD_SIZE_MB", "512"))
-    r.Body = http.MaxBytesReader(w, r.Body, int64(maxMB)*1024*1024)
-    if err := r.ParseMultipartForm(int64(maxMB) * 1024 * 1024); err != nil { http.Error(w, fmt.Sprintf("parse form: %v", err), 400); return }
+    if !parseUploadForm(w, r) { return }
+    mode, ok := mergeModeFromRequest(r)
+    if !ok { util.BadRequest(w, r, "invalid mode"); return }
     uploadID := r.FormValue("upload_id")
     if uploadID == "" { uploadID = fmt.Sprintf("zip-%d", util.NowTs()) }
-    destRoot := filepath.Join(paths.UploadsDir, uploadID)
-    if err := os.MkdirAll(destRoot, 0755); err != nil { http.Error(w, err.Error(), 500); return }
+    destRoot, ok := uploadDir(uploadID)
+    if !ok { util.BadRequest(w, r, "invalid upload_id"); return }
+    if err := os.MkdirAll(destRoot, 0755); err != nil { util.InternalError(w, r, err); return }
     fh := r.MultipartForm.File["zip_file"]
-    if len(fh) == 0 { util.WriteJSON(w, map[string]interface{}{"ok": false, "error": "zip_file_missing"}); return }
+    if len(fh) == 0 { util.WriteError(w, r, http.StatusBadRequest, "zip_file_missing", "zip_file field is required"); return }
     file := fh[0]
-    zipPath := filepath.Join(destRoot, fmt.Sprintf("%s.zip", uploadID))
-    src, err := file.Open(); if err != nil { http.Error(w, err.Error(), 500); return }
-    out, err := os.Create(zipPath); if err != nil { src.Close(); http.Error(w, err.Error(), 500); return }
-    n, _ := io.Copy(out, src)
-    out.Close(); src.Close()
-    fi, err := os.Stat(zipPath); if err != nil { http.Error(w, err.Error(), 500); return }
-    zr, err := zip.OpenReader(zipPath); if err != nil { http.Error(w, "bad_zip", 400); return }
-    defer zr.Close()
-    extracted, total := safeExtractZip(&zr.Reader, destRoot, 20000)
-    _ = n; _ = fi
-    util.WriteJSON(w, map[string]interface{}{"ok": true, "upload_id": uploadID, "saved_files": extracted, "size_bytes": total, "zip_path": strings.ReplaceAll(zipPath, "\\", "/")})
+    // Read the archive from the multipart copy: the stored one may be
+    // encrypted and zip needs random access.
+    src, err := file.Open(); if err != nil { util.InternalError(w, r, err); return }
+    defer src.Close()
+    zr, err := zip.NewReader(src, file.Size); if err != nil { util.WriteError(w, r, http.StatusBadRequest, "invalid_zip", "file is not a valid zip archive"); return }
+    // The archive is kept as <upload_id>.zip under the same merge mode as
+    // its members, and stored before them so a member of that name follows
+    // the mode too.
+    archive := saveUploadFile(destRoot, uploadID+".zip", io.NewSectionReader(src, 0, file.Size), mode)
+    if archive.Status == model.FileFailed { util.InternalError(w, r, errors.New(archive.Error)); return }
+    results := append([]model.UploadFileResult{archive}, safeExtractZip(zr, destRoot, 20000, mode)...)
+    kept, zipPath := archive.SavedAs, ""
+    if archive.Status == model.FileSkipped { kept = archive.Name }
+    if kept != "" { zipPath = filepath.ToSlash(filepath.Join(destRoot, filepath.FromSlash(kept))) }
+    extracted, skipped, rejected, total := summarizeResults(results)
+    metrics.UploadBytes.Add(total)
+    service.Audit(r, "upload.zip", uploadID, model.AuditSuccess, map[string]interface{}{"mode": mode, "saved": extracted, "skipped": skipped, "rejected": rejected, "bytes": total})
+    util.WriteJSON(w, map[string]interface{}{"ok": true, "upload_id": uploadID, "mode": mode, "saved_files": extracted, "skipped_files": skipped, "rejected_files": rejected, "size_bytes": total, "files": results, "zip_path": zipPath})
 }
 
 func AdminUploadDelete(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodDelete { http.Error(w, "method not allowed", 405); return }
     uploadID := strings.TrimPrefix(r.URL.Path, "/api/admin/upload/")
-    if uploadID == "" { http.Error(w, "missing upload id", 400); return }
-    target := filepath.Join(paths.UploadsDir, uploadID)
-    if !util.IsSafePath(paths.UploadsDir, target) { http.Error(w, "invalid path", 400); return }
-    if err := os.RemoveAll(target); err != nil { http.Error(w, "delete error", 500); return }
+    if uploadID == "" { util.BadRequest(w, r, "missing upload id"); return }
+    target, ok := uploadDir(uploadID)
+    if !ok { util.BadRequest(w, r, "invalid upload id"); return }
+    if err := os.RemoveAll(target); err != nil { util.InternalError(w, r, err); return }
+    service.DropEnvelopes(target)
+    service.ForgetHashes(target)
+    service.Audit(r, "upload.delete", uploadID, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
 }
 
 func AdminFolderCreate(w http.ResponseWriter, r *http.Request) {
-    if !service.IsAdmin(r) { http.Error(w, "admin required", 401); return }
-    if r.Method != http.MethodPost { http.Error(w, "method not allowed", 405); return }
     var in struct{ Name string `json:"name"` }
-    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { http.Error(w, "bad json", 400); return }
+    if err := json.NewDecoder(r.Body).Decode(&in); err != nil { util.BadJSON(w, r, err); return }
     in.Name = strings.TrimSpace(in.Name)
-    if in.Name == "" { http.Error(w, "empty name", 400); return }
-    if strings.Contains(in.Name, "..") || strings.ContainsAny(in.Name, "/\\") { http.Error(w, "invalid name", 400); return }
+    if in.Name == "" { util.BadRequest(w, r, "empty name"); return }
+    if strings.Contains(in.Name, "..") || strings.ContainsAny(in.Name, "/\\") { util.BadRequest(w, r, "invalid name"); return }
     target := filepath.Join(paths.UploadsDir, in.Name)
-    if !util.IsSafePath(paths.UploadsDir, target) { http.Error(w, "invalid path", 400); return }
-    if err := os.MkdirAll(target, 0755); err != nil { http.Error(w, "mkdir error", 500); return }
+    if !util.IsSafePath(paths.UploadsDir, target) { util.BadRequest(w, r, "invalid path"); return }
+    if err := os.MkdirAll(target, 0755); err != nil { util.InternalError(w, r, err); return }
+    service.Audit(r, "upload.folder_create", in.Name, model.AuditSuccess, nil)
     util.WriteJSON(w, map[string]interface{}{"ok": true})
 }
\ No newline at end of file
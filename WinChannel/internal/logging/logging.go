@@ -0,0 +1,87 @@
+// Package logging configures the process-wide slog logger.
+package logging
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "log/slog"
+    "os"
+    "path/filepath"
+    "strings"
+    "winchannel/internal/config"
+    "winchannel/internal/paths"
+)
+
+// Options controls the default logger. File is relative to paths.StorageDir
+// unless absolute; empty means stderr only.
+type Options struct {
+    Level      string // debug, info, warn, error
+    Format     string // text or json
+    File       string
+    MaxSizeMB  int
+    MaxBackups int
+}
+
+// OptionsFrom takes the log settings from the server configuration.
+func OptionsFrom(c config.Log) Options {
+    return Options{Level: c.Level, Format: c.Format, File: c.File, MaxSizeMB: c.MaxSizeMB, MaxBackups: c.MaxBackups}
+}
+
+// level is shared by the installed handler so it can change without a
+// restart.
+var level slog.LevelVar
+
+// SetLevel changes the minimum level of the default logger.
+func SetLevel(s string) error {
+    l, err := parseLevel(s)
+    if err != nil { return err }
+    level.Set(l)
+    return nil
+}
+
+func parseLevel(s string) (slog.Level, error) {
+    switch strings.ToLower(s) {
+    case "debug":
+        return slog.LevelDebug, nil
+    case "", "info":
+        return slog.LevelInfo, nil
+    case "warn", "warning":
+        return slog.LevelWarn, nil
+    case "error":
+        return slog.LevelError, nil
+    }
+    return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Setup installs the default slog logger (which the standard log package
+// also writes through) and returns a closer for the log file, if any.
+func Setup(o Options) (io.Closer, error) {
+    if err := SetLevel(o.Level); err != nil { return nil, err }
+
+    var out io.Writer = os.Stderr
+    var closer io.Closer = io.NopCloser(nil)
+    if o.File != "" {
+        p := o.File
+        if !filepath.IsAbs(p) { p = filepath.Join(paths.StorageDir, p) }
+        rf, err := openRotating(p, int64(o.MaxSizeMB)*1024*1024, o.MaxBackups)
+        if err != nil { return nil, err }
+        out = io.MultiWriter(os.Stderr, rf)
+        closer = rf
+    }
+
+    hopts := &slog.HandlerOptions{Level: &level}
+    var h slog.Handler
+    switch strings.ToLower(o.Format) {
+    case "", "text":
+        h = slog.NewTextHandler(out, hopts)
+    case "json":
+        h = slog.NewJSONHandler(out, hopts)
+    default:
+        closer.Close()
+        return nil, fmt.Errorf("unknown log format %q", o.Format)
+    }
+    slog.SetDefault(slog.New(h))
+    log.SetFlags(0)
+    return closer, nil
+}
\ No newline at end of file
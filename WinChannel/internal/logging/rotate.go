@@ -0,0 +1,87 @@
+package logging
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+)
+
+// rotatingFile is an append-only log file that is renamed to name.1, name.2,
+// ... once it grows past max bytes. Only backups copies are kept.
+type rotatingFile struct {
+    mu      sync.Mutex
+    path    string
+    max     int64
+    backups int
+    f       *os.File
+    size    int64
+    closed  bool
+}
+
+func openRotating(path string, max int64, backups int) (*rotatingFile, error) {
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { return nil, err }
+    rf := &rotatingFile{path: path, max: max, backups: backups}
+    if err := rf.open(); err != nil { return nil, err }
+    return rf, nil
+}
+
+func (rf *rotatingFile) open() error {
+    f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+    if err != nil { return err }
+    fi, err := f.Stat()
+    if err != nil { f.Close(); return err }
+    rf.f, rf.size = f, fi.Size()
+    return nil
+}
+
+// rotate moves the current file aside and starts a new one. The file is
+// reopened whatever happens, so when it cannot be moved (on Windows another
+// process may hold it open) logging carries on appending to it and rotation
+// is tried again once another max bytes have been written.
+func (rf *rotatingFile) rotate() error {
+    rf.f.Close()
+    rf.f = nil
+    var err error
+    if rf.backups <= 0 {
+        if err = os.Remove(rf.path); os.IsNotExist(err) { err = nil }
+    } else {
+        _ = os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.backups))
+        for i := rf.backups - 1; i >= 1; i-- {
+            _ = os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+        }
+        if err = os.Rename(rf.path, rf.path+".1"); os.IsNotExist(err) { err = nil }
+    }
+    if oerr := rf.open(); oerr != nil { return oerr }
+    if err != nil { rf.size = 0 }
+    return err
+}
+
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    if rf.closed { return 0, os.ErrClosed }
+    if rf.f == nil {
+        // a previous rotation could not reopen the file
+        if err := rf.open(); err != nil { return 0, err }
+    }
+    if rf.max > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.max {
+        if err := rf.rotate(); err != nil {
+            fmt.Fprintf(os.Stderr, "log rotation: %v\n", err)
+            if rf.f == nil { return 0, err }
+        }
+    }
+    n, err := rf.f.Write(p)
+    rf.size += int64(n)
+    return n, err
+}
+
+func (rf *rotatingFile) Close() error {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    rf.closed = true
+    if rf.f == nil { return nil }
+    err := rf.f.Close()
+    rf.f = nil
+    return err
+}
\ No newline at end of file
@@ -0,0 +1,36 @@
+package logging
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestRotate(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "app.log")
+    rf, err := openRotating(path, 10, 2)
+    if err != nil { t.Fatal(err) }
+    defer rf.Close()
+    for _, l := range []string{"one line\n", "two line\n", "three ln\n"} {
+        if _, err := rf.Write([]byte(l)); err != nil { t.Fatal(err) }
+    }
+    for name, want := range map[string]string{path: "three ln\n", path + ".1": "two line\n", path + ".2": "one line\n"} {
+        if b, _ := os.ReadFile(name); string(b) != want { t.Errorf("%s = %q, want %q", filepath.Base(name), b, want) }
+    }
+}
+
+// TestRotateRenameFails keeps appending to the current file when it cannot be
+// moved aside, here because a non-empty directory sits where the backup goes.
+func TestRotateRenameFails(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "app.log")
+    if err := os.MkdirAll(filepath.Join(path+".1", "x"), 0755); err != nil { t.Fatal(err) }
+    rf, err := openRotating(path, 10, 1)
+    if err != nil { t.Fatal(err) }
+    defer rf.Close()
+    lines := []string{"one line\n", "two line\n", "three ln\n"}
+    for _, l := range lines {
+        if _, err := rf.Write([]byte(l)); err != nil { t.Fatalf("write after failed rotation: %v", err) }
+    }
+    if b, _ := os.ReadFile(path); string(b) != strings.Join(lines, "") { t.Fatalf("log = %q", b) }
+}
\ No newline at end of file
@@ -0,0 +1,212 @@
+// Package mdns implements the small part of multicast DNS (RFC 6762) and
+// DNS-based service discovery (RFC 6763) WinChannel needs: answering PTR,
+// SRV, TXT, A and AAAA queries for its own service, and browsing for others.
+package mdns
+
+import (
+    "encoding/binary"
+    "errors"
+    "net"
+    "strings"
+)
+
+const (
+    TypeA    uint16 = 1
+    TypePTR  uint16 = 12
+    TypeTXT  uint16 = 16
+    TypeAAAA uint16 = 28
+    TypeSRV  uint16 = 33
+    TypeANY  uint16 = 255
+
+    ClassIN uint16 = 1
+    // cacheFlush (in answers) and unicastResponse (in questions) share the
+    // top bit of the class field.
+    cacheFlush      uint16 = 0x8000
+    unicastResponse uint16 = 0x8000
+
+    Port = 5353
+)
+
+// Group is the IPv4 mDNS multicast address.
+var Group = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: Port}
+
+type Question struct {
+    Name  string
+    Type  uint16
+    Class uint16
+}
+
+// Record is a resource record with its data decoded for the types we use.
+type Record struct {
+    Name   string
+    Type   uint16
+    Class  uint16
+    TTL    uint32
+    Target string   // PTR, SRV
+    Port   uint16   // SRV
+    Text   []string // TXT
+    IP     net.IP   // A, AAAA
+}
+
+type Message struct {
+    ID        uint16
+    Response  bool
+    Questions []Question
+    Answers   []Record
+    Extras    []Record // additional section
+}
+
+var errShort = errors.New("mdns: short message")
+
+// Fqdn lower-cases name and makes sure it ends with a dot.
+func Fqdn(name string) string {
+    name = strings.ToLower(name)
+    if !strings.HasSuffix(name, ".") { name += "." }
+    return name
+}
+
+func appendName(b []byte, name string) []byte {
+    for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+        if l == "" { continue }
+        if len(l) > 63 { l = l[:63] }
+        b = append(b, byte(len(l)))
+        b = append(b, l...)
+    }
+    return append(b, 0)
+}
+
+func appendRecord(b []byte, r Record) []byte {
+    b = appendName(b, r.Name)
+    b = binary.BigEndian.AppendUint16(b, r.Type)
+    b = binary.BigEndian.AppendUint16(b, r.Class)
+    b = binary.BigEndian.AppendUint32(b, r.TTL)
+    var data []byte
+    switch r.Type {
+    case TypePTR:
+        data = appendName(nil, r.Target)
+    case TypeSRV:
+        data = binary.BigEndian.AppendUint16(data, 0) // priority
+        data = binary.BigEndian.AppendUint16(data, 0) // weight
+        data = binary.BigEndian.AppendUint16(data, r.Port)
+        data = appendName(data, r.Target)
+    case TypeTXT:
+        for _, t := range r.Text {
+            if len(t) > 255 { t = t[:255] }
+            data = append(data, byte(len(t)))
+            data = append(data, t...)
+        }
+        if len(data) == 0 { data = []byte{0} }
+    case TypeA:
+        data = r.IP.To4()
+    case TypeAAAA:
+        data = r.IP.To16()
+    }
+    b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+    return append(b, data...)
+}
+
+// Pack encodes m without name compression.
+func (m *Message) Pack() []byte {
+    b := make([]byte, 12, 512)
+    binary.BigEndian.PutUint16(b[0:], m.ID)
+    if m.Response { binary.BigEndian.PutUint16(b[2:], 0x8400) } // QR + AA
+    binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+    binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+    binary.BigEndian.PutUint16(b[10:], uint16(len(m.Extras)))
+    for _, q := range m.Questions {
+        b = appendName(b, q.Name)
+        b = binary.BigEndian.AppendUint16(b, q.Type)
+        b = binary.BigEndian.AppendUint16(b, q.Class)
+    }
+    for _, r := range m.Answers { b = appendRecord(b, r) }
+    for _, r := range m.Extras { b = appendRecord(b, r) }
+    return b
+}
+
+// readName decodes a possibly compressed name starting at off and returns
+// it with the offset just past it.
+func readName(msg []byte, off int) (string, int, error) {
+    var labels []string
+    end := -1
+    for hops := 0; ; hops++ {
+        if off >= len(msg) || hops > 64 { return "", 0, errShort }
+        l := int(msg[off])
+        switch {
+        case l == 0:
+            if end < 0 { end = off + 1 }
+            return strings.Join(labels, ".") + ".", end, nil
+        case l&0xC0 == 0xC0:
+            if off+1 >= len(msg) { return "", 0, errShort }
+            if end < 0 { end = off + 2 }
+            off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+        default:
+            if off+1+l > len(msg) { return "", 0, errShort }
+            labels = append(labels, string(msg[off+1:off+1+l]))
+            off += 1 + l
+        }
+    }
+}
+
+func readRecord(msg []byte, off int) (Record, int, error) {
+    var r Record
+    name, off, err := readName(msg, off)
+    if err != nil { return r, 0, err }
+    if off+10 > len(msg) { return r, 0, errShort }
+    r.Name = name
+    r.Type = binary.BigEndian.Uint16(msg[off:])
+    r.Class = binary.BigEndian.Uint16(msg[off+2:])
+    r.TTL = binary.BigEndian.Uint32(msg[off+4:])
+    n := int(binary.BigEndian.Uint16(msg[off+8:]))
+    off += 10
+    if off+n > len(msg) { return r, 0, errShort }
+    data := msg[off : off+n]
+    switch r.Type {
+    case TypePTR:
+        if r.Target, _, err = readName(msg, off); err != nil { return r, 0, err }
+    case TypeSRV:
+        if n < 7 { return r, 0, errShort }
+        r.Port = binary.BigEndian.Uint16(data[4:])
+        if r.Target, _, err = readName(msg, off+6); err != nil { return r, 0, err }
+    case TypeTXT:
+        for i := 0; i < len(data); {
+            l := int(data[i])
+            if i+1+l > len(data) { break }
+            if l > 0 { r.Text = append(r.Text, string(data[i+1:i+1+l])) }
+            i += 1 + l
+        }
+    case TypeA:
+        if n == 4 { r.IP = net.IP(append([]byte(nil), data...)) }
+    case TypeAAAA:
+        if n == 16 { r.IP = net.IP(append([]byte(nil), data...)) }
+    }
+    return r, off + n, nil
+}
+
+// Unpack decodes a message, keeping the authority section out of the result.
+func Unpack(msg []byte) (*Message, error) {
+    if len(msg) < 12 { return nil, errShort }
+    m := &Message{ID: binary.BigEndian.Uint16(msg), Response: msg[2]&0x80 != 0}
+    qd := int(binary.BigEndian.Uint16(msg[4:]))
+    an := int(binary.BigEndian.Uint16(msg[6:]))
+    ns := int(binary.BigEndian.Uint16(msg[8:]))
+    ar := int(binary.BigEndian.Uint16(msg[10:]))
+    off := 12
+    for i := 0; i < qd; i++ {
+        name, next, err := readName(msg, off)
+        if err != nil || next+4 > len(msg) { return nil, errShort }
+        m.Questions = append(m.Questions, Question{Name: name, Type: binary.BigEndian.Uint16(msg[next:]), Class: binary.BigEndian.Uint16(msg[next+2:])})
+        off = next + 4
+    }
+    for i := 0; i < an+ns+ar; i++ {
+        r, next, err := readRecord(msg, off)
+        if err != nil { return nil, err }
+        off = next
+        switch {
+        case i < an:
+            m.Answers = append(m.Answers, r)
+        case i >= an+ns:
+            m.Extras = append(m.Extras, r)
+        }
+    }
+    return m, nil
+}
\ No newline at end of file
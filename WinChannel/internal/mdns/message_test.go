@@ -0,0 +1,63 @@
+package mdns
+
+import (
+    "net"
+    "reflect"
+    "testing"
+)
+
+func TestPackUnpackRoundTrip(t *testing.T) {
+    m := &Message{
+        ID:        0x1234,
+        Response:  true,
+        Questions: []Question{{Name: ServiceWinChannel, Type: TypePTR, Class: ClassIN | unicastResponse}},
+        Answers: []Record{
+            {Name: ServiceWinChannel, Type: TypePTR, Class: ClassIN, TTL: serviceTTL, Target: "desk." + ServiceWinChannel},
+            {Name: "desk." + ServiceWinChannel, Type: TypeSRV, Class: ClassIN | cacheFlush, TTL: hostTTL, Target: "winchannel.local.", Port: 8000},
+        },
+        Extras: []Record{
+            {Name: "desk." + ServiceWinChannel, Type: TypeTXT, Class: ClassIN, TTL: serviceTTL, Text: []string{"path=/", "scheme=https"}},
+            {Name: "winchannel.local.", Type: TypeA, Class: ClassIN, TTL: hostTTL, IP: net.IPv4(192, 168, 1, 20).To4()},
+            {Name: "winchannel.local.", Type: TypeAAAA, Class: ClassIN, TTL: hostTTL, IP: net.ParseIP("fe80::1")},
+        },
+    }
+    got, err := Unpack(m.Pack())
+    if err != nil { t.Fatal(err) }
+    if !reflect.DeepEqual(got, m) { t.Fatalf("round trip:\n got %+v\nwant %+v", got, m) }
+}
+
+// TestUnpackCompressed decodes a hand-built answer whose names point back
+// into the question, the way real responders compress.
+func TestUnpackCompressed(t *testing.T) {
+    msg := []byte{
+        0, 0, 0x84, 0, 0, 1, 0, 1, 0, 0, 0, 0,
+        // question at 12: _http._tcp.local. PTR IN
+        5, '_', 'h', 't', 't', 'p', 4, '_', 't', 'c', 'p', 5, 'l', 'o', 'c', 'a', 'l', 0, 0, 12, 0, 1,
+        // answer: name -> 12, PTR IN, TTL 120, target "box" + pointer -> 12
+        0xC0, 12, 0, 12, 0, 1, 0, 0, 0, 120, 0, 6, 3, 'b', 'o', 'x', 0xC0, 12,
+    }
+    m, err := Unpack(msg)
+    if err != nil { t.Fatal(err) }
+    if len(m.Answers) != 1 { t.Fatalf("answers = %d", len(m.Answers)) }
+    a := m.Answers[0]
+    if a.Name != ServiceHTTP || a.Target != "box."+ServiceHTTP || a.TTL != 120 { t.Fatalf("answer = %+v", a) }
+}
+
+func TestUnpackMalformed(t *testing.T) {
+    valid := (&Message{Response: true, Answers: []Record{{Name: "winchannel.local.", Type: TypeA, Class: ClassIN, TTL: 1, IP: net.IPv4(10, 0, 0, 1)}}}).Pack()
+    header := func(qd, an byte) []byte { return []byte{0, 0, 0x84, 0, 0, qd, 0, an, 0, 0, 0, 0} }
+    cases := map[string][]byte{
+        "empty":            nil,
+        "short header":     valid[:11],
+        "truncated record": valid[:len(valid)-2],
+        "missing record":   append(header(0, 2), valid[12:]...),
+        "label past end":   append(header(1, 0), 10, 'a', 'b'),
+        "pointer past end": append(header(1, 0), 0xC0),
+        "self pointer":     append(header(1, 0), 0xC0, 12, 0, 1, 0, 1),
+        "pointer loop":     append(header(1, 0), 1, 'a', 0xC0, 16, 1, 'b', 0xC0, 12, 0, 1, 0, 1),
+        "short srv":        append(header(0, 1), 0, 0, 33, 0, 1, 0, 0, 0, 1, 0, 2, 0, 0),
+    }
+    for name, msg := range cases {
+        if m, err := Unpack(msg); err == nil { t.Errorf("%s: Unpack = %+v, want an error", name, m) }
+    }
+}
\ No newline at end of file
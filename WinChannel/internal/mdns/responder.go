@@ -0,0 +1,193 @@
+package mdns
+
+import (
+    "log/slog"
+    "net"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    ServiceWinChannel = "_winchannel._tcp.local."
+    ServiceHTTP       = "_http._tcp.local."
+    serviceEnum       = "_services._dns-sd._udp.local."
+
+    hostTTL    = 120
+    serviceTTL = 4500
+)
+
+// Service describes what the responder advertises.
+type Service struct {
+    Instance string   // human readable, e.g. "WinChannel on desk-pc"
+    Host     string   // e.g. "winchannel" for winchannel.local
+    Port     int
+    Text     []string // TXT key=value pairs
+    // Addrs returns the addresses to publish; it is called for every answer
+    // so interface changes are picked up.
+    Addrs func() []net.IP
+}
+
+// Responder answers mDNS queries for one service under both
+// _winchannel._tcp and _http._tcp.
+type Responder struct {
+    svc  Service
+    host string
+    conn *net.UDPConn
+    once sync.Once
+    done chan struct{}
+}
+
+// instanceName joins the instance label to service. Dots would split the
+// label, so they are replaced.
+func instanceName(instance, service string) string {
+    return strings.ReplaceAll(instance, ".", "-") + "." + service
+}
+
+// NewResponder joins the mDNS group on ifi (nil for the system default) and
+// starts answering queries. Close sends goodbye packets and stops it.
+func NewResponder(svc Service, ifi *net.Interface) (*Responder, error) {
+    conn, err := net.ListenMulticastUDP("udp4", ifi, Group)
+    if err != nil { return nil, err }
+    r := &Responder{svc: svc, host: Fqdn(svc.Host + ".local"), conn: conn, done: make(chan struct{})}
+    go r.serve()
+    go r.announce()
+    return r, nil
+}
+
+// Host is the advertised host name, e.g. "winchannel.local.".
+func (r *Responder) Host() string { return r.host }
+
+func (r *Responder) serve() {
+    buf := make([]byte, 9000)
+    for {
+        n, src, err := r.conn.ReadFromUDP(buf)
+        if err != nil {
+            select {
+            case <-r.done:
+                return
+            default:
+            }
+            slog.Debug("mdns read", "err", err)
+            continue
+        }
+        m, err := Unpack(buf[:n])
+        if err != nil || m.Response { continue }
+        resp := r.answer(m.Questions)
+        if resp == nil { continue }
+        // Queries from a port other than 5353 come from simple one-shot
+        // resolvers that expect a classic unicast DNS reply (RFC 6762 6.7).
+        if src.Port != Port {
+            resp.ID = m.ID
+            resp.Questions = m.Questions
+            r.conn.WriteToUDP(resp.Pack(), src)
+            continue
+        }
+        unicast := true
+        for _, q := range m.Questions { if q.Class&unicastResponse == 0 { unicast = false } }
+        if unicast {
+            r.conn.WriteToUDP(resp.Pack(), src)
+        } else {
+            r.conn.WriteToUDP(resp.Pack(), Group)
+        }
+    }
+}
+
+func (r *Responder) records(ttlScale uint32) (ptrs, srvs, txts, addrs []Record) {
+    svcTTL, hTTL := uint32(serviceTTL)*ttlScale, uint32(hostTTL)*ttlScale
+    for _, service := range []string{ServiceWinChannel, ServiceHTTP} {
+        inst := instanceName(r.svc.Instance, service)
+        ptrs = append(ptrs, Record{Name: service, Type: TypePTR, Class: ClassIN, TTL: svcTTL, Target: inst})
+        srvs = append(srvs, Record{Name: inst, Type: TypeSRV, Class: ClassIN | cacheFlush, TTL: hTTL, Target: r.host, Port: uint16(r.svc.Port)})
+        txts = append(txts, Record{Name: inst, Type: TypeTXT, Class: ClassIN | cacheFlush, TTL: svcTTL, Text: r.svc.Text})
+    }
+    ips := r.svc.Addrs()
+    if len(ips) == 0 { ips = []net.IP{net.IPv4(127, 0, 0, 1)} }
+    for _, ip := range ips {
+        if ip.To4() != nil {
+            addrs = append(addrs, Record{Name: r.host, Type: TypeA, Class: ClassIN | cacheFlush, TTL: hTTL, IP: ip})
+        } else {
+            addrs = append(addrs, Record{Name: r.host, Type: TypeAAAA, Class: ClassIN | cacheFlush, TTL: hTTL, IP: ip})
+        }
+    }
+    return
+}
+
+// answer builds the response to qs, or nil when none of them concern us.
+func (r *Responder) answer(qs []Question) *Message {
+    ptrs, srvs, txts, addrs := r.records(1)
+    resp := &Message{Response: true}
+    seen := map[int]bool{}
+    add := func(list *[]Record, rec Record, id int) {
+        if !seen[id] { seen[id] = true; *list = append(*list, rec) }
+    }
+    for _, q := range qs {
+        name := q.Name
+        is := func(n string) bool { return strings.EqualFold(name, n) }
+        want := func(t uint16) bool { return q.Type == t || q.Type == TypeANY }
+        if is(serviceEnum) && want(TypePTR) {
+            for i, p := range ptrs { add(&resp.Answers, Record{Name: serviceEnum, Type: TypePTR, Class: ClassIN, TTL: serviceTTL, Target: p.Name}, 100+i) }
+        }
+        for i := range ptrs {
+            if is(ptrs[i].Name) && want(TypePTR) {
+                add(&resp.Answers, ptrs[i], 200+i)
+                add(&resp.Extras, srvs[i], 300+i)
+                add(&resp.Extras, txts[i], 400+i)
+                for j, a := range addrs { add(&resp.Extras, a, 500+j) }
+            }
+            if is(srvs[i].Name) {
+                if want(TypeSRV) {
+                    add(&resp.Answers, srvs[i], 300+i)
+                    for j, a := range addrs { add(&resp.Extras, a, 500+j) }
+                }
+                if want(TypeTXT) { add(&resp.Answers, txts[i], 400+i) }
+            }
+        }
+        if is(r.host) {
+            for j, a := range addrs {
+                if want(a.Type) { add(&resp.Answers, a, 500+j) }
+            }
+        }
+    }
+    if len(resp.Answers) == 0 { return nil }
+    // a record cannot be in both sections
+    extras := resp.Extras[:0]
+    for _, e := range resp.Extras {
+        dup := false
+        for _, a := range resp.Answers { if a.Name == e.Name && a.Type == e.Type && a.Target == e.Target && a.IP.Equal(e.IP) { dup = true } }
+        if !dup { extras = append(extras, e) }
+    }
+    resp.Extras = extras
+    return resp
+}
+
+func (r *Responder) unsolicited(ttlScale uint32) []byte {
+    ptrs, srvs, txts, addrs := r.records(ttlScale)
+    m := &Message{Response: true}
+    m.Answers = append(append(append(append(m.Answers, ptrs...), srvs...), txts...), addrs...)
+    return m.Pack()
+}
+
+// announce sends the records twice, one second apart, as RFC 6762 8.3
+// asks, so caches pick up the service without having to query.
+func (r *Responder) announce() {
+    for i := 0; i < 2; i++ {
+        r.conn.WriteToUDP(r.unsolicited(1), Group)
+        select {
+        case <-r.done:
+            return
+        case <-time.After(time.Second):
+        }
+    }
+}
+
+// Close announces the records with TTL 0 so peers drop them, then stops.
+func (r *Responder) Close() error {
+    var err error
+    r.once.Do(func() {
+        r.conn.WriteToUDP(r.unsolicited(0), Group)
+        close(r.done)
+        err = r.conn.Close()
+    })
+    return err
+}
\ No newline at end of file
@@ -0,0 +1,181 @@
+// Package metrics keeps process counters and renders them in the Prometheus
+// text exposition format. It has no dependencies beyond the standard library.
+package metrics
+
+import (
+    "fmt"
+    "io"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+type collector interface {
+    write(w io.Writer)
+}
+
+var (
+    regMu    sync.Mutex
+    registry []collector
+)
+
+func register(c collector) {
+    regMu.Lock(); registry = append(registry, c); regMu.Unlock()
+}
+
+// Counter is a monotonically increasing value without labels.
+type Counter struct {
+    name, help string
+    v          atomic.Int64
+}
+
+func NewCounter(name, help string) *Counter {
+    c := &Counter{name: name, help: help}
+    register(c)
+    return c
+}
+
+func (c *Counter) Add(n int64) { if n > 0 { c.v.Add(n) } }
+func (c *Counter) Inc()        { c.v.Add(1) }
+
+func (c *Counter) write(w io.Writer) {
+    writeHeader(w, c.name, c.help, "counter")
+    fmt.Fprintf(w, "%s %d\n", c.name, c.v.Load())
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+    name, help string
+    labels     []string
+    mu         sync.Mutex
+    m          map[string]int64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+    c := &CounterVec{name: name, help: help, labels: labels, m: map[string]int64{}}
+    register(c)
+    return c
+}
+
+func (c *CounterVec) Inc(values ...string) {
+    k := labelString(c.labels, values)
+    c.mu.Lock(); c.m[k]++; c.mu.Unlock()
+}
+
+func (c *CounterVec) write(w io.Writer) {
+    writeHeader(w, c.name, c.help, "counter")
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    for _, k := range sortedKeys(c.m) { fmt.Fprintf(w, "%s{%s} %d\n", c.name, k, c.m[k]) }
+}
+
+// DefaultBuckets suit request latencies from fast API calls to long uploads.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+type histogram struct {
+    counts []uint64 // per bucket, not cumulative
+    sum    float64
+    count  uint64
+}
+
+// HistogramVec tracks observations in fixed buckets, partitioned by labels.
+type HistogramVec struct {
+    name, help string
+    labels     []string
+    buckets    []float64
+    mu         sync.Mutex
+    m          map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+    h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, m: map[string]*histogram{}}
+    register(h)
+    return h
+}
+
+func (h *HistogramVec) Observe(v float64, values ...string) {
+    k := labelString(h.labels, values)
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    e, ok := h.m[k]
+    if !ok { e = &histogram{counts: make([]uint64, len(h.buckets))}; h.m[k] = e }
+    if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) { e.counts[i]++ }
+    e.sum += v
+    e.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+    writeHeader(w, h.name, h.help, "histogram")
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    keys := make([]string, 0, len(h.m))
+    for k := range h.m { keys = append(keys, k) }
+    sort.Strings(keys)
+    for _, k := range keys {
+        e := h.m[k]
+        sep := ""
+        if k != "" { sep = "," }
+        var cum uint64
+        for i, b := range h.buckets {
+            cum += e.counts[i]
+            fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", h.name, k, sep, formatFloat(b), cum)
+        }
+        fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", h.name, k, sep, e.count)
+        fmt.Fprintf(w, "%s_sum{%s} %s\n", h.name, k, formatFloat(e.sum))
+        fmt.Fprintf(w, "%s_count{%s} %d\n", h.name, k, e.count)
+    }
+}
+
+// WriteAll renders every registered collector.
+func WriteAll(w io.Writer) {
+    regMu.Lock()
+    cs := append([]collector(nil), registry...)
+    regMu.Unlock()
+    for _, c := range cs { c.write(w) }
+}
+
+// WriteGauge renders a single gauge computed at scrape time.
+func WriteGauge(w io.Writer, name, help string, v float64) {
+    writeHeader(w, name, help, "gauge")
+    fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+    fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelString(names, values []string) string {
+    parts := make([]string, len(names))
+    for i, n := range names {
+        v := ""
+        if i < len(values) { v = values[i] }
+        parts[i] = n + `="` + labelEscaper.Replace(v) + `"`
+    }
+    return strings.Join(parts, ",")
+}
+
+func sortedKeys(m map[string]int64) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m { keys = append(keys, k) }
+    sort.Strings(keys)
+    return keys
+}
+
+func formatFloat(v float64) string {
+    if math.IsInf(v, 1) { return "+Inf" }
+    return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Process-wide metrics updated by the router and handlers.
+var (
+    HTTPRequests  = NewCounterVec("winchannel_http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status")
+    HTTPDuration  = NewHistogramVec("winchannel_http_request_duration_seconds", "HTTP request latency by route and method.", DefaultBuckets, "route", "method")
+    UploadBytes   = NewCounter("winchannel_upload_bytes_total", "Bytes stored by uploads, zip extraction and sync.")
+    DownloadBytes = NewCounter("winchannel_download_bytes_total", "Bytes sent by upload downloads.")
+    TextUpdates   = NewCounter("winchannel_text_updates_total", "Shared text versions written.")
+)
\ No newline at end of file
@@ -0,0 +1,24 @@
+package model
+
+import (
+    "sync"
+    "time"
+)
+
+// Snippet is one entry of the clipboard history. Pinned snippets are never
+// evicted by the retention cap.
+type Snippet struct {
+    ID        string    `json:"id"`
+    Content   string    `json:"content"`
+    Envelope  *Envelope `json:"envelope,omitempty"` // content is base64 ciphertext
+    Username  string    `json:"username"`
+    Source    string    `json:"source"` // device name, or the API token ID
+    ClientID  string    `json:"client_id,omitempty"`
+    Pinned    bool      `json:"pinned"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+type ClipboardStore struct {
+    Mu    sync.Mutex
+    Items []Snippet // oldest first
+}
\ No newline at end of file
@@ -0,0 +1,62 @@
+package model
+
+import (
+    "sync"
+    "time"
+)
+
+// Content ciphers accepted in envelopes, with their nonce sizes.
+const (
+    EnvelopeA256GCM = "A256GCM" // AES-256-GCM, 12-byte nonce (Web Crypto)
+    EnvelopeXC20P   = "XC20P"   // XChaCha20-Poly1305, 24-byte nonce
+)
+
+var EnvelopeNonceSizes = map[string]int{EnvelopeA256GCM: 12, EnvelopeXC20P: 24}
+
+// Envelope tags content that was encrypted on the client. The server never
+// holds the content key: it checks the envelope is well formed, stores it
+// with the ciphertext and treats the item as opaque. Binary fields are
+// standard base64.
+type Envelope struct {
+    Alg        string      `json:"alg"`
+    KeyID      string      `json:"kid"`            // which content key, chosen by the client
+    Nonce      string      `json:"nonce"`
+    Salt       string      `json:"salt,omitempty"` // for keys derived from a passphrase
+    Recipients []Recipient `json:"recipients,omitempty"`
+}
+
+// Recipient carries the content key wrapped for one registered public key.
+type Recipient struct {
+    KeyID      string `json:"kid"`
+    WrappedKey string `json:"wrapped_key"`
+}
+
+// Public key algorithms devices can register. Keys are SubjectPublicKeyInfo
+// DER, as exported by Web Crypto "spki".
+const (
+    PublicKeyECDHP256   = "ECDH-P256"
+    PublicKeyX25519     = "X25519"
+    PublicKeyRSAOAEP256 = "RSA-OAEP-256"
+)
+
+// PublicKey is a device key others can wrap content keys for. ID is derived
+// from the key itself, so it cannot be chosen to collide with another key.
+type PublicKey struct {
+    ID        string    `json:"kid"`
+    Username  string    `json:"username"`
+    Device    string    `json:"device,omitempty"`
+    Alg       string    `json:"alg"`
+    Key       string    `json:"key"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+type PublicKeyStore struct {
+    Mu sync.Mutex
+    M  map[string]PublicKey // kid -> key
+}
+
+// EnvelopeStore holds the envelopes of encrypted upload files.
+type EnvelopeStore struct {
+    Mu sync.Mutex
+    M  map[string]Envelope // "<upload id>/<path>" -> envelope
+}
\ No newline at end of file
@@ -1,7 +1,17 @@
 package model
 
 type InfoResponse struct {
-    HostIP string   `json:"host_ip"`
-    Port   int      `json:"port"`
-    Urls   []string `json:"urls"`
+    HostIP    string          `json:"host_ip"`
+    Port      int             `json:"port"`
+    Urls      []string        `json:"urls"`
+    Addresses []InterfaceAddr `json:"addresses"`
+}
+
+// InterfaceAddr is one address the server can be reached on.
+type InterfaceAddr struct {
+    Interface string `json:"interface"`
+    IP        string `json:"ip"`
+    Family    string `json:"family"` // ipv4 or ipv6
+    Virtual   bool   `json:"virtual,omitempty"`
+    URL       string `json:"url,omitempty"`
 }
\ No newline at end of file
@@ -1,6 +1,8 @@
 package model
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
     "sync"
     "time"
 )
@@ -14,9 +16,109 @@ type Session struct {
     Username string
     Role     string
     Expires  time.Time
+    TokenID  string   // set when authenticated by bearer token
+    Scopes   []string // nil for cookie sessions
+
+    // Device details, recorded for cookie sessions only.
+    Device    string
+    UserAgent string
+    IP        string // address of the most recent request
+    Created   time.Time
+    LastSeen  time.Time
 }
 
 type SessionStore struct {
     Mu sync.Mutex
-    M  map[string]Session
-}
\ No newline at end of file
+    M  map[string]Session // SessionKey(cookie value) -> session
+}
+
+// SessionKey is the hash a cookie session is stored under. The cookie value
+// itself is never kept, so sessions.json cannot be used to sign in.
+func SessionKey(tok string) string {
+    sum := sha256.Sum256([]byte("session:" + tok))
+    return hex.EncodeToString(sum[:])
+}
+
+// Device is the client-facing view of a cookie session. ID is derived from
+// the session secret and cannot be used to authenticate.
+type Device struct {
+    ID        string    `json:"id"`
+    Username  string    `json:"username"`
+    Role      string    `json:"role"`
+    Name      string    `json:"name"`
+    UserAgent string    `json:"user_agent"`
+    IP        string    `json:"ip"`
+    CreatedAt time.Time `json:"created_at"`
+    LastSeen  time.Time `json:"last_seen"`
+    ExpiresAt time.Time `json:"expires_at"`
+    Current   bool      `json:"current"`
+}
+
+// Token scopes. Cookie sessions carry no scopes and are allowed everything
+// their role permits; bearer tokens are limited to the scopes they were
+// issued with.
+const (
+    ScopeTextRead  = "text:read"
+    ScopeTextWrite = "text:write"
+    ScopeUpload    = "upload"
+    ScopeDownload  = "download"
+    ScopeAdmin     = "admin"
+)
+
+var AllScopes = []string{ScopeTextRead, ScopeTextWrite, ScopeUpload, ScopeDownload, ScopeAdmin}
+
+// APIToken is a personal access token. Only the SHA-256 of the secret is kept.
+type APIToken struct {
+    ID         string    `json:"id"`
+    Username   string    `json:"username"`
+    Role       string    `json:"role"`
+    Name       string    `json:"name"`
+    Hash       string    `json:"hash,omitempty"`
+    Scopes     []string  `json:"scopes"`
+    CreatedAt  time.Time `json:"created_at"`
+    ExpiresAt  time.Time `json:"expires_at,omitempty"`
+    LastUsedAt time.Time `json:"last_used_at,omitempty"`
+}
+
+type TokenStore struct {
+    Mu sync.Mutex
+    M  map[string]APIToken // hash -> token
+}
+
+// TwoFactor is a user's TOTP enrollment. PendingSecret holds a secret that
+// has been handed out by setup but not yet confirmed with a code.
+type TwoFactor struct {
+    Secret        string    `json:"secret,omitempty"`
+    PendingSecret string    `json:"pending_secret,omitempty"`
+    Enabled       bool      `json:"enabled"`
+    EnabledAt     time.Time `json:"enabled_at,omitempty"`
+    LastCounter   int64     `json:"last_counter"`   // last accepted TOTP step, rejects replays
+    RecoveryCodes []string  `json:"recovery_codes"` // SHA-256 of unused codes
+}
+
+type TwoFactorStore struct {
+    Mu sync.Mutex
+    M  map[string]*TwoFactor // username -> enrollment
+    // RequireAdmin forces accounts with the admin role to log in with 2FA.
+    RequireAdmin bool
+}
+
+// AuditEntry is one line of the append-only audit log.
+type AuditEntry struct {
+    Time      time.Time              `json:"time"`
+    Actor     string                 `json:"actor"`
+    IP        string                 `json:"ip"`
+    UserAgent string                 `json:"user_agent"`
+    Action    string                 `json:"action"`
+    Target    string                 `json:"target"`
+    Result    string                 `json:"result"`
+    RequestID string                 `json:"request_id,omitempty"`
+    Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Audit results.
+const (
+    AuditSuccess = "success"
+    AuditFailure = "failure"
+    AuditDenied  = "denied"
+)
\ No newline at end of file
@@ -0,0 +1,17 @@
+package model
+
+// SyncEntry describes one file in a sync manifest. Path is slash separated and
+// relative to the upload root; Mtime is unix seconds.
+type SyncEntry struct {
+    Path   string `json:"path"`
+    Size   int64  `json:"size"`
+    Mtime  int64  `json:"mtime"`
+    SHA256 string `json:"sha256,omitempty"`
+}
+
+type SyncDiff struct {
+    Missing   []string `json:"missing"`
+    Changed   []string `json:"changed"`
+    Extra     []string `json:"extra"`
+    Unchanged int      `json:"unchanged"`
+}
\ No newline at end of file
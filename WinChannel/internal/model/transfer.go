@@ -0,0 +1,45 @@
+package model
+
+import (
+    "sync"
+    "time"
+)
+
+// Transfer kinds. Files and uploads stay in the upload storage and are
+// referenced by upload ID (and path); text is carried inline.
+const (
+    TransferText   = "text"
+    TransferFile   = "file"
+    TransferUpload = "upload"
+)
+
+// Transfer states, in order. Receipts move a transfer forward only.
+const (
+    TransferSent      = "sent"
+    TransferDelivered = "delivered"
+    TransferRead      = "read"
+)
+
+// Transfer is an item pushed to one recipient's inbox.
+type Transfer struct {
+    ID          string    `json:"id"`
+    Kind        string    `json:"kind"`
+    From        string    `json:"from"`
+    FromDevice  string    `json:"from_device,omitempty"`
+    To          string    `json:"to"`
+    ToDevice    string    `json:"to_device,omitempty"` // session ID; empty for any of the recipient's devices
+    UploadID    string    `json:"upload_id,omitempty"`
+    Path        string    `json:"path,omitempty"`
+    Text        string    `json:"text,omitempty"`
+    Envelope    *Envelope `json:"envelope,omitempty"` // text is base64 ciphertext
+    Note        string    `json:"note,omitempty"`
+    Status      string    `json:"status"`
+    CreatedAt   time.Time `json:"created_at"`
+    DeliveredAt time.Time `json:"delivered_at,omitempty"`
+    ReadAt      time.Time `json:"read_at,omitempty"`
+}
+
+type TransferStore struct {
+    Mu sync.Mutex
+    M  map[string]Transfer // id -> transfer
+}
\ No newline at end of file
@@ -0,0 +1,37 @@
+package model
+
+// Merge modes for writing files into an upload that may already contain them.
+const (
+    MergeOverwrite     = "overwrite"
+    MergeAppend        = "append"
+    MergeKeepBoth      = "keep_both"
+    MergeSkipIdentical = "skip_identical"
+)
+
+// Per-file outcomes reported back to the client.
+const (
+    FileCreated     = "created"
+    FileOverwritten = "overwritten"
+    FileRenamed     = "renamed"
+    FileSkipped     = "skipped"
+    FileRejected    = "rejected"
+    FileFailed      = "failed"
+)
+
+type UploadFileResult struct {
+    Name      string `json:"name"`
+    SavedAs   string `json:"saved_as,omitempty"`
+    Status    string `json:"status"`
+    SizeBytes int64  `json:"size_bytes"`
+    SHA256    string `json:"sha256,omitempty"`
+    Error     string `json:"error,omitempty"`
+    Encrypted bool   `json:"encrypted,omitempty"` // stored with a client-side envelope
+}
+
+func ValidMergeMode(m string) bool {
+    switch m {
+    case MergeOverwrite, MergeAppend, MergeKeepBoth, MergeSkipIdentical:
+        return true
+    }
+    return false
+}
\ No newline at end of file
@@ -6,13 +6,76 @@ import (
 )
 
 var (
-    BaseDir    = "."
-    StorageDir = filepath.Join(BaseDir, "storage")
-    UploadsDir = filepath.Join(StorageDir, "uploads")
-    TextDir    = filepath.Join(StorageDir, "text")
-    UsersFile  = filepath.Join(StorageDir, "users.json")
+    StorageDir    = "storage"
+    UploadsDir    = filepath.Join(StorageDir, "uploads")
+    TextDir       = filepath.Join(StorageDir, "text")
+    ClipboardFile = filepath.Join(TextDir, "clipboard.json")
+    UsersFile     = filepath.Join(StorageDir, "users.json")
+    TokensFile    = filepath.Join(StorageDir, "tokens.json")
+    TwoFAFile     = filepath.Join(StorageDir, "twofactor.json")
+    AuditFile     = filepath.Join(StorageDir, "audit.ndjson")
+    SessionsFile  = filepath.Join(StorageDir, "sessions.json")
+    TransfersFile = filepath.Join(StorageDir, "transfers.json")
+    KeysFile      = filepath.Join(StorageDir, "public_keys.json")
+    EnvelopesFile = filepath.Join(StorageDir, "envelopes.json")
+    WALFile       = filepath.Join(StorageDir, "wal.json")
+    TLSDir        = filepath.Join(StorageDir, "tls")
 )
 
+// SetStorageDir moves every path under dir. Call it before anything touches
+// storage.
+func SetStorageDir(dir string) {
+    StorageDir = dir
+    UploadsDir = filepath.Join(StorageDir, "uploads")
+    TextDir = filepath.Join(StorageDir, "text")
+    ClipboardFile = filepath.Join(TextDir, "clipboard.json")
+    UsersFile = filepath.Join(StorageDir, "users.json")
+    TokensFile = filepath.Join(StorageDir, "tokens.json")
+    TwoFAFile = filepath.Join(StorageDir, "twofactor.json")
+    AuditFile = filepath.Join(StorageDir, "audit.ndjson")
+    SessionsFile = filepath.Join(StorageDir, "sessions.json")
+    TransfersFile = filepath.Join(StorageDir, "transfers.json")
+    KeysFile = filepath.Join(StorageDir, "public_keys.json")
+    EnvelopesFile = filepath.Join(StorageDir, "envelopes.json")
+    WALFile       = filepath.Join(StorageDir, "wal.json")
+    TLSDir = filepath.Join(StorageDir, "tls")
+}
+
+// Inspect looks at StorageDir before it is created and returns warnings for
+// the ways it commonly ends up wrong: started from another directory (so a
+// fresh empty storage appears), or pointed at something that is not ours.
+func Inspect() []string {
+    var warns []string
+    abs, _ := filepath.Abs(StorageDir)
+    entries, err := os.ReadDir(StorageDir)
+    switch {
+    case os.IsNotExist(err):
+        warns = append(warns, "data directory "+abs+" does not exist; starting with empty storage")
+    case err != nil:
+        warns = append(warns, "data directory "+abs+": "+err.Error())
+    case len(entries) == 0:
+        warns = append(warns, "data directory "+abs+" is empty")
+    default:
+        known := false
+        for _, e := range entries {
+            switch e.Name() {
+            case "users.json", "uploads", "text":
+                known = true
+            }
+        }
+        if !known { warns = append(warns, "data directory "+abs+" does not look like WinChannel storage (no users.json, uploads/ or text/)") }
+    }
+    if exe, err := os.Executable(); err == nil {
+        other := filepath.Join(filepath.Dir(exe), "storage")
+        if otherAbs, _ := filepath.Abs(other); otherAbs != abs {
+            if _, err := os.Stat(filepath.Join(other, "users.json")); err == nil {
+                warns = append(warns, "found existing data next to the executable at "+otherAbs+"; use -data-dir to select it")
+            }
+        }
+    }
+    return warns
+}
+
 func EnsureDirs() error {
     for _, d := range []string{UploadsDir, TextDir} {
         if err := os.MkdirAll(d, 0755); err != nil {
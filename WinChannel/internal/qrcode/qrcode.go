@@ -0,0 +1,381 @@
+// Package qrcode encodes short byte strings (URLs) as QR Code symbols
+// (ISO/IEC 18004, byte mode, versions 1-40) and renders them as PNG or SVG.
+package qrcode
+
+import (
+    "errors"
+)
+
+// Level is the error correction level. Higher levels survive more damage at
+// the cost of a larger symbol.
+type Level int
+
+const (
+    Low      Level = iota // ~7% recovery
+    Medium                // ~15%
+    Quartile              // ~25%
+    High                  // ~30%
+)
+
+// formatBits are the two-bit level indicators, which are not in level order.
+var formatBits = [4]int{1, 0, 3, 2}
+
+// ErrTooLong is returned when the data does not fit in a version 40 symbol.
+var ErrTooLong = errors.New("qrcode: data too long")
+
+// Error correction codewords per block and number of blocks, indexed by
+// level then version (index 0 unused).
+var eccPerBlock = [4][41]int{
+    {-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+    {-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+    {-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+    {-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var numBlocks = [4][41]int{
+    {-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+    {-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+    {-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+    {-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// Code is an encoded symbol. Modules are addressed with (0,0) at the top left.
+type Code struct {
+    Version int
+    Level   Level
+    Size    int
+    modules []bool
+    isFunc  []bool
+}
+
+// Black reports whether the module at (x, y) is dark. Coordinates outside
+// the symbol (the quiet zone) are light.
+func (c *Code) Black(x, y int) bool {
+    if x < 0 || y < 0 || x >= c.Size || y >= c.Size { return false }
+    return c.modules[y*c.Size+x]
+}
+
+// Encode picks the smallest version that holds data in byte mode at level
+// lvl or better; the level is raised when that costs no extra space.
+func Encode(data []byte, lvl Level) (*Code, error) {
+    c, err := newCode(data, lvl)
+    if err != nil { return nil, err }
+    best, bestPenalty := 0, -1
+    for mask := 0; mask < 8; mask++ {
+        c.applyMask(mask)
+        c.drawFormatBits(mask)
+        if p := c.penalty(); bestPenalty < 0 || p < bestPenalty { best, bestPenalty = mask, p }
+        c.applyMask(mask) // masking is an XOR, so applying it again undoes it
+    }
+    c.setMask(best)
+    return c, nil
+}
+
+// newCode lays out data with its error correction, unmasked.
+func newCode(data []byte, lvl Level) (*Code, error) {
+    ver := 1
+    for ; ver <= 40; ver++ {
+        if bitsNeeded(data, ver) <= dataCodewords(ver, lvl)*8 { break }
+    }
+    if ver > 40 { return nil, ErrTooLong }
+    for l := lvl + 1; l <= High; l++ {
+        if bitsNeeded(data, ver) <= dataCodewords(ver, l)*8 { lvl = l }
+    }
+
+    var bb bitBuffer
+    bb.append(4, 4) // byte mode
+    bb.append(len(data), countBits(ver))
+    for _, b := range data { bb.append(int(b), 8) }
+    capBits := dataCodewords(ver, lvl) * 8
+    bb.append(0, min(4, capBits-len(bb)))
+    bb.append(0, (8-len(bb)%8)%8)
+    for pad := 0xEC; len(bb) < capBits; pad ^= 0xEC ^ 0x11 { bb.append(pad, 8) }
+    codewords := make([]byte, len(bb)/8)
+    for i, bit := range bb { if bit { codewords[i>>3] |= 1 << (7 - uint(i&7)) } }
+
+    c := &Code{Version: ver, Level: lvl, Size: ver*4 + 17}
+    c.modules = make([]bool, c.Size*c.Size)
+    c.isFunc = make([]bool, c.Size*c.Size)
+    c.drawFunctionPatterns()
+    c.drawCodewords(c.addECCAndInterleave(codewords))
+    return c, nil
+}
+
+// setMask applies the final mask and its format bits.
+func (c *Code) setMask(mask int) {
+    c.applyMask(mask)
+    c.drawFormatBits(mask)
+    c.isFunc = nil
+}
+
+func countBits(ver int) int {
+    if ver <= 9 { return 8 }
+    return 16
+}
+
+func bitsNeeded(data []byte, ver int) int {
+    if len(data) >= 1<<uint(countBits(ver)) { return 1 << 30 }
+    return 4 + countBits(ver) + 8*len(data)
+}
+
+// rawDataModules is the number of modules left for data and error
+// correction after the function patterns are placed.
+func rawDataModules(ver int) int {
+    n := (16*ver+128)*ver + 64
+    if ver >= 2 {
+        align := ver/7 + 2
+        n -= (25*align-10)*align - 55
+        if ver >= 7 { n -= 36 }
+    }
+    return n
+}
+
+func dataCodewords(ver int, lvl Level) int {
+    return rawDataModules(ver)/8 - eccPerBlock[lvl][ver]*numBlocks[lvl][ver]
+}
+
+type bitBuffer []bool
+
+func (bb *bitBuffer) append(v, n int) {
+    for i := n - 1; i >= 0; i-- { *bb = append(*bb, (v>>uint(i))&1 != 0) }
+}
+
+func (c *Code) set(x, y int, dark bool) { c.modules[y*c.Size+x] = dark }
+
+func (c *Code) setFunc(x, y int, dark bool) {
+    c.modules[y*c.Size+x] = dark
+    c.isFunc[y*c.Size+x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+    for i := 0; i < c.Size; i++ {
+        c.setFunc(6, i, i%2 == 0)
+        c.setFunc(i, 6, i%2 == 0)
+    }
+    c.drawFinder(3, 3)
+    c.drawFinder(c.Size-4, 3)
+    c.drawFinder(3, c.Size-4)
+    pos := alignmentPositions(c.Version, c.Size)
+    n := len(pos)
+    for i := 0; i < n; i++ {
+        for j := 0; j < n; j++ {
+            if i == 0 && j == 0 || i == 0 && j == n-1 || i == n-1 && j == 0 { continue } // finder corners
+            c.drawAlignment(pos[i], pos[j])
+        }
+    }
+    c.drawFormatBits(0) // reserve the area; overwritten once the mask is chosen
+    c.drawVersion()
+}
+
+func abs(v int) int {
+    if v < 0 { return -v }
+    return v
+}
+
+// drawFinder draws a finder pattern and its separator centred on (x, y).
+func (c *Code) drawFinder(x, y int) {
+    for dy := -4; dy <= 4; dy++ {
+        for dx := -4; dx <= 4; dx++ {
+            xx, yy := x+dx, y+dy
+            if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size { continue }
+            d := max(abs(dx), abs(dy))
+            c.setFunc(xx, yy, d != 2 && d != 4)
+        }
+    }
+}
+
+func (c *Code) drawAlignment(x, y int) {
+    for dy := -2; dy <= 2; dy++ {
+        for dx := -2; dx <= 2; dx++ { c.setFunc(x+dx, y+dy, max(abs(dx), abs(dy)) != 1) }
+    }
+}
+
+func alignmentPositions(ver, size int) []int {
+    if ver == 1 { return nil }
+    n := ver/7 + 2
+    step := (ver*8 + n*3 + 5) / (n*4 - 4) * 2
+    pos := make([]int, n)
+    pos[0] = 6
+    for i, p := n-1, size-7; i >= 1; i, p = i-1, p-step { pos[i] = p }
+    return pos
+}
+
+// drawFormatBits writes the BCH-protected level and mask indicator in both
+// of its copies, plus the always-dark module.
+func (c *Code) drawFormatBits(mask int) {
+    data := formatBits[c.Level]<<3 | mask
+    rem := data
+    for i := 0; i < 10; i++ { rem = rem<<1 ^ (rem>>9)*0x537 }
+    bits := (data<<10 | rem) ^ 0x5412
+    bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+    for i := 0; i <= 5; i++ { c.setFunc(8, i, bit(i)) }
+    c.setFunc(8, 7, bit(6))
+    c.setFunc(8, 8, bit(7))
+    c.setFunc(7, 8, bit(8))
+    for i := 9; i < 15; i++ { c.setFunc(14-i, 8, bit(i)) }
+
+    for i := 0; i < 8; i++ { c.setFunc(c.Size-1-i, 8, bit(i)) }
+    for i := 8; i < 15; i++ { c.setFunc(8, c.Size-15+i, bit(i)) }
+    c.setFunc(8, c.Size-8, true)
+}
+
+func (c *Code) drawVersion() {
+    if c.Version < 7 { return }
+    rem := c.Version
+    for i := 0; i < 12; i++ { rem = rem<<1 ^ (rem>>11)*0x1F25 }
+    bits := c.Version<<12 | rem
+    for i := 0; i < 18; i++ {
+        dark := (bits>>uint(i))&1 != 0
+        a, b := c.Size-11+i%3, i/3
+        c.setFunc(a, b, dark)
+        c.setFunc(b, a, dark)
+    }
+}
+
+// addECCAndInterleave splits data into blocks, appends Reed-Solomon error
+// correction to each and interleaves the result.
+func (c *Code) addECCAndInterleave(data []byte) []byte {
+    nb := numBlocks[c.Level][c.Version]
+    eccLen := eccPerBlock[c.Level][c.Version]
+    raw := rawDataModules(c.Version) / 8
+    numShort := nb - raw%nb
+    shortLen := raw / nb
+
+    div := rsDivisor(eccLen)
+    blocks := make([][]byte, nb)
+    k := 0
+    for i := range blocks {
+        n := shortLen - eccLen
+        if i >= numShort { n++ }
+        dat := data[k : k+n]
+        k += n
+        blk := append([]byte{}, dat...)
+        if i < numShort { blk = append(blk, 0) } // placeholder so all blocks line up
+        blocks[i] = append(blk, rsRemainder(dat, div)...)
+    }
+    out := make([]byte, 0, raw)
+    for i := range blocks[0] {
+        for j, blk := range blocks {
+            if i != shortLen-eccLen || j >= numShort { out = append(out, blk[i]) }
+        }
+    }
+    return out
+}
+
+// drawCodewords places the data in the zig-zag column pairs, skipping
+// function modules. Leftover remainder bits stay light.
+func (c *Code) drawCodewords(data []byte) {
+    i := 0
+    for right := c.Size - 1; right >= 1; right -= 2 {
+        if right == 6 { right = 5 }
+        for vert := 0; vert < c.Size; vert++ {
+            for j := 0; j < 2; j++ {
+                x := right - j
+                y := vert
+                if (right+1)&2 == 0 { y = c.Size - 1 - vert } // upward column pair
+                if c.isFunc[y*c.Size+x] || i >= len(data)*8 { continue }
+                c.set(x, y, (data[i>>3]>>(7-uint(i&7)))&1 != 0)
+                i++
+            }
+        }
+    }
+}
+
+func (c *Code) applyMask(mask int) {
+    for y := 0; y < c.Size; y++ {
+        for x := 0; x < c.Size; x++ {
+            var inv bool
+            switch mask {
+            case 0: inv = (x+y)%2 == 0
+            case 1: inv = y%2 == 0
+            case 2: inv = x%3 == 0
+            case 3: inv = (x+y)%3 == 0
+            case 4: inv = (x/3+y/2)%2 == 0
+            case 5: inv = x*y%2+x*y%3 == 0
+            case 6: inv = (x*y%2+x*y%3)%2 == 0
+            case 7: inv = ((x+y)%2+x*y%3)%2 == 0
+            }
+            if inv && !c.isFunc[y*c.Size+x] { c.modules[y*c.Size+x] = !c.modules[y*c.Size+x] }
+        }
+    }
+}
+
+// penalty scores the symbol with the four rules from the standard; the mask
+// with the lowest score is used.
+func (c *Code) penalty() int {
+    n := c.Size
+    p := 0
+    finder := []bool{true, false, true, true, true, false, true}
+    for pass := 0; pass < 2; pass++ {
+        at := func(i, j int) bool { if pass == 0 { return c.Black(j, i) }; return c.Black(i, j) }
+        for i := 0; i < n; i++ {
+            run := 1
+            for j := 1; j <= n; j++ {
+                if j < n && at(i, j) == at(i, j-1) { run++; continue }
+                if run >= 5 { p += 3 + run - 5 }
+                run = 1
+            }
+            // 1:1:3:1:1 finder-like runs with four light modules on one side
+            for j := -4; j+7 <= n+4; j++ {
+                match := true
+                for k, b := range finder { if at(i, j+k) != b { match = false; break } }
+                if !match { continue }
+                before, after := true, true
+                for k := 1; k <= 4; k++ {
+                    if at(i, j-k) { before = false }
+                    if at(i, j+6+k) { after = false }
+                }
+                if before || after { p += 40 }
+            }
+        }
+    }
+    dark := 0
+    for y := 0; y < n; y++ {
+        for x := 0; x < n; x++ {
+            b := c.Black(x, y)
+            if b { dark++ }
+            if x < n-1 && y < n-1 && b == c.Black(x+1, y) && b == c.Black(x, y+1) && b == c.Black(x+1, y+1) { p += 3 }
+        }
+    }
+    p += abs(dark*20-n*n*10) / (n * n) * 10
+    return p
+}
+
+func gfMul(x, y int) int {
+    z := 0
+    for i := 7; i >= 0; i-- {
+        z = z<<1 ^ (z>>7)*0x11D
+        z ^= (y >> uint(i) & 1) * x
+    }
+    return z
+}
+
+// rsDivisor returns the generator polynomial of the given degree, highest
+// coefficient first with the leading 1 omitted.
+func rsDivisor(degree int) []byte {
+    res := make([]int, degree)
+    res[degree-1] = 1
+    root := 1
+    for i := 0; i < degree; i++ {
+        for j := range res {
+            res[j] = gfMul(res[j], root)
+            if j+1 < len(res) { res[j] ^= res[j+1] }
+        }
+        root = gfMul(root, 2)
+    }
+    out := make([]byte, degree)
+    for i, v := range res { out[i] = byte(v) }
+    return out
+}
+
+func rsRemainder(data, div []byte) []byte {
+    res := make([]byte, len(div))
+    for _, b := range data {
+        factor := int(b ^ res[0])
+        copy(res, res[1:])
+        res[len(res)-1] = 0
+        for i, coef := range div { res[i] ^= byte(gfMul(int(coef), factor)) }
+    }
+    return res
+}
\ No newline at end of file
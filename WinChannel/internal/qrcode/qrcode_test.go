@@ -0,0 +1,152 @@
+package qrcode
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "testing"
+)
+
+// Reference symbols from an independent encoder (rsc.io/qr/coding) with the
+// same version, level and mask. '#' is dark.
+const (
+    refV1M3 = `
+#######.#...#.#######
+#.....#.##.##.#.....#
+#.###.#..####.#.###.#
+#.###.#.#.###.#.###.#
+#.###.#..#....#.###.#
+#.....#..#....#.....#
+#######.#.#.#.#######
+........#.#..........
+#.##.###.#....#..#.##
+.#####..#.#.#####...#
+#..##.#.#.#.#..#...##
+#..#.....#..#....#..#
+..#...#.##.#..#.#..#.
+........####.##.#.##.
+#######.#......##.#..
+#.....#.##.###...##..
+#.###.#..###.....###.
+#.###.#.##.##.#....#.
+#.###.#.#.#.#....#...
+#.....#....##.#.....#
+#######.###.#.#...#..`
+    refV7L5 = `
+#######...#...###...##....######.#..#.#######
+#.....#....##.##.......####.##.....#..#.....#
+#.###.#..##....#..#.#...#.#.#..###.#..#.###.#
+#.###.#.#....###.###.#....###.####.##.#.###.#
+#.###.#.#######..#.#######.#.##...###.#.###.#
+#.....#..#...##.....#...###.##..##....#.....#
+#######.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#######
+.........###..#.#.#.#...#.####.##............
+##...###.#.#.###..#.#####....#.#.#.#....##...
+##.#.......##.##..#....#.##.#####.#.#.#....#.
+###..######.#.###..###.#######..#.#..##.#.##.
+##.#.....####..##.##.#..#.###..##.#.#.#####..
+##..####..###.#...###..#.##.###.###..##.#...#
+##..#..#....####.#..#.##.#...##..#.###....###
+..##..#####....#.#.###.#######..#.#.#####.##.
+#####.......###....####.#..#.##.......#...#.#
+#..#####..#......#....#.......##.###.#.#.#..#
+.#####..#.#.##....#.#.##.#...###....#...#..##
+########....##..##...##.#..#.#.##..#...####.#
+#.##...#.#........##.#..#.###..##.##..#####..
+....#####..###..###.#####.....##.#.#######.#.
+..###...#....#.###..#...###.###.#####...#..#.
+##..#.#.#.######..#.#.#.######..#.###.#.#..#.
+.##.#...##.##.#.#####...#.####..#.#.#...#.#..
+.#.########.#..####.#######.#...##########.#.
+..#.##..##..#..########..#...##.....#..#...##
+#..##.#....##.###....###.####.....####.#..##.
+#..###.#..#.#.##..#.#.###..#...#...###...##.#
+.#..#.##...#.#..#####...#.....##.#...#..##..#
+.###....#.######.#.####..#...##..#..#.#..#.##
+.#.#.###..#######..###.....#...#...#.##.#...#
+##...#...#...#..#......##.###..##..#.##.#.#..
+##.#.###....#....#.##...#....#.#.#..#.#.#...#
+##..##.##..#.##.#.##.#...#######..#.#.###....
+....#.#.##....#......###.##.#..##.##.#.#..##.
+.####..##.##......#....##.###..##.#####.###..
+#..##.##......#...#.#######.###.#########..#.
+........##.#####.#.##...##...##..#..#...##.##
+#######.###.####..###.#.######..#.###.#.##.#.
+#.....#.#.#......####...#..#.##...###...#.#.#
+#.###.#..#.#####..#.#####..#.##..#.#######..#
+#.###.#.....#..####..#..##..###....#..###....
+#.###.#...#.##.#.#.#...#.....#.##...########.
+#.....#.#.#.#..##.###.##..###..##.#.#..#.##..
+#######.####.#..####.#.##.....##.#....##.#.#.`
+)
+
+func matrix(c *Code) string {
+    var b strings.Builder
+    for y := 0; y < c.Size; y++ {
+        b.WriteByte('\n')
+        for x := 0; x < c.Size; x++ {
+            if c.Black(x, y) { b.WriteByte('#') } else { b.WriteByte('.') }
+        }
+    }
+    return b.String()
+}
+
+func TestKnownSymbols(t *testing.T) {
+    cases := []struct {
+        data string
+        lvl  Level
+        mask int
+        ver  int
+        want string
+    }{
+        {"winchannel:1", Medium, 3, 1, refV1M3},
+        {"http://192.168.1.20:8000/pair?token=" + strings.Repeat("x", 100), Low, 5, 7, refV7L5},
+    }
+    for _, tc := range cases {
+        c, err := newCode([]byte(tc.data), tc.lvl)
+        if err != nil { t.Fatal(err) }
+        if c.Version != tc.ver || c.Level != tc.lvl { t.Fatalf("%q: version %d level %d, want %d %d", tc.data, c.Version, c.Level, tc.ver, tc.lvl) }
+        c.setMask(tc.mask)
+        if got := matrix(c); got != tc.want { t.Errorf("%q: symbol differs from reference\ngot:%s\nwant:%s", tc.data, got, tc.want) }
+    }
+}
+
+// TestReedSolomon checks the error correction of the worked "HELLO WORLD"
+// 1-M example from the standard's tutorials.
+func TestReedSolomon(t *testing.T) {
+    data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+    want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+    if got := rsRemainder(data, rsDivisor(len(want))); !bytes.Equal(got, want) { t.Fatalf("ecc = %v, want %v", got, want) }
+}
+
+// TestCapacity checks the byte mode capacity of the first, a middle and the
+// last version at every level: the limit fits, one more byte does not.
+func TestCapacity(t *testing.T) {
+    caps := map[int][4]int{
+        1:  {17, 14, 11, 7},
+        10: {271, 213, 151, 119},
+        40: {2953, 2331, 1663, 1273},
+    }
+    version := func(n int, lvl Level) (int, error) {
+        c, err := Encode(bytes.Repeat([]byte("a"), n), lvl)
+        if err != nil { return 0, err }
+        return c.Version, nil
+    }
+    for ver, byLevel := range caps {
+        for lvl, n := range byLevel {
+            if got, err := version(n, Level(lvl)); err != nil || got != ver { t.Errorf("%d bytes at level %d: version %d, %v; want %d", n, lvl, got, err, ver) }
+            got, err := version(n+1, Level(lvl))
+            if ver == 40 {
+                if !errors.Is(err, ErrTooLong) { t.Errorf("%d bytes at level %d: version %d, %v; want ErrTooLong", n+1, lvl, got, err) }
+            } else if err != nil || got != ver+1 {
+                t.Errorf("%d bytes at level %d: version %d, %v; want %d", n+1, lvl, got, err, ver+1)
+            }
+        }
+    }
+}
+
+func TestEncodeRaisesLevel(t *testing.T) {
+    c, err := Encode([]byte("hello"), Low)
+    if err != nil { t.Fatal(err) }
+    if c.Version != 1 || c.Level != High { t.Fatalf("version %d level %d, want 1 and High", c.Version, c.Level) }
+}
\ No newline at end of file
@@ -0,0 +1,47 @@
+package qrcode
+
+import (
+    "bytes"
+    "fmt"
+    "image"
+    "image/color"
+    "image/png"
+    "strings"
+)
+
+// QuietZone is the light border, in modules, that scanners need around the
+// symbol. Both renderers include it.
+const QuietZone = 4
+
+// PNG renders the symbol as a greyscale PNG with scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+    if scale < 1 { scale = 1 }
+    side := (c.Size + 2*QuietZone) * scale
+    img := image.NewGray(image.Rect(0, 0, side, side))
+    for y := 0; y < side; y++ {
+        for x := 0; x < side; x++ {
+            v := color.Gray{Y: 0xFF}
+            if c.Black(x/scale-QuietZone, y/scale-QuietZone) { v.Y = 0 }
+            img.SetGray(x, y, v)
+        }
+    }
+    var buf bytes.Buffer
+    if err := png.Encode(&buf, img); err != nil { return nil, err }
+    return buf.Bytes(), nil
+}
+
+// SVG renders the symbol as a standalone SVG document. The viewBox is in
+// modules; scale only sets the default width and height in pixels.
+func (c *Code) SVG(scale int) string {
+    if scale < 1 { scale = 1 }
+    side := c.Size + 2*QuietZone
+    var path strings.Builder
+    for y := 0; y < c.Size; y++ {
+        for x := 0; x < c.Size; x++ {
+            if c.Black(x, y) { fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QuietZone, y+QuietZone) }
+        }
+    }
+    return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`+
+        `<rect width="100%%" height="100%%" fill="#fff"/><path d="%s" fill="#000"/></svg>`+"\n",
+        side, side, side*scale, side*scale, path.String())
+}
\ No newline at end of file
@@ -0,0 +1,106 @@
+package router
+
+import (
+    "context"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "time"
+    "winchannel/internal/config"
+    "winchannel/internal/metrics"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// statusRecorder captures the status code and body size for the access log.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+    bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+    if s.status == 0 { s.status = code }
+    s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+    if s.status == 0 { s.status = http.StatusOK }
+    n, err := s.ResponseWriter.Write(p)
+    s.bytes += int64(n)
+    return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+func (s *statusRecorder) Flush() {
+    if f, ok := s.ResponseWriter.(http.Flusher); ok { f.Flush() }
+}
+
+// metricMethod maps methods outside the standard set to "OTHER": clients can
+// send any method string, and each would become a new series.
+func metricMethod(m string) string {
+    switch m {
+    case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+        return m
+    }
+    return "OTHER"
+}
+
+// instrument records request count and latency for route, the registered
+// pattern rather than the raw path so label cardinality stays bounded.
+func instrument(route string, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        start := time.Now()
+        rec := &statusRecorder{ResponseWriter: w}
+        defer func() {
+            if rec.status == 0 { rec.status = http.StatusOK }
+            method := metricMethod(r.Method)
+            metrics.HTTPRequests.Inc(route, method, strconv.Itoa(rec.status))
+            metrics.HTTPDuration.Observe(time.Since(start).Seconds(), route, method)
+        }()
+        next.ServeHTTP(rec, r)
+    })
+}
+
+// accessInfo is filled in by inner middleware (the guard knows the user).
+type accessInfo struct {
+    user string
+}
+
+type accessKey struct{}
+
+func setAccessUser(r *http.Request, user string) {
+    if ai, ok := r.Context().Value(accessKey{}).(*accessInfo); ok { ai.user = user }
+}
+
+// accessLog writes one line per request at info level (warn for 5xx) unless
+// log.access is turned off.
+func accessLog(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if !config.Get().Log.Access { next.ServeHTTP(w, r); return }
+        start := time.Now()
+        ai := &accessInfo{}
+        rec := &statusRecorder{ResponseWriter: w}
+        r = r.WithContext(context.WithValue(r.Context(), accessKey{}, ai))
+        defer func() {
+            if rec.status == 0 { rec.status = http.StatusOK }
+            if ai.user == "" {
+                if s, ok := service.GetSession(r); ok { ai.user = s.Username }
+            }
+            level := slog.LevelInfo
+            if rec.status >= 500 { level = slog.LevelWarn }
+            util.Logger(r).LogAttrs(r.Context(), level, "access",
+                slog.String("method", r.Method),
+                slog.String("path", r.URL.Path),
+                slog.Int("status", rec.status),
+                slog.Int64("bytes", rec.bytes),
+                slog.Duration("duration", time.Since(start)),
+                slog.String("user", ai.user),
+                slog.String("ip", util.ClientIP(r)),
+            )
+        }()
+        next.ServeHTTP(rec, r)
+    })
+}
\ No newline at end of file
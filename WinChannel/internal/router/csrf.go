@@ -0,0 +1,68 @@
+package router
+
+import (
+    "crypto/subtle"
+    "net/http"
+    "net/url"
+    "strings"
+    "winchannel/internal/config"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+func isSafeMethod(m string) bool {
+    return m == http.MethodGet || m == http.MethodHead || m == http.MethodOptions
+}
+
+// requestHost is the host the browser believes it is talking to.
+func requestHost(r *http.Request) string {
+    if config.Get().TrustProxy {
+        if h := r.Header.Get("X-Forwarded-Host"); h != "" { return strings.TrimSpace(strings.Split(h, ",")[0]) }
+    }
+    return r.Host
+}
+
+// sameOrigin checks Origin (or Referer as a fallback) against the request
+// host and csrf_trusted_origins. Requests carrying neither header are left to
+// the token check.
+func sameOrigin(r *http.Request) bool {
+    src := r.Header.Get("Origin")
+    if src == "" || src == "null" { src = r.Header.Get("Referer") }
+    if src == "" { return r.Header.Get("Origin") != "null" }
+    u, err := url.Parse(src)
+    if err != nil || u.Host == "" { return false }
+    if strings.EqualFold(u.Host, requestHost(r)) { return true }
+    for _, o := range config.Get().CSRFTrustedOrigins {
+        if strings.EqualFold(strings.TrimRight(o, "/"), u.Scheme+"://"+u.Host) { return true }
+    }
+    return false
+}
+
+// hasAmbientCredentials reports whether the browser attached cookies that an
+// attacker could ride on.
+func hasAmbientCredentials(r *http.Request) bool {
+    if _, err := r.Cookie(service.SessionCookie); err == nil { return true }
+    if _, err := r.Cookie(service.PendingCookie); err == nil { return true }
+    return false
+}
+
+// csrf guards state-changing requests. Bearer-token requests are exempt since
+// browsers never attach the Authorization header on their own. Everything
+// else must come from our own origin, and requests that carry a session
+// cookie must also echo the CSRF cookie in the X-CSRF-Token header.
+func csrf(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if isSafeMethod(r.Method) { next.ServeHTTP(w, r); return }
+        if _, ok := service.BearerToken(r); ok { next.ServeHTTP(w, r); return }
+        if !sameOrigin(r) { util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "csrf: cross-origin request rejected"); return }
+        if hasAmbientCredentials(r) {
+            c, err := r.Cookie(service.CSRFCookie)
+            h := r.Header.Get(service.CSRFHeader)
+            if err != nil || h == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(h)) != 1 {
+                util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "csrf: missing or invalid token")
+                return
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
+}
\ No newline at end of file
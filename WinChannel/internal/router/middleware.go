@@ -0,0 +1,134 @@
+package router
+
+import (
+    "net/http"
+    "regexp"
+    "runtime/debug"
+    "sort"
+    "strings"
+    "winchannel/internal/model"
+    "winchannel/internal/service"
+    "winchannel/internal/util"
+)
+
+// guard is an access requirement declared when a route is registered. Every
+// route must name one, so an endpoint cannot be added without deciding who
+// may call it.
+type guard struct {
+    name       string
+    auth       bool
+    scope      string // required token scope, "" for any
+    admin      bool
+    cookieOnly bool // reject bearer tokens
+    bypass     func(*http.Request) bool // admits a request without a session
+}
+
+var public = guard{name: "public"}
+
+// authed requires a session or a bearer token carrying scope.
+func authed(scope string) guard { return guard{name: "auth:" + scope, auth: true, scope: scope} }
+
+// session requires an interactive (cookie) session; used for endpoints that
+// manage credentials.
+var session = guard{name: "session", auth: true, cookieOnly: true}
+
+// admin requires the admin role (and the admin scope for bearer tokens).
+var admin = guard{name: "admin", auth: true, admin: true, scope: model.ScopeAdmin}
+
+// metricsAccess is admin, or the METRICS_TOKEN scrape credential.
+var metricsAccess = guard{name: "metrics", auth: true, admin: true, scope: model.ScopeAdmin, bypass: service.MetricsTokenOK}
+
+func (g guard) wrap(next http.Handler) http.Handler {
+    if !g.auth { return next }
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if g.bypass != nil && g.bypass(r) { next.ServeHTTP(w, r); return }
+        s, ok := service.GetSession(r)
+        if !ok { util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "login required"); return }
+        setAccessUser(r, s.Username)
+        if g.cookieOnly && s.TokenID != "" { service.Audit(r, "access.denied", r.URL.Path, model.AuditDenied, map[string]interface{}{"reason": "token_not_allowed"}); util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "not allowed with api token"); return }
+        if g.admin && s.Role != "admin" { service.Audit(r, "access.denied", r.URL.Path, model.AuditDenied, map[string]interface{}{"reason": "admin_required"}); util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "admin required"); return }
+        if g.scope != "" && !service.HasScope(s, g.scope) { service.Audit(r, "access.denied", r.URL.Path, model.AuditDenied, map[string]interface{}{"reason": "missing_scope", "scope": g.scope}); util.WriteError(w, r, http.StatusForbidden, util.CodeForbidden, "token lacks scope "+g.scope); return }
+        next.ServeHTTP(w, r)
+    })
+}
+
+// endpoint dispatches one URL pattern by HTTP method. HEAD falls back to GET.
+type endpoint struct {
+    byMethod map[string]http.Handler
+}
+
+func (e *endpoint) allowed() string {
+    var ms []string
+    for m := range e.byMethod { ms = append(ms, m) }
+    if _, ok := e.byMethod[http.MethodGet]; ok { ms = append(ms, http.MethodHead) }
+    sort.Strings(ms)
+    return strings.Join(ms, ", ")
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    h, ok := e.byMethod[r.Method]
+    if !ok && r.Method == http.MethodHead { h, ok = e.byMethod[http.MethodGet] }
+    if !ok {
+        w.Header().Set("Allow", e.allowed())
+        util.WriteError(w, r, http.StatusMethodNotAllowed, util.CodeMethodNotAllowed, r.Method+" not allowed")
+        return
+    }
+    h.ServeHTTP(w, r)
+}
+
+// requestIDPattern limits client supplied IDs to something safe to log.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID tags each request with an ID (the client's X-Request-ID if it
+// looks sane) that is echoed in the response header and in error bodies.
+func withRequestID(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        id := r.Header.Get("X-Request-ID")
+        if !requestIDPattern.MatchString(id) { id, _ = service.RandToken(8) }
+        w.Header().Set("X-Request-ID", id)
+        next.ServeHTTP(w, r.WithContext(util.WithRequestID(r.Context(), id)))
+    })
+}
+
+// recoverPanic turns a handler panic into a 500 instead of a dropped
+// connection and logs the stack.
+func recoverPanic(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        defer func() {
+            if v := recover(); v != nil {
+                if v == http.ErrAbortHandler { panic(v) }
+                util.Logger(r).Error("panic serving request", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+                util.WriteError(w, r, http.StatusInternalServerError, util.CodeInternal, "internal server error")
+            }
+        }()
+        next.ServeHTTP(w, r)
+    })
+}
+
+// registrar collects routes and installs one endpoint per pattern on the mux.
+type registrar struct {
+    mux       *http.ServeMux
+    endpoints map[string]*endpoint
+}
+
+func newRegistrar(mux *http.ServeMux) *registrar {
+    return &registrar{mux: mux, endpoints: map[string]*endpoint{}}
+}
+
+// route registers h for method on pattern behind g. The full chain is
+// withRequestID -> accessLog -> instrument -> recoverPanic -> csrf -> method
+// dispatch -> guard -> handler.
+func (g *registrar) route(method, pattern string, access guard, h http.HandlerFunc) {
+    e, ok := g.endpoints[pattern]
+    if !ok {
+        e = &endpoint{byMethod: map[string]http.Handler{}}
+        g.endpoints[pattern] = e
+        g.mux.Handle(pattern, withRequestID(accessLog(instrument(pattern, recoverPanic(csrf(e))))))
+    }
+    if _, dup := e.byMethod[method]; dup { panic("router: duplicate route " + method + " " + pattern) }
+    e.byMethod[method] = access.wrap(h)
+}
+
+func (g *registrar) get(pattern string, access guard, h http.HandlerFunc)  { g.route(http.MethodGet, pattern, access, h) }
+func (g *registrar) post(pattern string, access guard, h http.HandlerFunc) { g.route(http.MethodPost, pattern, access, h) }
+func (g *registrar) del(pattern string, access guard, h http.HandlerFunc)  { g.route(http.MethodDelete, pattern, access, h) }
\ No newline at end of file
@@ -2,45 +2,107 @@ package router
 
 import (
     "net/http"
-    "path/filepath"
+    "winchannel/internal/assets"
     "winchannel/internal/handlers"
-    "winchannel/internal/paths"
+    "winchannel/internal/model"
 )
 
 func Register(mux *http.ServeMux) {
-    // Pages
-    mux.HandleFunc("/", handlers.ServeIndex)
-    mux.HandleFunc("/login", handlers.ServeLogin)
-    mux.HandleFunc("/app", handlers.ServeApp)
-    mux.HandleFunc("/users", handlers.ServeUsersPage)
+    r := newRegistrar(mux)
+
+    // Pages (they redirect on their own when not logged in)
+    r.get("/", public, handlers.ServeIndex)
+    r.get("/login", public, handlers.ServeLogin)
+    r.get("/app", public, handlers.ServeApp)
+    r.get("/users", public, handlers.ServeUsersPage)
+    r.get("/pair", public, handlers.ServePair)
 
     // Static
-    staticPath := filepath.Join(paths.BaseDir, "static")
-    mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(staticPath))))
+    mux.Handle("/static/", withRequestID(accessLog(instrument("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(assets.Static)))))))
 
     // Auth & info
-    mux.HandleFunc("/api/auth/register", handlers.AuthRegister)
-    mux.HandleFunc("/api/auth/login", handlers.AuthLogin)
-    mux.HandleFunc("/api/auth/logout", handlers.AuthLogout)
-    mux.HandleFunc("/api/auth/me", handlers.AuthMe)
-    mux.HandleFunc("/api/info", handlers.ApiInfo)
+    r.get("/api/csrf", public, handlers.AuthCSRF)
+    r.post("/api/auth/register", public, handlers.AuthRegister)
+    r.post("/api/auth/login", public, handlers.AuthLogin)
+    r.post("/api/auth/logout", public, handlers.AuthLogout)
+    r.get("/api/auth/me", public, handlers.AuthMe)
+    r.post("/api/auth/2fa/verify", public, handlers.AuthTwoFactorVerify)
+    r.get("/api/auth/2fa/status", session, handlers.AuthTwoFactorStatus)
+    r.post("/api/auth/2fa/setup", session, handlers.AuthTwoFactorSetup)
+    r.post("/api/auth/2fa/enable", session, handlers.AuthTwoFactorEnable)
+    r.post("/api/auth/2fa/disable", session, handlers.AuthTwoFactorDisable)
+    r.post("/api/auth/2fa/recovery_codes", session, handlers.AuthTwoFactorRecoveryCodes)
+    r.get("/api/info", public, handlers.ApiInfo)
+    r.get("/api/tls/ca.crt", public, handlers.TLSCACert)
+    r.get("/api/qr", public, handlers.PairQR)
+    r.post("/api/pair", session, handlers.PairCreate)
+    r.post("/api/pair/redeem", public, handlers.PairRedeem)
+
+    // Personal access tokens
+    r.get("/api/tokens", session, handlers.TokensList)
+    r.post("/api/tokens/create", session, handlers.TokensCreate)
+    r.post("/api/tokens/revoke", session, handlers.TokensRevoke)
+
+    // Devices (cookie sessions)
+    r.get("/api/devices", session, handlers.DevicesList)
+    r.post("/api/devices/rename", session, handlers.DevicesRename)
+    r.post("/api/devices/revoke", session, handlers.DevicesRevoke)
+    r.post("/api/devices/logout_all", session, handlers.DevicesLogoutAll)
 
     // Uploads
-    mux.HandleFunc("/api/uploads", handlers.ListUploads)
-    mux.HandleFunc("/api/upload", handlers.HandleUpload)
-    mux.HandleFunc("/api/upload_zip", handlers.HandleUploadZip)
-    mux.HandleFunc("/api/download/", handlers.HandleDownload)
-    mux.HandleFunc("/api/admin/upload/", handlers.AdminUploadDelete) // DELETE /api/admin/upload/{id}
-    mux.HandleFunc("/api/admin/folder/create", handlers.AdminFolderCreate)
+    r.get("/api/uploads", authed(model.ScopeDownload), handlers.ListUploads)
+    r.post("/api/upload", authed(model.ScopeUpload), handlers.HandleUpload)
+    r.post("/api/upload_zip", authed(model.ScopeUpload), handlers.HandleUploadZip)
+    r.get("/api/download/", authed(model.ScopeDownload), handlers.HandleDownload)
+    r.del("/api/admin/upload/", admin, handlers.AdminUploadDelete) // DELETE /api/admin/upload/{id}
+    r.post("/api/admin/folder/create", admin, handlers.AdminFolderCreate)
+    r.get("/api/envelopes", authed(model.ScopeDownload), handlers.UploadEnvelopes)
+
+    // End-to-end encryption keys
+    r.get("/api/keys", authed(model.ScopeDownload), handlers.KeysList)
+    r.post("/api/keys/register", authed(model.ScopeUpload), handlers.KeysRegister)
+    r.post("/api/keys/delete", authed(model.ScopeUpload), handlers.KeysDelete)
+
+    // Push transfers and realtime events
+    r.post("/api/transfers/send", authed(model.ScopeUpload), handlers.TransfersSend)
+    r.get("/api/transfers/inbox", authed(model.ScopeDownload), handlers.TransfersInbox)
+    r.get("/api/transfers/sent", authed(model.ScopeDownload), handlers.TransfersSent)
+    r.post("/api/transfers/read", authed(model.ScopeDownload), handlers.TransfersRead)
+    r.post("/api/transfers/delete", authed(model.ScopeDownload), handlers.TransfersDelete)
+    r.get("/api/events", authed(model.ScopeDownload), handlers.Events)
+
+    // Directory sync
+    r.post("/api/sync/diff", authed(model.ScopeUpload), handlers.SyncDiff)
+    r.post("/api/sync/commit", authed(model.ScopeUpload), handlers.SyncCommit)
 
     // Text state
-    mux.HandleFunc("/api/text/state", handlers.ApiTextState)
-    mux.HandleFunc("/api/text/update", handlers.ApiTextUpdate)
-    mux.HandleFunc("/api/text/history", handlers.ApiTextHistory)
-    
+    r.get("/api/text/state", authed(model.ScopeTextRead), handlers.ApiTextState)
+    r.post("/api/text/update", authed(model.ScopeTextWrite), handlers.ApiTextUpdate)
+    r.get("/api/text/history", authed(model.ScopeTextRead), handlers.ApiTextHistory)
+
+    // Clipboard history
+    r.get("/api/clipboard", authed(model.ScopeTextRead), handlers.ClipboardList)
+    r.post("/api/clipboard/push", authed(model.ScopeTextWrite), handlers.ClipboardPush)
+    r.post("/api/clipboard/pin", authed(model.ScopeTextWrite), handlers.ClipboardPin)
+    r.post("/api/clipboard/delete", authed(model.ScopeTextWrite), handlers.ClipboardDelete)
+    r.post("/api/clipboard/restore", authed(model.ScopeTextWrite), handlers.ClipboardRestore)
+
     // Admin - users
-    mux.HandleFunc("/api/admin/users", handlers.AdminUsersList)
-    mux.HandleFunc("/api/admin/users/create", handlers.AdminUsersCreate)
-    mux.HandleFunc("/api/admin/users/update_password", handlers.AdminUsersUpdatePassword)
-    mux.HandleFunc("/api/admin/users/delete", handlers.AdminUsersDelete)
+    r.get("/api/admin/users", admin, handlers.AdminUsersList)
+    r.post("/api/admin/users/create", admin, handlers.AdminUsersCreate)
+    r.post("/api/admin/users/update_password", admin, handlers.AdminUsersUpdatePassword)
+    r.post("/api/admin/users/delete", admin, handlers.AdminUsersDelete)
+    r.post("/api/admin/users/reset_2fa", admin, handlers.AdminUsersReset2FA)
+    r.get("/api/admin/security", admin, handlers.AdminSecurityGet)
+    r.post("/api/admin/security", admin, handlers.AdminSecuritySet)
+    r.get("/api/admin/lockouts", admin, handlers.AdminLockouts)
+    r.post("/api/admin/lockouts/unlock", admin, handlers.AdminLockoutsUnlock)
+    r.get("/api/admin/audit", admin, handlers.AdminAudit)
+    r.get("/api/admin/sessions", admin, handlers.AdminSessionsList)
+    r.post("/api/admin/sessions/revoke", admin, handlers.AdminSessionsRevoke)
+
+    // Monitoring
+    r.get("/healthz", public, handlers.Healthz)
+    r.get("/readyz", public, handlers.Readyz)
+    r.get("/metrics", metricsAccess, handlers.Metrics)
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package service
+
+import (
+    "net/http"
+    "strings"
+    "time"
+    "unicode/utf8"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+    "winchannel/internal/util"
+)
+
+// Audit records action on target by the caller's session. Failures to write
+// are logged but never fail the request.
+func Audit(r *http.Request, action, target, result string, details map[string]interface{}) {
+    actor := ""
+    if s, ok := GetSession(r); ok { actor = s.Username }
+    AuditAs(r, actor, action, target, result, details)
+}
+
+// maxAuditField bounds client-supplied audit fields so one request cannot
+// write an entry too long to read back.
+const maxAuditField = 512
+
+// clipField cuts v to at most maxAuditField bytes on a rune boundary.
+func clipField(v string) string {
+    if len(v) <= maxAuditField { return v }
+    n := maxAuditField
+    for n > 0 && !utf8.RuneStart(v[n]) { n-- }
+    return v[:n] + "…"
+}
+
+// AuditAs is Audit with an explicit actor, for requests made before a session
+// exists (login, registration).
+func AuditAs(r *http.Request, actor, action, target, result string, details map[string]interface{}) {
+    e := model.AuditEntry{
+        Time:      time.Now().UTC(),
+        Actor:     clipField(actor),
+        IP:        util.ClientIP(r),
+        UserAgent: clipField(r.UserAgent()),
+        Action:    action,
+        Target:    clipField(target),
+        Result:    result,
+        RequestID: util.RequestID(r),
+        Details:   details,
+    }
+    if s, ok := GetSession(r); ok && s.TokenID != "" {
+        if e.Details == nil { e.Details = map[string]interface{}{} }
+        e.Details["token_id"] = s.TokenID
+    }
+    if err := dao.AppendAudit(e); err != nil { util.Logger(r).Error("audit write failed", "action", action, "err", err) }
+}
+
+// AuditFilter selects entries for QueryAudit. Zero values match everything;
+// Action matches as a prefix so "auth." selects all auth events.
+type AuditFilter struct {
+    Actor  string
+    Action string
+    Result string
+    Since  time.Time
+    Until  time.Time
+}
+
+func (f AuditFilter) match(e model.AuditEntry) bool {
+    if f.Actor != "" && e.Actor != f.Actor { return false }
+    if f.Action != "" && !strings.HasPrefix(e.Action, f.Action) { return false }
+    if f.Result != "" && e.Result != f.Result { return false }
+    if !f.Since.IsZero() && e.Time.Before(f.Since) { return false }
+    if !f.Until.IsZero() && !e.Time.Before(f.Until) { return false }
+    return true
+}
+
+// QueryAudit returns matching entries in chronological order. With limit > 0
+// only the most recent limit entries are kept.
+func QueryAudit(f AuditFilter, limit int) ([]model.AuditEntry, error) {
+    var out []model.AuditEntry
+    err := dao.ScanAudit(func(e model.AuditEntry) bool {
+        if !f.match(e) { return true }
+        out = append(out, e)
+        if limit > 0 && len(out) > 2*limit { out = append(out[:0], out[len(out)-limit:]...) }
+        return true
+    })
+    if limit > 0 && len(out) > limit { out = out[len(out)-limit:] }
+    return out, err
+}
+
+// ScanAuditFiltered streams matching entries to fn in file order, for exports
+// that should not buffer the whole log.
+func ScanAuditFiltered(f AuditFilter, fn func(model.AuditEntry) bool) error {
+    return dao.ScanAudit(func(e model.AuditEntry) bool {
+        if !f.match(e) { return true }
+        return fn(e)
+    })
+}
\ No newline at end of file
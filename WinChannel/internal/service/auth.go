@@ -5,11 +5,16 @@ import (
     "encoding/hex"
     "net/http"
     "time"
+    "winchannel/internal/config"
     "winchannel/internal/model"
+    "winchannel/internal/util"
 )
 
 const SessionCookie = "SESSION"
 
+// MaxUsernameLen bounds usernames at registration and login.
+const MaxUsernameLen = 64
+
 var Sessions = &model.SessionStore{M: map[string]model.Session{}}
 
 func RandToken(n int) (string, error) {
@@ -20,17 +25,33 @@ func RandToken(n int) (string, error) {
     return hex.EncodeToString(b), nil
 }
 
-func SetSession(w http.ResponseWriter, username, role string) error {
+// secureCookies marks cookies Secure when the server itself speaks HTTPS.
+func secureCookies() bool { return config.Get().TLS.Enabled }
+
+// SetSession starts a cookie session for username on the device that sent r.
+func SetSession(w http.ResponseWriter, r *http.Request, username, role string) error {
     tok, err := RandToken(32)
     if err != nil { return err }
-    s := model.Session{Username: username, Role: role, Expires: time.Now().Add(30 * 24 * time.Hour)}
-    Sessions.Mu.Lock(); Sessions.M[tok] = s; Sessions.Mu.Unlock()
+    now := time.Now()
+    s := model.Session{
+        Username:  username,
+        Role:      role,
+        Expires:   now.Add(30 * 24 * time.Hour),
+        Device:    deviceName(r),
+        UserAgent: r.UserAgent(),
+        IP:        util.ClientIP(r),
+        Created:   now,
+        LastSeen:  now,
+    }
+    Sessions.Mu.Lock(); Sessions.M[model.SessionKey(tok)] = s; Sessions.Mu.Unlock()
+    if _, err := IssueCSRFToken(w); err != nil { return err }
     http.SetCookie(w, &http.Cookie{
         Name:     SessionCookie,
         Value:    tok,
         Path:     "/",
         HttpOnly: true,
         SameSite: http.SameSiteLaxMode,
+        Secure:   secureCookies(),
         Expires:  s.Expires,
     })
     return nil
@@ -38,7 +59,7 @@ func SetSession(w http.ResponseWriter, username, role string) error {
 
 func ClearSession(w http.ResponseWriter, r *http.Request) {
     if c, err := r.Cookie(SessionCookie); err == nil {
-        Sessions.Mu.Lock(); delete(Sessions.M, c.Value); Sessions.Mu.Unlock()
+        Sessions.Mu.Lock(); delete(Sessions.M, model.SessionKey(c.Value)); Sessions.Mu.Unlock()
     }
     http.SetCookie(w, &http.Cookie{
         Name:     SessionCookie,
@@ -46,28 +67,48 @@ func ClearSession(w http.ResponseWriter, r *http.Request) {
         Path:     "/",
         HttpOnly: true,
         SameSite: http.SameSiteLaxMode,
+        Secure:   secureCookies(),
         Expires:  time.Unix(0, 0),
         MaxAge:   -1,
     })
 }
 
+// GetSession resolves the caller from a bearer token if one is presented,
+// otherwise from the SESSION cookie.
 func GetSession(r *http.Request) (model.Session, bool) {
+    if tok, ok := BearerToken(r); ok { return LookupToken(tok) }
     c, err := r.Cookie(SessionCookie)
     if err != nil { return model.Session{}, false }
-    Sessions.Mu.Lock(); s, ok := Sessions.M[c.Value]
-    if ok && time.Now().After(s.Expires) { delete(Sessions.M, c.Value); ok = false }
+    now := time.Now()
+    key := model.SessionKey(c.Value)
+    Sessions.Mu.Lock(); s, ok := Sessions.M[key]
+    if ok && now.After(s.Expires) { delete(Sessions.M, key); ok = false }
+    if ok && now.Sub(s.LastSeen) >= lastSeenResolution {
+        s.LastSeen, s.IP = now, util.ClientIP(r)
+        Sessions.M[key] = s
+    }
     Sessions.Mu.Unlock()
     return s, ok
 }
 
+// ActiveSessions counts unexpired cookie sessions.
+func ActiveSessions() int {
+    now := time.Now()
+    n := 0
+    Sessions.Mu.Lock()
+    for _, s := range Sessions.M { if now.Before(s.Expires) { n++ } }
+    Sessions.Mu.Unlock()
+    return n
+}
+
 func IsAdmin(r *http.Request) bool {
     s, ok := GetSession(r)
-    return ok && s.Role == "admin"
+    return ok && s.Role == "admin" && HasScope(s, model.ScopeAdmin)
 }
 
 func RequireAuth(w http.ResponseWriter, r *http.Request) bool {
     if _, ok := GetSession(r); !ok {
-        http.Error(w, "unauthorized", http.StatusUnauthorized)
+        util.WriteError(w, r, http.StatusUnauthorized, util.CodeUnauthorized, "login required")
         return false
     }
     return true
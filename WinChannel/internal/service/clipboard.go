@@ -0,0 +1,137 @@
+package service
+
+import (
+    "errors"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+    "winchannel/internal/config"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+)
+
+const (
+    maxSnippetBytes = 1 << 20
+    // snippetOverhead approximates what a snippet adds to clipboard.json
+    // besides its content.
+    snippetOverhead = 512
+)
+
+var (
+    ErrSnippetEmpty    = errors.New("content must be 1 byte to 1 MiB")
+    ErrSnippetNotFound = errors.New("snippet not found")
+    ErrClipboardFull   = errors.New("pinned snippets fill the clipboard history; unpin or delete some")
+)
+
+func snippetCost(s model.Snippet) int { return len(s.Content) + snippetOverhead }
+
+func clipboardMaxBytes() int { return config.Get().ClipboardMaxMB << 20 }
+
+// snippetSource names where a push came from: the device of a cookie
+// session, or the API token used.
+func snippetSource(r *http.Request) (model.Session, string) {
+    s, _ := GetSession(r)
+    if s.TokenID != "" { return s, "token " + s.TokenID }
+    return s, s.Device
+}
+
+// PushSnippet records content in the clipboard history. Pushing the same
+// content as the newest entry refreshes that entry instead of adding a copy.
+// With env, content is client-side ciphertext.
+func PushSnippet(r *http.Request, content string, env *model.Envelope, clientID string) (model.Snippet, error) {
+    if content == "" || len(content) > maxSnippetBytes { return model.Snippet{}, ErrSnippetEmpty }
+    if err := ValidateSealed(env, content); err != nil { return model.Snippet{}, err }
+    s, source := snippetSource(r)
+    now := time.Now().UTC()
+    dao.Clipboard.Mu.Lock()
+    defer dao.Clipboard.Mu.Unlock()
+    items := dao.Clipboard.Items
+    if n := len(items); n > 0 && items[n-1].Content == content {
+        last := &items[n-1]
+        last.CreatedAt, last.Username, last.Source, last.ClientID = now, s.Username, source, clientID
+        return *last, dao.SaveClipboard()
+    }
+    id, err := RandToken(8)
+    if err != nil { return model.Snippet{}, err }
+    sn := model.Snippet{ID: id, Content: content, Envelope: env, Username: s.Username, Source: source, ClientID: clientID, CreatedAt: now}
+    pinned := snippetCost(sn)
+    for _, it := range items { if it.Pinned { pinned += snippetCost(it) } }
+    if pinned > clipboardMaxBytes() { return model.Snippet{}, ErrClipboardFull }
+    dao.Clipboard.Items = pruneSnippets(append(items, sn), config.Get().ClipboardMaxItems, clipboardMaxBytes())
+    return sn, dao.SaveClipboard()
+}
+
+// pruneSnippets drops the oldest unpinned snippets while there are more than
+// max of them or all snippets, pinned ones included, take over maxBytes.
+func pruneSnippets(items []model.Snippet, max, maxBytes int) []model.Snippet {
+    unpinned, size := 0, 0
+    for _, it := range items {
+        size += snippetCost(it)
+        if !it.Pinned { unpinned++ }
+    }
+    if unpinned <= max && size <= maxBytes { return items }
+    out := items[:0]
+    for _, it := range items {
+        if !it.Pinned && (unpinned > max || size > maxBytes) { unpinned--; size -= snippetCost(it); continue }
+        out = append(out, it)
+    }
+    return out
+}
+
+// ListSnippets returns pinned snippets first, then the rest newest first.
+// query filters by case-insensitive substring of content or source; the
+// content of encrypted snippets is never searched.
+func ListSnippets(query string, pinnedOnly bool, limit int) []model.Snippet {
+    q := strings.ToLower(query)
+    out := []model.Snippet{}
+    dao.Clipboard.Mu.Lock()
+    for _, it := range dao.Clipboard.Items {
+        if pinnedOnly && !it.Pinned { continue }
+        if q != "" && (it.Envelope != nil || !strings.Contains(strings.ToLower(it.Content), q)) && !strings.Contains(strings.ToLower(it.Source), q) { continue }
+        out = append(out, it)
+    }
+    dao.Clipboard.Mu.Unlock()
+    sort.SliceStable(out, func(i, j int) bool {
+        if out[i].Pinned != out[j].Pinned { return out[i].Pinned }
+        return out[i].CreatedAt.After(out[j].CreatedAt)
+    })
+    if limit > 0 && len(out) > limit { out = out[:limit] }
+    return out
+}
+
+// GetSnippet looks a snippet up by ID.
+func GetSnippet(id string) (model.Snippet, bool) {
+    dao.Clipboard.Mu.Lock()
+    defer dao.Clipboard.Mu.Unlock()
+    for _, it := range dao.Clipboard.Items { if it.ID == id { return it, true } }
+    return model.Snippet{}, false
+}
+
+// PinSnippet pins or unpins id. Unpinning may evict it (or older entries)
+// if the history is over the cap.
+func PinSnippet(id string, pinned bool) (model.Snippet, error) {
+    dao.Clipboard.Mu.Lock()
+    defer dao.Clipboard.Mu.Unlock()
+    for i := range dao.Clipboard.Items {
+        if dao.Clipboard.Items[i].ID != id { continue }
+        dao.Clipboard.Items[i].Pinned = pinned
+        sn := dao.Clipboard.Items[i]
+        dao.Clipboard.Items = pruneSnippets(dao.Clipboard.Items, config.Get().ClipboardMaxItems, clipboardMaxBytes())
+        return sn, dao.SaveClipboard()
+    }
+    return model.Snippet{}, ErrSnippetNotFound
+}
+
+// DeleteSnippet removes id from the history.
+func DeleteSnippet(id string) error {
+    dao.Clipboard.Mu.Lock()
+    defer dao.Clipboard.Mu.Unlock()
+    for i, it := range dao.Clipboard.Items {
+        if it.ID == id {
+            dao.Clipboard.Items = append(dao.Clipboard.Items[:i], dao.Clipboard.Items[i+1:]...)
+            return dao.SaveClipboard()
+        }
+    }
+    return ErrSnippetNotFound
+}
\ No newline at end of file
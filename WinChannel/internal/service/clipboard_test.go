@@ -0,0 +1,37 @@
+package service
+
+import (
+    "strings"
+    "testing"
+    "winchannel/internal/model"
+)
+
+func TestPruneSnippets(t *testing.T) {
+    big := strings.Repeat("x", 1000)
+    items := []model.Snippet{
+        {ID: "pinned-old", Content: big, Pinned: true},
+        {ID: "a", Content: big},
+        {ID: "b", Content: big},
+        {ID: "c", Content: big},
+    }
+    ids := func(list []model.Snippet) string {
+        var s []string
+        for _, it := range list { s = append(s, it.ID) }
+        return strings.Join(s, ",")
+    }
+    cost := len(big) + snippetOverhead
+    cases := []struct {
+        max, maxBytes int
+        want          string
+    }{
+        {10, 10 * cost, "pinned-old,a,b,c"},
+        {2, 10 * cost, "pinned-old,b,c"},
+        // the pinned snippet counts toward the byte cap but is never dropped
+        {10, 2 * cost, "pinned-old,c"},
+        {10, cost, "pinned-old"},
+    }
+    for _, tc := range cases {
+        got := pruneSnippets(append([]model.Snippet(nil), items...), tc.max, tc.maxBytes)
+        if ids(got) != tc.want { t.Errorf("max %d, maxBytes %d: kept %s, want %s", tc.max, tc.maxBytes, ids(got), tc.want) }
+    }
+}
\ No newline at end of file
@@ -0,0 +1,35 @@
+package service
+
+import (
+    "net/http"
+    "time"
+)
+
+const (
+    // CSRFCookie is readable by scripts so the page can echo it back in
+    // CSRFHeader (double-submit).
+    CSRFCookie = "CSRF_TOKEN"
+    CSRFHeader = "X-CSRF-Token"
+)
+
+// EnsureCSRFToken returns the caller's CSRF token, issuing a new cookie when
+// the request does not carry one.
+func EnsureCSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+    if c, err := r.Cookie(CSRFCookie); err == nil && len(c.Value) == 64 { return c.Value, nil }
+    return IssueCSRFToken(w)
+}
+
+// IssueCSRFToken always rotates the token, e.g. on login.
+func IssueCSRFToken(w http.ResponseWriter) (string, error) {
+    tok, err := RandToken(32)
+    if err != nil { return "", err }
+    http.SetCookie(w, &http.Cookie{
+        Name:     CSRFCookie,
+        Value:    tok,
+        Path:     "/",
+        SameSite: http.SameSiteStrictMode,
+        Secure:   secureCookies(),
+        Expires:  time.Now().Add(30 * 24 * time.Hour),
+    })
+    return tok, nil
+}
\ No newline at end of file
@@ -0,0 +1,133 @@
+package service
+
+import (
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+    "winchannel/internal/model"
+)
+
+const (
+    // DeviceNameHeader lets non-browser clients name themselves at login.
+    DeviceNameHeader = "X-Device-Name"
+    maxDeviceName    = 64
+
+    // lastSeenResolution bounds how often a session's last-seen time and IP
+    // are rewritten.
+    lastSeenResolution = time.Minute
+)
+
+// keyID is the public identifier of the session stored under key.
+func keyID(key string) string { return key[:16] }
+
+// currentSessionKey returns the store key of the cookie session r was made
+// with, or "" for bearer tokens.
+func currentSessionKey(r *http.Request) string {
+    if _, ok := BearerToken(r); ok { return "" }
+    c, err := r.Cookie(SessionCookie)
+    if err != nil { return "" }
+    return model.SessionKey(c.Value)
+}
+
+// CurrentSessionID returns the ID of the cookie session r was made with, or
+// "" for bearer tokens.
+func CurrentSessionID(r *http.Request) string {
+    if key := currentSessionKey(r); key != "" { return keyID(key) }
+    return ""
+}
+
+func cleanDeviceName(name string) string {
+    name = strings.Join(strings.Fields(name), " ")
+    if len(name) > maxDeviceName { name = name[:maxDeviceName] }
+    return name
+}
+
+// deviceName uses the X-Device-Name header when present, otherwise a
+// "browser on OS" label guessed from the User-Agent.
+func deviceName(r *http.Request) string {
+    if n := cleanDeviceName(r.Header.Get(DeviceNameHeader)); n != "" { return n }
+    ua := r.UserAgent()
+    pick := func(table [][2]string) string {
+        for _, e := range table { if strings.Contains(ua, e[0]) { return e[1] } }
+        return ""
+    }
+    app := pick([][2]string{
+        {"winchannel-cli", "winchannel-cli"}, {"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+        {"CriOS/", "Chrome"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"}, {"Go-http-client", "Go client"},
+    })
+    platform := pick([][2]string{
+        {"iPhone", "iPhone"}, {"iPad", "iPad"}, {"Android", "Android"}, {"Windows", "Windows"},
+        {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+    })
+    switch {
+    case app != "" && platform != "": return app + " on " + platform
+    case app != "": return app
+    case platform != "": return platform
+    }
+    return "Unknown device"
+}
+
+// ListDevices returns the live cookie sessions of username, or of every user
+// when username is "". The session r was made with is marked current.
+func ListDevices(r *http.Request, username string) []model.Device {
+    cur := currentSessionKey(r)
+    now := time.Now()
+    out := []model.Device{}
+    Sessions.Mu.Lock()
+    for key, s := range Sessions.M {
+        if s.TokenID != "" || now.After(s.Expires) || username != "" && s.Username != username { continue }
+        out = append(out, model.Device{
+            ID: keyID(key), Username: s.Username, Role: s.Role, Name: s.Device, UserAgent: s.UserAgent, IP: s.IP,
+            CreatedAt: s.Created, LastSeen: s.LastSeen, ExpiresAt: s.Expires, Current: key == cur,
+        })
+    }
+    Sessions.Mu.Unlock()
+    sort.Slice(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+    return out
+}
+
+// findSession returns the store key of session id, limited to username
+// unless username is "". The caller holds Sessions.Mu.
+func findSession(username, id string) (string, bool) {
+    for key, s := range Sessions.M {
+        if keyID(key) == id && (username == "" || s.Username == username) { return key, true }
+    }
+    return "", false
+}
+
+// RevokeDevice ends session id. username restricts the lookup to that
+// user's sessions; admins pass "".
+func RevokeDevice(username, id string) (model.Session, bool) {
+    Sessions.Mu.Lock()
+    defer Sessions.Mu.Unlock()
+    key, ok := findSession(username, id)
+    if !ok { return model.Session{}, false }
+    s := Sessions.M[key]
+    delete(Sessions.M, key)
+    return s, true
+}
+
+// RenameDevice sets the display name of one of username's sessions.
+func RenameDevice(username, id, name string) bool {
+    Sessions.Mu.Lock()
+    defer Sessions.Mu.Unlock()
+    key, ok := findSession(username, id)
+    if !ok { return false }
+    s := Sessions.M[key]
+    s.Device = cleanDeviceName(name)
+    Sessions.M[key] = s
+    return true
+}
+
+// RevokeUserSessions signs username out of every device except the session
+// with ID keep (if any) and reports how many sessions were ended.
+func RevokeUserSessions(username, keep string) int {
+    n := 0
+    Sessions.Mu.Lock()
+    for key, s := range Sessions.M {
+        if s.Username == username && s.TokenID == "" && keyID(key) != keep { delete(Sessions.M, key); n++ }
+    }
+    Sessions.Mu.Unlock()
+    return n
+}
\ No newline at end of file
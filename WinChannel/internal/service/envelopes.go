@@ -0,0 +1,224 @@
+package service
+
+import (
+    "crypto/ecdh"
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "path/filepath"
+    "sort"
+    "strings"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+    "winchannel/internal/paths"
+)
+
+const (
+    maxEnvelopeRecipients = 32
+    maxWrappedKeyBytes    = 1024
+    maxKeysPerUser        = 20
+    gcmTagSize            = 16
+)
+
+var (
+    ErrEnvelope          = errors.New("invalid envelope")
+    ErrPublicKey         = errors.New("invalid public key")
+    ErrPublicKeyNotFound = errors.New("public key not found")
+)
+
+func envelopeErr(format string, args ...interface{}) error {
+    return fmt.Errorf("%w: %s", ErrEnvelope, fmt.Sprintf(format, args...))
+}
+
+func decodeB64(s string) ([]byte, bool) {
+    b, err := base64.StdEncoding.DecodeString(s)
+    return b, err == nil
+}
+
+// validKeyID accepts 1-128 printable ASCII characters without spaces.
+func validKeyID(id string) bool {
+    if id == "" || len(id) > 128 { return false }
+    for i := 0; i < len(id); i++ {
+        if id[i] <= ' ' || id[i] > '~' { return false }
+    }
+    return true
+}
+
+// ValidateEnvelope checks that e names a supported cipher with a nonce of the
+// right size, and that every recipient is a registered public key.
+func ValidateEnvelope(e *model.Envelope) error {
+    n, ok := model.EnvelopeNonceSizes[e.Alg]
+    if !ok { return envelopeErr("unsupported alg %q", e.Alg) }
+    if !validKeyID(e.KeyID) { return envelopeErr("kid must be 1-128 printable characters") }
+    if b, ok := decodeB64(e.Nonce); !ok || len(b) != n { return envelopeErr("nonce must be %d bytes of base64 for %s", n, e.Alg) }
+    if e.Salt != "" {
+        if b, ok := decodeB64(e.Salt); !ok || len(b) < 8 || len(b) > 64 { return envelopeErr("salt must be 8-64 bytes of base64") }
+    }
+    if len(e.Recipients) > maxEnvelopeRecipients { return envelopeErr("at most %d recipients", maxEnvelopeRecipients) }
+    for _, rc := range e.Recipients {
+        if _, ok := LookupPublicKey(rc.KeyID); !ok { return envelopeErr("recipient %q is not a registered public key", rc.KeyID) }
+        if b, ok := decodeB64(rc.WrappedKey); !ok || len(b) == 0 || len(b) > maxWrappedKeyBytes { return envelopeErr("wrapped_key for %q must be 1-%d bytes of base64", rc.KeyID, maxWrappedKeyBytes) }
+    }
+    return nil
+}
+
+// ValidateSealed checks inline content against its envelope: with one, the
+// content must be base64 ciphertext long enough to hold the tag. A nil
+// envelope means plaintext and always passes.
+func ValidateSealed(e *model.Envelope, content string) error {
+    if e == nil { return nil }
+    if err := ValidateEnvelope(e); err != nil { return err }
+    if b, ok := decodeB64(content); !ok || len(b) < gcmTagSize { return envelopeErr("content must be base64 ciphertext") }
+    return nil
+}
+
+// RegisterPublicKey stores a device public key (base64 SPKI DER) for
+// username. Registering the same key again returns the existing entry.
+func RegisterPublicKey(username, device, alg, key string) (model.PublicKey, error) {
+    der, ok := decodeB64(strings.TrimSpace(key))
+    if !ok || len(der) == 0 { return model.PublicKey{}, fmt.Errorf("%w: key must be base64 SPKI DER", ErrPublicKey) }
+    pub, err := x509.ParsePKIXPublicKey(der)
+    if err != nil { return model.PublicKey{}, fmt.Errorf("%w: %v", ErrPublicKey, err) }
+    if !publicKeyMatches(alg, pub) { return model.PublicKey{}, fmt.Errorf("%w: key is not a %s key", ErrPublicKey, alg) }
+    sum := sha256.Sum256(der)
+    id := hex.EncodeToString(sum[:16])
+
+    dao.PublicKeys.Mu.Lock()
+    defer dao.PublicKeys.Mu.Unlock()
+    if old, ok := dao.PublicKeys.M[id]; ok {
+        if old.Username != username { return model.PublicKey{}, fmt.Errorf("%w: key is registered to another user", ErrPublicKey) }
+        return old, nil
+    }
+    n := 0
+    for _, k := range dao.PublicKeys.M { if k.Username == username { n++ } }
+    if n >= maxKeysPerUser { return model.PublicKey{}, fmt.Errorf("%w: at most %d keys per user", ErrPublicKey, maxKeysPerUser) }
+    pk := model.PublicKey{ID: id, Username: username, Device: cleanDeviceName(device), Alg: alg, Key: base64.StdEncoding.EncodeToString(der), CreatedAt: time.Now().UTC()}
+    dao.PublicKeys.M[id] = pk
+    return pk, dao.SavePublicKeys()
+}
+
+func publicKeyMatches(alg string, pub interface{}) bool {
+    switch k := pub.(type) {
+    case *ecdsa.PublicKey:
+        return alg == model.PublicKeyECDHP256 && k.Curve == elliptic.P256()
+    case *ecdh.PublicKey:
+        return alg == model.PublicKeyX25519 && k.Curve() == ecdh.X25519()
+    case *rsa.PublicKey:
+        return alg == model.PublicKeyRSAOAEP256 && k.N.BitLen() >= 2048
+    }
+    return false
+}
+
+// LookupPublicKey returns the registered key with id.
+func LookupPublicKey(id string) (model.PublicKey, bool) {
+    dao.PublicKeys.Mu.Lock()
+    defer dao.PublicKeys.Mu.Unlock()
+    k, ok := dao.PublicKeys.M[id]
+    return k, ok
+}
+
+// ListPublicKeys returns the keys of username, or of everyone when empty,
+// oldest first.
+func ListPublicKeys(username string) []model.PublicKey {
+    out := []model.PublicKey{}
+    dao.PublicKeys.Mu.Lock()
+    for _, k := range dao.PublicKeys.M {
+        if username == "" || k.Username == username { out = append(out, k) }
+    }
+    dao.PublicKeys.Mu.Unlock()
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    return out
+}
+
+// DeletePublicKey removes key id, which must belong to owner unless owner
+// is empty.
+func DeletePublicKey(owner, id string) error {
+    dao.PublicKeys.Mu.Lock()
+    defer dao.PublicKeys.Mu.Unlock()
+    k, ok := dao.PublicKeys.M[id]
+    if !ok || (owner != "" && k.Username != owner) { return ErrPublicKeyNotFound }
+    delete(dao.PublicKeys.M, id)
+    return dao.SavePublicKeys()
+}
+
+// DeleteUserPublicKeys removes every key of username.
+func DeleteUserPublicKeys(username string) error {
+    dao.PublicKeys.Mu.Lock()
+    defer dao.PublicKeys.Mu.Unlock()
+    n := len(dao.PublicKeys.M)
+    for id, k := range dao.PublicKeys.M {
+        if k.Username == username { delete(dao.PublicKeys.M, id) }
+    }
+    if len(dao.PublicKeys.M) == n { return nil }
+    return dao.SavePublicKeys()
+}
+
+// envelopeKey names an upload file by its slash path under the uploads
+// directory.
+func envelopeKey(path string) (string, bool) {
+    rel, err := filepath.Rel(paths.UploadsDir, path)
+    if err != nil || rel == "." || strings.HasPrefix(rel, "..") { return "", false }
+    return filepath.ToSlash(rel), true
+}
+
+// SetFileEnvelope records e for the upload file at path; nil marks the file
+// as plaintext.
+func SetFileEnvelope(path string, e *model.Envelope) error {
+    key, ok := envelopeKey(path)
+    if !ok { return nil }
+    dao.Envelopes.Mu.Lock()
+    defer dao.Envelopes.Mu.Unlock()
+    if e == nil {
+        if _, had := dao.Envelopes.M[key]; !had { return nil }
+        delete(dao.Envelopes.M, key)
+    } else {
+        dao.Envelopes.M[key] = *e
+    }
+    return dao.SaveEnvelopes()
+}
+
+// FileEnvelope returns the envelope of the upload file at path.
+func FileEnvelope(path string) (model.Envelope, bool) {
+    key, ok := envelopeKey(path)
+    if !ok { return model.Envelope{}, false }
+    dao.Envelopes.Mu.Lock()
+    defer dao.Envelopes.Mu.Unlock()
+    e, ok := dao.Envelopes.M[key]
+    return e, ok
+}
+
+// FileEnvelopes returns the envelopes of files under dir keyed by slash path
+// relative to it.
+func FileEnvelopes(dir string) map[string]model.Envelope {
+    out := map[string]model.Envelope{}
+    prefix, ok := envelopeKey(dir)
+    if !ok { return out }
+    prefix += "/"
+    dao.Envelopes.Mu.Lock()
+    for k, e := range dao.Envelopes.M {
+        if strings.HasPrefix(k, prefix) { out[strings.TrimPrefix(k, prefix)] = e }
+    }
+    dao.Envelopes.Mu.Unlock()
+    return out
+}
+
+// DropEnvelopes forgets the envelopes of path and everything below it.
+func DropEnvelopes(path string) error {
+    key, ok := envelopeKey(path)
+    if !ok { return nil }
+    dao.Envelopes.Mu.Lock()
+    defer dao.Envelopes.Mu.Unlock()
+    n := len(dao.Envelopes.M)
+    for k := range dao.Envelopes.M {
+        if k == key || strings.HasPrefix(k, key+"/") { delete(dao.Envelopes.M, k) }
+    }
+    if len(dao.Envelopes.M) == n { return nil }
+    return dao.SaveEnvelopes()
+}
\ No newline at end of file
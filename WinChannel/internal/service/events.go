@@ -0,0 +1,79 @@
+package service
+
+import (
+    "sync"
+)
+
+// Event is a notification pushed to connected clients over /api/events.
+type Event struct {
+    Type string
+    Data interface{}
+}
+
+// Event types.
+const (
+    EventTransfer        = "transfer"         // a new item arrived in the inbox
+    EventTransferReceipt = "transfer.receipt" // a sent item was delivered or read
+)
+
+// eventBuffer is how many undelivered events a slow subscriber may queue
+// before further events to it are dropped.
+const eventBuffer = 16
+
+// Subscription receives the events addressed to one user, or to one of
+// their devices. C is closed when the server shuts down.
+type Subscription struct {
+    C        <-chan Event
+    ch       chan Event
+    username string
+    device   string // session ID; "" for bearer-token clients
+}
+
+var hub = struct {
+    Mu     sync.Mutex
+    subs   map[*Subscription]struct{}
+    closed bool
+}{subs: map[*Subscription]struct{}{}}
+
+// Subscribe registers a listener for username on device.
+func Subscribe(username, device string) *Subscription {
+    ch := make(chan Event, eventBuffer)
+    s := &Subscription{C: ch, ch: ch, username: username, device: device}
+    hub.Mu.Lock()
+    if hub.closed { close(ch) } else { hub.subs[s] = struct{}{} }
+    hub.Mu.Unlock()
+    return s
+}
+
+// Unsubscribe removes s; it is safe to call after CloseEvents.
+func Unsubscribe(s *Subscription) {
+    hub.Mu.Lock()
+    if _, ok := hub.subs[s]; ok { delete(hub.subs, s); close(s.ch) }
+    hub.Mu.Unlock()
+}
+
+// Publish sends ev to username's subscribers. A non-empty device limits it
+// to that device (bearer-token subscribers, which have no device, receive
+// everything for their user). It reports how many subscribers took the event.
+func Publish(username, device string, ev Event) int {
+    n := 0
+    hub.Mu.Lock()
+    for s := range hub.subs {
+        if s.username != username || device != "" && s.device != "" && s.device != device { continue }
+        select {
+        case s.ch <- ev: n++
+        default:
+        }
+    }
+    hub.Mu.Unlock()
+    return n
+}
+
+// CloseEvents ends every subscription so streaming responses return and the
+// server can drain.
+func CloseEvents() {
+    hub.Mu.Lock()
+    hub.closed = true
+    for s := range hub.subs { delete(hub.subs, s); close(s.ch) }
+    hub.Mu.Unlock()
+}
\ No newline at end of file
@@ -0,0 +1,62 @@
+package service
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync/atomic"
+    "winchannel/internal/dao"
+    "winchannel/internal/paths"
+)
+
+var draining atomic.Bool
+
+// SetDraining marks the server as shutting down so /readyz fails and load
+// balancers stop sending new work.
+func SetDraining(v bool) { draining.Store(v) }
+
+func Draining() bool { return draining.Load() }
+
+// CheckStorage verifies every storage directory exists and is writable by
+// creating and removing a probe file.
+func CheckStorage() error {
+    for _, d := range []string{paths.StorageDir, paths.UploadsDir, paths.TextDir} {
+        f, err := os.CreateTemp(d, ".probe-*")
+        if err != nil { return fmt.Errorf("%s not writable", filepath.Base(d)) }
+        name := f.Name()
+        f.Close()
+        if err := os.Remove(name); err != nil { return fmt.Errorf("%s not writable", filepath.Base(d)) }
+    }
+    return nil
+}
+
+// CleanPartialUploads removes temp files whose name starts with prefix under
+// the uploads directory. Only call it when no upload is in flight: at startup
+// or after the server has drained.
+func CleanPartialUploads(prefix string) (int, error) {
+    n := 0
+    err := filepath.Walk(paths.UploadsDir, func(p string, fi os.FileInfo, err error) error {
+        if err != nil { return nil }
+        if !fi.IsDir() && strings.HasPrefix(fi.Name(), prefix) {
+            if os.Remove(p) == nil { n++ }
+        }
+        return nil
+    })
+    return n, err
+}
+
+// FlushState writes all in-memory state that is otherwise only persisted on
+// change, plus the session table.
+func FlushState() error {
+    var errs []error
+    if err := dao.SaveUsers(); err != nil { errs = append(errs, fmt.Errorf("users: %w", err)) }
+    if err := dao.SaveTokens(); err != nil { errs = append(errs, fmt.Errorf("tokens: %w", err)) }
+    dao.TwoFactor.Mu.Lock()
+    if err := dao.SaveTwoFactor(); err != nil { errs = append(errs, fmt.Errorf("twofactor: %w", err)) }
+    dao.TwoFactor.Mu.Unlock()
+    if err := dao.SaveSessions(Sessions); err != nil { errs = append(errs, fmt.Errorf("sessions: %w", err)) }
+    if err := dao.SaveTransfers(); err != nil { errs = append(errs, fmt.Errorf("transfers: %w", err)) }
+    return errors.Join(errs...)
+}
\ No newline at end of file
@@ -0,0 +1,158 @@
+package service
+
+import (
+    "math"
+    "sort"
+    "sync"
+    "time"
+    "winchannel/internal/config"
+)
+
+// LoginAttempts tracks consecutive failures for one account or client IP.
+type LoginAttempts struct {
+    Key          string    `json:"key"`
+    Failures     int       `json:"failures"`
+    LastFailure  time.Time `json:"last_failure"`
+    BlockedUntil time.Time `json:"blocked_until"`
+    Locked       bool      `json:"locked"`
+}
+
+type attemptTable struct {
+    Mu sync.Mutex
+    M  map[string]*LoginAttempts
+}
+
+var (
+    accountAttempts = &attemptTable{M: map[string]*LoginAttempts{}}
+    ipAttempts      = &attemptTable{M: map[string]*LoginAttempts{}}
+)
+
+const (
+    freeAccountFailures = 3
+    freeIPFailures      = 5
+    backoffBase         = time.Second
+    backoffMax          = 5 * time.Minute
+    // failures older than this are forgotten
+    attemptWindow = time.Hour
+    // each table holds at most this many keys; see attemptTable.fail
+    maxAttemptKeys = 10000
+)
+
+func lockoutThreshold() int { return config.Get().Login.MaxFailures }
+
+func lockoutDuration() time.Duration { return time.Duration(config.Get().Login.LockoutMinutes) * time.Minute }
+
+// backoff returns the delay imposed after the given number of failures once
+// the free allowance is used up: 1s, 2s, 4s, ... capped at backoffMax.
+func backoff(failures, free int) time.Duration {
+    if failures <= free { return 0 }
+    d := time.Duration(float64(backoffBase) * math.Pow(2, float64(failures-free-1)))
+    if d > backoffMax || d <= 0 { return backoffMax }
+    return d
+}
+
+func (t *attemptTable) blockedFor(key string, now time.Time) time.Duration {
+    t.Mu.Lock()
+    defer t.Mu.Unlock()
+    a, ok := t.M[key]
+    if !ok { return 0 }
+    if expired(a, now) { delete(t.M, key); return 0 }
+    if now.Before(a.BlockedUntil) { return a.BlockedUntil.Sub(now) }
+    return 0
+}
+
+func expired(a *LoginAttempts, now time.Time) bool {
+    return now.Sub(a.LastFailure) > attemptWindow && now.After(a.BlockedUntil)
+}
+
+// makeRoom is called before adding a key to a full table. It drops expired
+// entries and, if none were, the one whose block ends first, so a flood of
+// distinct keys cannot grow the table without bound.
+func (t *attemptTable) makeRoom(now time.Time) {
+    for k, a := range t.M { if expired(a, now) { delete(t.M, k) } }
+    if len(t.M) < maxAttemptKeys { return }
+    var victim *LoginAttempts
+    for _, a := range t.M {
+        if victim == nil || a.BlockedUntil.Before(victim.BlockedUntil) { victim = a }
+    }
+    delete(t.M, victim.Key)
+}
+
+func (t *attemptTable) fail(key string, free int, lockAfter int, now time.Time) {
+    t.Mu.Lock()
+    defer t.Mu.Unlock()
+    a, ok := t.M[key]
+    if !ok || expired(a, now) {
+        if !ok && len(t.M) >= maxAttemptKeys { t.makeRoom(now) }
+        a = &LoginAttempts{Key: key}
+        t.M[key] = a
+    }
+    a.Failures++
+    a.LastFailure = now
+    until := now.Add(backoff(a.Failures, free))
+    if lockAfter > 0 && a.Failures >= lockAfter {
+        a.Locked = true
+        until = now.Add(lockoutDuration())
+    }
+    if until.After(a.BlockedUntil) { a.BlockedUntil = until }
+}
+
+func (t *attemptTable) reset(key string) bool {
+    t.Mu.Lock()
+    defer t.Mu.Unlock()
+    _, ok := t.M[key]
+    delete(t.M, key)
+    return ok
+}
+
+func (t *attemptTable) list(now time.Time) []LoginAttempts {
+    t.Mu.Lock()
+    defer t.Mu.Unlock()
+    var out []LoginAttempts
+    for k, a := range t.M {
+        if expired(a, now) { delete(t.M, k); continue }
+        c := *a
+        c.Locked = c.Locked && now.Before(c.BlockedUntil)
+        out = append(out, c)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].LastFailure.After(out[j].LastFailure) })
+    return out
+}
+
+// LoginAllowed reports whether a login attempt for username from ip may be
+// evaluated now, and if not how long the caller has to wait. Unknown usernames
+// are throttled exactly like real ones so the response does not reveal which
+// accounts exist.
+func LoginAllowed(username, ip string) (bool, time.Duration) {
+    now := time.Now()
+    wait := accountAttempts.blockedFor(accountKey(username), now)
+    if d := ipAttempts.blockedFor(ip, now); d > wait { wait = d }
+    return wait == 0, wait
+}
+
+func LoginFailed(username, ip string) {
+    now := time.Now()
+    accountAttempts.fail(accountKey(username), freeAccountFailures, lockoutThreshold(), now)
+    ipAttempts.fail(ip, freeIPFailures, 0, now)
+}
+
+// accountKey bounds the table key; real usernames are never longer.
+func accountKey(username string) string {
+    if len(username) > MaxUsernameLen { return username[:MaxUsernameLen] }
+    return username
+}
+
+func LoginSucceeded(username, ip string) {
+    accountAttempts.reset(accountKey(username))
+    ipAttempts.reset(ip)
+}
+
+// LoginLockouts lists accounts and IPs that currently have recorded failures.
+func LoginLockouts() (accounts, ips []LoginAttempts) {
+    now := time.Now()
+    return accountAttempts.list(now), ipAttempts.list(now)
+}
+
+// UnlockAccount clears failures for a username; UnlockIP for a client IP.
+func UnlockAccount(username string) bool { return accountAttempts.reset(accountKey(username)) }
+func UnlockIP(ip string) bool             { return ipAttempts.reset(ip) }
\ No newline at end of file
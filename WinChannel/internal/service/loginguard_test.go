@@ -0,0 +1,34 @@
+package service
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestAttemptTableBounded(t *testing.T) {
+    tbl := &attemptTable{M: map[string]*LoginAttempts{}}
+    now := time.Now()
+    tbl.fail("stale", 0, 0, now.Add(-2*attemptWindow))
+    tbl.fail("locked", 0, 1, now)
+    for i := 0; i < maxAttemptKeys+50; i++ {
+        tbl.fail(fmt.Sprintf("k%d", i), 100, 0, now.Add(time.Duration(i)*time.Millisecond))
+    }
+    if len(tbl.M) > maxAttemptKeys { t.Fatalf("table holds %d keys, cap is %d", len(tbl.M), maxAttemptKeys) }
+    if _, ok := tbl.M["stale"]; ok { t.Error("expired entry kept") }
+    if tbl.blockedFor("locked", now) == 0 { t.Error("locked account evicted before unblocked keys") }
+    if _, ok := tbl.M[fmt.Sprintf("k%d", maxAttemptKeys+49)]; !ok { t.Error("newest key missing") }
+}
+
+func TestAccountKeyBounded(t *testing.T) {
+    long := strings.Repeat("a", 1<<20)
+    LoginFailed(long, "192.0.2.1")
+    defer UnlockIP("192.0.2.1")
+    defer UnlockAccount(long)
+    accountAttempts.Mu.Lock()
+    defer accountAttempts.Mu.Unlock()
+    for k := range accountAttempts.M {
+        if len(k) > MaxUsernameLen { t.Fatalf("key of %d bytes stored", len(k)) }
+    }
+}
\ No newline at end of file
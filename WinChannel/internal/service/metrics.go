@@ -0,0 +1,51 @@
+package service
+
+import (
+    "crypto/subtle"
+    "net/http"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "time"
+    "winchannel/internal/config"
+    "winchannel/internal/paths"
+)
+
+// MetricsTokenOK reports whether r carries the scrape token configured in
+// metrics_token as a bearer credential. With no token configured only admins
+// can read /metrics.
+func MetricsTokenOK(r *http.Request) bool {
+    want := config.Get().MetricsToken
+    if want == "" { return false }
+    h := r.Header.Get("Authorization")
+    if !strings.HasPrefix(h, "Bearer ") { return false }
+    got := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+    return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+var usageCache struct {
+    sync.Mutex
+    at      time.Time
+    uploads int
+    bytes   int64
+}
+
+// StorageUsage returns the number of uploads and the total bytes under the
+// uploads directory. Walking the tree is not free, so results are cached
+// for 30 seconds.
+func StorageUsage() (int, int64) {
+    usageCache.Lock()
+    defer usageCache.Unlock()
+    if time.Since(usageCache.at) < 30*time.Second { return usageCache.uploads, usageCache.bytes }
+    uploads, bytes := 0, int64(0)
+    if entries, err := os.ReadDir(paths.UploadsDir); err == nil {
+        for _, e := range entries { if e.IsDir() { uploads++ } }
+    }
+    filepath.Walk(paths.UploadsDir, func(p string, fi os.FileInfo, err error) error {
+        if err == nil && fi.Mode().IsRegular() { bytes += fi.Size() }
+        return nil
+    })
+    usageCache.at, usageCache.uploads, usageCache.bytes = time.Now(), uploads, bytes
+    return uploads, bytes
+}
\ No newline at end of file
@@ -0,0 +1,60 @@
+package service
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "sync"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+)
+
+// PairingTTL is how long a pairing QR code stays valid. It is short because
+// the token grants a full session to whoever scans it first.
+const PairingTTL = 2 * time.Minute
+
+type pairing struct {
+    Username string
+    Role     string
+    Expires  time.Time
+}
+
+// pairings are keyed by the SHA-256 of the token so a memory dump does not
+// reveal redeemable tokens.
+var pairings = struct {
+    Mu sync.Mutex
+    M  map[string]pairing
+}{M: map[string]pairing{}}
+
+func hashPairing(tok string) string {
+    sum := sha256.Sum256([]byte(tok))
+    return hex.EncodeToString(sum[:])
+}
+
+// CreatePairing issues a one-time token that signs another device in as the
+// owner of s.
+func CreatePairing(s model.Session) (string, time.Time, error) {
+    tok, err := RandToken(32)
+    if err != nil { return "", time.Time{}, err }
+    now := time.Now()
+    p := pairing{Username: s.Username, Role: s.Role, Expires: now.Add(PairingTTL)}
+    pairings.Mu.Lock()
+    for k, v := range pairings.M { if now.After(v.Expires) { delete(pairings.M, k) } }
+    pairings.M[hashPairing(tok)] = p
+    pairings.Mu.Unlock()
+    return tok, p.Expires, nil
+}
+
+// RedeemPairing consumes tok. It fails when the token is unknown, expired,
+// already used, or its account has been deleted since it was issued.
+func RedeemPairing(tok string) (username, role string, ok bool) {
+    if tok == "" { return "", "", false }
+    h := hashPairing(tok)
+    pairings.Mu.Lock(); p, ok := pairings.M[h]; delete(pairings.M, h); pairings.Mu.Unlock()
+    if !ok || time.Now().After(p.Expires) { return "", "", false }
+    if p.Role != "admin" {
+        dao.Users.Mu.Lock(); _, exists := dao.Users.Users[p.Username]; dao.Users.Mu.Unlock()
+        if !exists { return "", "", false }
+    }
+    return p.Username, p.Role, true
+}
\ No newline at end of file
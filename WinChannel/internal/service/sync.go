@@ -0,0 +1,160 @@
+package service
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+    "winchannel/internal/atrest"
+    "winchannel/internal/model"
+)
+
+type cachedHash struct {
+    Size    int64
+    ModTime time.Time
+    Sum     string
+}
+
+// maxHashCache bounds the hash cache; past it, arbitrary entries are evicted.
+const maxHashCache = 20000
+
+// hashCache avoids rehashing unchanged files on every diff; entries are keyed by
+// path and invalidated when size or mtime change. Writers that delete or
+// replace upload files call ForgetHash or ForgetHashes.
+var hashCache = struct {
+    Mu sync.Mutex
+    M  map[string]cachedHash
+}{M: map[string]cachedHash{}}
+
+// ForgetHash drops the cached hash of the file at p.
+func ForgetHash(p string) {
+    hashCache.Mu.Lock(); delete(hashCache.M, p); hashCache.Mu.Unlock()
+}
+
+// ForgetHashes drops the cached hashes of every file under dir.
+func ForgetHashes(dir string) {
+    prefix := filepath.Clean(dir) + string(filepath.Separator)
+    hashCache.Mu.Lock()
+    defer hashCache.Mu.Unlock()
+    for k := range hashCache.M {
+        if strings.HasPrefix(k, prefix) { delete(hashCache.M, k) }
+    }
+}
+
+// FileHash returns the hex SHA-256 of the file at p, using the cache when the
+// file has not changed since it was last hashed.
+func FileHash(p string, fi os.FileInfo) (string, error) {
+    hashCache.Mu.Lock()
+    c, ok := hashCache.M[p]
+    hashCache.Mu.Unlock()
+    if ok && c.Size == fi.Size() && c.ModTime.Equal(fi.ModTime()) { return c.Sum, nil }
+    f, err := atrest.Open(p)
+    if err != nil { return "", err }
+    defer f.Close()
+    h := sha256.New()
+    if _, err := io.Copy(h, f); err != nil { return "", err }
+    sum := hex.EncodeToString(h.Sum(nil))
+    hashCache.Mu.Lock()
+    if _, ok := hashCache.M[p]; !ok {
+        for k := range hashCache.M {
+            if len(hashCache.M) < maxHashCache { break }
+            delete(hashCache.M, k)
+        }
+    }
+    hashCache.M[p] = cachedHash{Size: fi.Size(), ModTime: fi.ModTime(), Sum: sum}
+    hashCache.Mu.Unlock()
+    return sum, nil
+}
+
+// maxFreshUploads bounds freshUploads; past it, arbitrary entries are evicted.
+const maxFreshUploads = 20000
+
+// freshUploads remembers the mtime an upload left on each file it wrote. A
+// sync commit uses it to stamp the client's mtime on files the client has just
+// sent, which a manifest without hashes cannot tell apart from changed ones.
+var freshUploads = struct {
+    Mu sync.Mutex
+    M  map[string]time.Time
+}{M: map[string]time.Time{}}
+
+// NoteUpload records that an upload has just written the file at p.
+func NoteUpload(p string, fi os.FileInfo) {
+    freshUploads.Mu.Lock()
+    defer freshUploads.Mu.Unlock()
+    if _, ok := freshUploads.M[p]; !ok {
+        for k := range freshUploads.M {
+            if len(freshUploads.M) < maxFreshUploads { break }
+            delete(freshUploads.M, k)
+        }
+    }
+    freshUploads.M[p] = fi.ModTime()
+}
+
+// TakeUpload reports whether the file at p is still as an upload left it and
+// forgets the record.
+func TakeUpload(p string, fi os.FileInfo) bool {
+    freshUploads.Mu.Lock()
+    defer freshUploads.Mu.Unlock()
+    mt, ok := freshUploads.M[p]
+    delete(freshUploads.M, p)
+    return ok && mt.Equal(fi.ModTime())
+}
+
+// CleanSyncPath normalises a manifest path and rejects anything that would
+// escape the upload root.
+func CleanSyncPath(p string) (string, error) {
+    p = strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")
+    if p == "" || strings.HasPrefix(p, "/") { return "", errors.New("invalid path: " + p) }
+    c := path.Clean(p)
+    if c == "." || c == ".." || strings.HasPrefix(c, "../") { return "", errors.New("invalid path: " + p) }
+    return c, nil
+}
+
+// ScanUpload lists the regular files under root keyed by slash separated
+// relative path. In-flight temp files (prefixed with skipPrefix) are ignored.
+func ScanUpload(root, skipPrefix string) (map[string]os.FileInfo, error) {
+    out := map[string]os.FileInfo{}
+    err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+        if err != nil { return err }
+        if info.IsDir() || !info.Mode().IsRegular() { return nil }
+        if skipPrefix != "" && strings.HasPrefix(info.Name(), skipPrefix) { return nil }
+        rel, err := filepath.Rel(root, p)
+        if err != nil { return err }
+        out[filepath.ToSlash(rel)] = atrest.PlainInfo(p, info)
+        return nil
+    })
+    if os.IsNotExist(err) { return out, nil }
+    return out, err
+}
+
+// DiffManifest compares a client manifest with the files currently under root.
+// A client supplied hash is authoritative; without one, size and mtime decide.
+func DiffManifest(root string, manifest []model.SyncEntry, remote map[string]os.FileInfo) model.SyncDiff {
+    d := model.SyncDiff{Missing: []string{}, Changed: []string{}, Extra: []string{}}
+    seen := map[string]bool{}
+    for _, e := range manifest {
+        seen[e.Path] = true
+        fi, ok := remote[e.Path]
+        if !ok { d.Missing = append(d.Missing, e.Path); continue }
+        same := fi.Size() == e.Size
+        if same && e.SHA256 != "" {
+            sum, err := FileHash(filepath.Join(root, filepath.FromSlash(e.Path)), fi)
+            same = err == nil && strings.EqualFold(sum, e.SHA256)
+        } else if same && e.Mtime > 0 {
+            same = fi.ModTime().Unix() == e.Mtime
+        }
+        if same { d.Unchanged++ } else { d.Changed = append(d.Changed, e.Path) }
+    }
+    for p := range remote {
+        if !seen[p] { d.Extra = append(d.Extra, p) }
+    }
+    sort.Strings(d.Missing); sort.Strings(d.Changed); sort.Strings(d.Extra)
+    return d
+}
\ No newline at end of file
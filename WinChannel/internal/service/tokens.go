@@ -0,0 +1,124 @@
+package service
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+)
+
+// TokenPrefix makes personal access tokens recognisable in configs and logs.
+const TokenPrefix = "wct_"
+
+func hashToken(tok string) string {
+    sum := sha256.Sum256([]byte(tok))
+    return hex.EncodeToString(sum[:])
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+    h := r.Header.Get("Authorization")
+    if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") { return "", false }
+    tok := strings.TrimSpace(h[7:])
+    return tok, tok != ""
+}
+
+// NormalizeScopes validates and de-duplicates requested scopes. Only admins
+// may mint tokens with the admin scope.
+func NormalizeScopes(in []string, role string) ([]string, error) {
+    if len(in) == 0 { return nil, errors.New("at least one scope required") }
+    set := map[string]bool{}
+    for _, s := range in {
+        s = strings.TrimSpace(s)
+        valid := false
+        for _, k := range model.AllScopes { if s == k { valid = true } }
+        if !valid { return nil, errors.New("unknown scope: " + s) }
+        if s == model.ScopeAdmin && role != "admin" { return nil, errors.New("admin scope requires admin role") }
+        set[s] = true
+    }
+    out := make([]string, 0, len(set))
+    for s := range set { out = append(out, s) }
+    sort.Strings(out)
+    return out, nil
+}
+
+// CreateToken issues a new token and returns the plaintext secret, which is
+// never stored and cannot be recovered later.
+func CreateToken(username, role, name string, scopes []string, ttl time.Duration) (string, model.APIToken, error) {
+    secret, err := RandToken(32)
+    if err != nil { return "", model.APIToken{}, err }
+    id, err := RandToken(8)
+    if err != nil { return "", model.APIToken{}, err }
+    plain := TokenPrefix + secret
+    t := model.APIToken{ID: id, Username: username, Role: role, Name: name, Hash: hashToken(plain), Scopes: scopes, CreatedAt: time.Now()}
+    if ttl > 0 { t.ExpiresAt = t.CreatedAt.Add(ttl) }
+    dao.Tokens.Mu.Lock(); dao.Tokens.M[t.Hash] = t; dao.Tokens.Mu.Unlock()
+    if err := dao.SaveTokens(); err != nil { return "", model.APIToken{}, err }
+    return plain, t, nil
+}
+
+// LookupToken resolves a plaintext token to a session. Expired tokens are
+// treated as unknown.
+func LookupToken(plain string) (model.Session, bool) {
+    h := hashToken(plain)
+    dao.Tokens.Mu.Lock()
+    defer dao.Tokens.Mu.Unlock()
+    t, ok := dao.Tokens.M[h]
+    if !ok { return model.Session{}, false }
+    now := time.Now()
+    if !t.ExpiresAt.IsZero() && now.After(t.ExpiresAt) { return model.Session{}, false }
+    t.LastUsedAt = now
+    dao.Tokens.M[h] = t
+    return model.Session{Username: t.Username, Role: t.Role, Expires: t.ExpiresAt, TokenID: t.ID, Scopes: t.Scopes}, true
+}
+
+// ListTokens returns tokens for username, or all tokens when username is "".
+func ListTokens(username string) []model.APIToken {
+    dao.Tokens.Mu.Lock()
+    var out []model.APIToken
+    for _, t := range dao.Tokens.M {
+        if username == "" || t.Username == username { t.Hash = ""; out = append(out, t) }
+    }
+    dao.Tokens.Mu.Unlock()
+    sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+    return out
+}
+
+// RevokeToken deletes a token by ID. When username is not "" the token must
+// belong to that user.
+func RevokeToken(id, username string) (bool, error) {
+    dao.Tokens.Mu.Lock()
+    found := false
+    for h, t := range dao.Tokens.M {
+        if t.ID == id && (username == "" || t.Username == username) { delete(dao.Tokens.M, h); found = true }
+    }
+    dao.Tokens.Mu.Unlock()
+    if !found { return false, nil }
+    return true, dao.SaveTokens()
+}
+
+// RevokeUserTokens drops every token owned by username, e.g. when the account
+// is deleted.
+func RevokeUserTokens(username string) error {
+    dao.Tokens.Mu.Lock()
+    n := 0
+    for h, t := range dao.Tokens.M {
+        if t.Username == username { delete(dao.Tokens.M, h); n++ }
+    }
+    dao.Tokens.Mu.Unlock()
+    if n == 0 { return nil }
+    return dao.SaveTokens()
+}
+
+// HasScope reports whether s may perform actions in scope. Cookie sessions are
+// unrestricted.
+func HasScope(s model.Session, scope string) bool {
+    if s.TokenID == "" { return true }
+    for _, k := range s.Scopes { if k == scope { return true } }
+    return false
+}
\ No newline at end of file
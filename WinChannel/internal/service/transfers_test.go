@@ -0,0 +1,39 @@
+package service
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+)
+
+func TestPruneTransfers(t *testing.T) {
+    now := time.Now().UTC()
+    dao.Transfers.Mu.Lock()
+    defer dao.Transfers.Mu.Unlock()
+    dao.Transfers.M = map[string]model.Transfer{
+        "old":   {ID: "old", From: "bob", CreatedAt: now.AddDate(0, 0, -31)},
+        "fresh": {ID: "fresh", From: "bob", CreatedAt: now.AddDate(0, 0, -29)},
+    }
+    // alice sends more than the count cap; her oldest go first.
+    for i := 0; i < maxSenderTransfers+3; i++ {
+        id := fmt.Sprintf("a%d", i)
+        dao.Transfers.M[id] = model.Transfer{ID: id, From: "alice", CreatedAt: now.Add(time.Duration(i) * time.Second)}
+    }
+    // carol's texts add up past the byte cap.
+    big := strings.Repeat("x", maxTransferText)
+    for i := 0; i < maxSenderTextBytes/maxTransferText+1; i++ {
+        id := fmt.Sprintf("c%d", i)
+        dao.Transfers.M[id] = model.Transfer{ID: id, From: "carol", Text: big, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+    }
+
+    if n := pruneTransfers(now); n != 1+3+1 { t.Fatalf("pruned %d, want 5", n) }
+    for _, id := range []string{"old", "a0", "a1", "a2", "c0"} {
+        if _, ok := dao.Transfers.M[id]; ok { t.Errorf("%s kept", id) }
+    }
+    for _, id := range []string{"fresh", "a3", fmt.Sprintf("a%d", maxSenderTransfers+2), "c1"} {
+        if _, ok := dao.Transfers.M[id]; !ok { t.Errorf("%s dropped", id) }
+    }
+}
\ No newline at end of file
@@ -0,0 +1,249 @@
+package service
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "log/slog"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+    "winchannel/internal/dao"
+    "winchannel/internal/model"
+)
+
+const (
+    TwoFactorIssuer   = "WinChannel"
+    PendingCookie     = "SESSION_2FA"
+    pendingTTL        = 5 * time.Minute
+    pendingMaxTries   = 5
+    recoveryCodeCount = 10
+)
+
+var (
+    ErrTwoFactorNotPending = errors.New("no pending 2fa setup")
+    ErrTwoFactorBadCode    = errors.New("invalid code")
+    ErrTwoFactorEnforced   = errors.New("2fa is required for this account")
+)
+
+// PendingLogin is a password-verified login waiting for its second factor.
+type PendingLogin struct {
+    Username string
+    Role     string
+    Expires  time.Time
+    Tries    int
+}
+
+var pendingLogins = struct {
+    Mu sync.Mutex
+    M  map[string]*PendingLogin
+}{M: map[string]*PendingLogin{}}
+
+func hashRecoveryCode(code string) string {
+    code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+    sum := sha256.Sum256([]byte(code))
+    return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+    var plain, hashed []string
+    for i := 0; i < recoveryCodeCount; i++ {
+        tok, err := RandToken(5)
+        if err != nil { return nil, nil, err }
+        c := tok[:5] + "-" + tok[5:]
+        plain = append(plain, c)
+        hashed = append(hashed, hashRecoveryCode(c))
+    }
+    return plain, hashed, nil
+}
+
+// TwoFactorEnabled reports whether username must present a second factor.
+func TwoFactorEnabled(username string) bool {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    tf, ok := dao.TwoFactor.M[username]
+    return ok && tf.Enabled
+}
+
+// AdminTwoFactorRequired reports whether the admin role is forced to use 2FA.
+func AdminTwoFactorRequired() bool {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    return dao.TwoFactor.RequireAdmin
+}
+
+// SetAdminTwoFactorRequired toggles enforcement. Enabling it requires the
+// calling admin to be enrolled already so they cannot lock themselves out.
+func SetAdminTwoFactorRequired(admin string, on bool) error {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    if on {
+        if tf, ok := dao.TwoFactor.M[admin]; !ok || !tf.Enabled { return errors.New("enable 2fa on your own account first") }
+    }
+    dao.TwoFactor.RequireAdmin = on
+    return dao.SaveTwoFactor()
+}
+
+// BeginTwoFactorSetup creates a new pending secret and returns it with its
+// provisioning URI. An existing enrollment stays active until confirmed.
+func BeginTwoFactorSetup(username string) (string, string, error) {
+    secret, err := NewTOTPSecret()
+    if err != nil { return "", "", err }
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    tf, ok := dao.TwoFactor.M[username]
+    if !ok { tf = &model.TwoFactor{}; dao.TwoFactor.M[username] = tf }
+    tf.PendingSecret = secret
+    if err := dao.SaveTwoFactor(); err != nil { return "", "", err }
+    return secret, ProvisioningURI(TwoFactorIssuer, username, secret), nil
+}
+
+// ConfirmTwoFactorSetup activates the pending secret once the user proves the
+// authenticator works, and returns fresh recovery codes.
+func ConfirmTwoFactorSetup(username, code string) ([]string, error) {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    tf, ok := dao.TwoFactor.M[username]
+    if !ok || tf.PendingSecret == "" { return nil, ErrTwoFactorNotPending }
+    counter, ok := VerifyTOTP(tf.PendingSecret, code, time.Now(), 0)
+    if !ok { return nil, ErrTwoFactorBadCode }
+    plain, hashed, err := newRecoveryCodes()
+    if err != nil { return nil, err }
+    tf.Secret = tf.PendingSecret
+    tf.PendingSecret = ""
+    tf.Enabled = true
+    tf.EnabledAt = time.Now()
+    tf.LastCounter = counter
+    tf.RecoveryCodes = hashed
+    return plain, dao.SaveTwoFactor()
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after a valid TOTP code.
+func RegenerateRecoveryCodes(username, code string) ([]string, error) {
+    if !VerifySecondFactor(username, code, false) { return nil, ErrTwoFactorBadCode }
+    plain, hashed, err := newRecoveryCodes()
+    if err != nil { return nil, err }
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    tf, ok := dao.TwoFactor.M[username]
+    if !ok || !tf.Enabled { return nil, ErrTwoFactorNotPending }
+    tf.RecoveryCodes = hashed
+    return plain, dao.SaveTwoFactor()
+}
+
+// DisableTwoFactor removes the enrollment after a valid code. Admins cannot
+// disable it while enforcement is on.
+func DisableTwoFactor(username, role, code string) error {
+    if role == "admin" && AdminTwoFactorRequired() { return ErrTwoFactorEnforced }
+    if !VerifySecondFactor(username, code, true) { return ErrTwoFactorBadCode }
+    return RemoveTwoFactor(username)
+}
+
+// RemoveTwoFactor drops the enrollment unconditionally (account deletion or
+// admin reset).
+func RemoveTwoFactor(username string) error {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    if _, ok := dao.TwoFactor.M[username]; !ok { return nil }
+    delete(dao.TwoFactor.M, username)
+    return dao.SaveTwoFactor()
+}
+
+// VerifySecondFactor accepts a current TOTP code or, if allowRecovery, an
+// unused recovery code which is consumed.
+func VerifySecondFactor(username, code string, allowRecovery bool) bool {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    tf, ok := dao.TwoFactor.M[username]
+    if !ok || !tf.Enabled { return false }
+    // A used code must be recorded before it is accepted; otherwise it would
+    // work again after a restart.
+    if counter, ok := VerifyTOTP(tf.Secret, code, time.Now(), tf.LastCounter); ok {
+        last := tf.LastCounter
+        tf.LastCounter = counter
+        if err := dao.SaveTwoFactor(); err != nil {
+            tf.LastCounter = last
+            slog.Error("2fa: cannot record used code", "user", username, "err", err)
+            return false
+        }
+        return true
+    }
+    if !allowRecovery { return false }
+    h := hashRecoveryCode(code)
+    for i, rc := range tf.RecoveryCodes {
+        if rc == h {
+            codes := tf.RecoveryCodes
+            tf.RecoveryCodes = append(append([]string(nil), codes[:i]...), codes[i+1:]...)
+            if err := dao.SaveTwoFactor(); err != nil {
+                tf.RecoveryCodes = codes
+                slog.Error("2fa: cannot consume recovery code", "user", username, "err", err)
+                return false
+            }
+            return true
+        }
+    }
+    return false
+}
+
+// TwoFactorStatus summarises an account's enrollment for display.
+func TwoFactorStatus(username string) (enabled bool, recoveryLeft int) {
+    dao.TwoFactor.Mu.Lock()
+    defer dao.TwoFactor.Mu.Unlock()
+    if tf, ok := dao.TwoFactor.M[username]; ok && tf.Enabled { return true, len(tf.RecoveryCodes) }
+    return false, 0
+}
+
+// StartPendingLogin issues the short-lived token that stands in for a session
+// until the second factor is verified. It is set as a cookie scoped to the
+// 2FA endpoints and also returned for non-browser clients.
+func StartPendingLogin(w http.ResponseWriter, username, role string) (string, error) {
+    tok, err := RandToken(32)
+    if err != nil { return "", err }
+    p := &PendingLogin{Username: username, Role: role, Expires: time.Now().Add(pendingTTL)}
+    pendingLogins.Mu.Lock()
+    now := time.Now()
+    for k, v := range pendingLogins.M { if now.After(v.Expires) { delete(pendingLogins.M, k) } }
+    pendingLogins.M[tok] = p
+    pendingLogins.Mu.Unlock()
+    http.SetCookie(w, &http.Cookie{
+        Name:     PendingCookie,
+        Value:    tok,
+        Path:     "/api/auth/2fa",
+        HttpOnly: true,
+        SameSite: http.SameSiteLaxMode,
+        Secure:   secureCookies(),
+        Expires:  p.Expires,
+    })
+    return tok, nil
+}
+
+// PendingFromRequest finds the pending login from the body token or cookie.
+func PendingFromRequest(r *http.Request, bodyToken string) (string, PendingLogin, bool) {
+    tok := bodyToken
+    if tok == "" {
+        if c, err := r.Cookie(PendingCookie); err == nil { tok = c.Value }
+    }
+    pendingLogins.Mu.Lock()
+    defer pendingLogins.Mu.Unlock()
+    p, ok := pendingLogins.M[tok]
+    if !ok { return "", PendingLogin{}, false }
+    if time.Now().After(p.Expires) { delete(pendingLogins.M, tok); return "", PendingLogin{}, false }
+    return tok, *p, true
+}
+
+// FailPendingLogin counts a wrong code; the pending login is dropped after
+// pendingMaxTries so the password has to be entered again.
+func FailPendingLogin(tok string) {
+    pendingLogins.Mu.Lock()
+    defer pendingLogins.Mu.Unlock()
+    if p, ok := pendingLogins.M[tok]; ok {
+        p.Tries++
+        if p.Tries >= pendingMaxTries { delete(pendingLogins.M, tok) }
+    }
+}
+
+func FinishPendingLogin(w http.ResponseWriter, tok string) {
+    pendingLogins.Mu.Lock(); delete(pendingLogins.M, tok); pendingLogins.Mu.Unlock()
+    http.SetCookie(w, &http.Cookie{Name: PendingCookie, Value: "", Path: "/api/auth/2fa", HttpOnly: true, Secure: secureCookies(), MaxAge: -1, Expires: time.Unix(0, 0)})
+}
\ No newline at end of file
@@ -0,0 +1,195 @@
+// Package txn commits small groups of file changes atomically and survives
+// crashes. A commit first writes a write-ahead record holding every change,
+// then applies each one (whole files via temp file + fsync + rename, appends
+// at a recorded offset) and finally deletes the record. Open replays a record
+// left behind by a crash, so after a restart either all changes of a commit
+// are on disk or, if the record itself never completed, none are.
+package txn
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+// op is one change in a commit. Replaying an op any number of times leaves
+// the same result.
+type op struct {
+    Kind   string      `json:"kind"` // "write", "append" or "remove"
+    Path   string      `json:"path"`
+    Data   []byte      `json:"data,omitempty"`
+    Perm   os.FileMode `json:"perm,omitempty"`
+    Offset int64       `json:"offset,omitempty"` // append: file size before the append
+}
+
+type record struct {
+    Ops []op `json:"ops"`
+}
+
+// Store serialises commits behind a single writer lock. Readers that need a
+// consistent view of several files use View.
+type Store struct {
+    mu  sync.RWMutex
+    wal string
+}
+
+// Open sets the write-ahead record path and replays a record left by an
+// interrupted commit. It reports whether anything was replayed.
+func (s *Store) Open(wal string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.wal = wal
+    clearTemps(wal) // an unfinished record: its commit never started
+    return s.replay()
+}
+
+// replay applies and removes a leftover record, if any.
+func (s *Store) replay() (bool, error) {
+    b, err := os.ReadFile(s.wal)
+    if os.IsNotExist(err) { return false, nil }
+    if err != nil { return false, err }
+    var rec record
+    if err := json.Unmarshal(b, &rec); err != nil { return false, fmt.Errorf("txn: corrupt record %s: %w", s.wal, err) }
+    if err := apply(rec.Ops); err != nil { return false, fmt.Errorf("txn: replay %s: %w", s.wal, err) }
+    return true, removeSynced(s.wal)
+}
+
+// Tx collects the changes of one commit. Reads inside Update see the files
+// as they were before the commit.
+type Tx struct {
+    ops []op
+}
+
+// Write replaces path with data.
+func (tx *Tx) Write(path string, data []byte, perm os.FileMode) {
+    tx.ops = append(tx.ops, op{Kind: "write", Path: path, Data: data, Perm: perm})
+}
+
+// Append adds data to the end of path, creating it if needed.
+func (tx *Tx) Append(path string, data []byte, perm os.FileMode) error {
+    var off int64
+    for _, o := range tx.ops {
+        if o.Path == path && o.Kind != "append" { return errors.New("txn: append after write or remove of " + path) }
+    }
+    if fi, err := os.Stat(path); err == nil {
+        off = fi.Size()
+    } else if !os.IsNotExist(err) {
+        return err
+    }
+    for _, o := range tx.ops {
+        if o.Path == path { off += int64(len(o.Data)) }
+    }
+    tx.ops = append(tx.ops, op{Kind: "append", Path: path, Data: data, Perm: perm, Offset: off})
+    return nil
+}
+
+// Remove deletes path if it exists.
+func (tx *Tx) Remove(path string) {
+    tx.ops = append(tx.ops, op{Kind: "remove", Path: path})
+}
+
+// Update runs fn under the writer lock and commits its changes if it
+// returns nil.
+func (s *Store) Update(fn func(tx *Tx) error) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.wal == "" { return errors.New("txn: store not opened") }
+    if _, err := s.replay(); err != nil { return err } // a commit that failed half way
+    tx := &Tx{}
+    if err := fn(tx); err != nil { return err }
+    if len(tx.ops) == 0 { return nil }
+    b, err := json.Marshal(record{Ops: tx.ops})
+    if err != nil { return err }
+    if err := writeSynced(s.wal, b, 0600); err != nil { return err }
+    if err := apply(tx.ops); err != nil { return err } // the record stays to be replayed
+    return removeSynced(s.wal)
+}
+
+// View runs fn while no commit is in progress.
+func (s *Store) View(fn func()) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    fn()
+}
+
+func apply(ops []op) error {
+    for _, o := range ops {
+        var err error
+        switch o.Kind {
+        case "write":
+            err = writeSynced(o.Path, o.Data, o.Perm)
+        case "append":
+            err = appendAt(o.Path, o.Data, o.Offset, o.Perm)
+        case "remove":
+            if err = os.Remove(o.Path); os.IsNotExist(err) { err = nil }
+            if err == nil { syncDir(filepath.Dir(o.Path)) }
+        default:
+            err = fmt.Errorf("unknown op %q", o.Kind)
+        }
+        if err != nil { return fmt.Errorf("%s %s: %w", o.Kind, o.Path, err) }
+    }
+    return nil
+}
+
+// tmpPrefix marks temp files next to their target, e.g. ".users.json.txn-123".
+func tmpPrefix(path string) string { return "." + filepath.Base(path) + ".txn-" }
+
+// writeSynced replaces path with data through a synced temp file, so readers
+// and crashes see either the old or the new content.
+func writeSynced(path string, data []byte, perm os.FileMode) error {
+    dir := filepath.Dir(path)
+    if err := os.MkdirAll(dir, 0755); err != nil { return err }
+    clearTemps(path)
+    f, err := os.CreateTemp(dir, tmpPrefix(path)+"*")
+    if err != nil { return err }
+    _, err = f.Write(data)
+    if err == nil { err = f.Sync() }
+    if cerr := f.Close(); err == nil { err = cerr }
+    if err == nil && perm != 0 { err = os.Chmod(f.Name(), perm) }
+    if err == nil { err = os.Rename(f.Name(), path) }
+    if err != nil { os.Remove(f.Name()); return err }
+    syncDir(dir)
+    return nil
+}
+
+// appendAt writes data at off, cutting off anything a previous attempt left
+// beyond it.
+func appendAt(path string, data []byte, off int64, perm os.FileMode) error {
+    if perm == 0 { perm = 0644 }
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil { return err }
+    f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, perm)
+    if err != nil { return err }
+    err = f.Truncate(off)
+    if err == nil { _, err = f.WriteAt(data, off) }
+    if err == nil { err = f.Sync() }
+    if cerr := f.Close(); err == nil { err = cerr }
+    return err
+}
+
+func removeSynced(path string) error {
+    if err := os.Remove(path); err != nil && !os.IsNotExist(err) { return err }
+    syncDir(filepath.Dir(path))
+    return nil
+}
+
+// clearTemps removes temp files a crash left next to path.
+func clearTemps(path string) {
+    entries, err := os.ReadDir(filepath.Dir(path))
+    if err != nil { return }
+    for _, e := range entries {
+        if strings.HasPrefix(e.Name(), tmpPrefix(path)) { os.Remove(filepath.Join(filepath.Dir(path), e.Name())) }
+    }
+}
+
+// syncDir makes a rename or removal durable. Not every platform can sync a
+// directory (Windows cannot), so failure is ignored.
+func syncDir(dir string) {
+    if d, err := os.Open(dir); err == nil {
+        d.Sync()
+        d.Close()
+    }
+}
\ No newline at end of file
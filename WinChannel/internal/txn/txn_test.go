@@ -0,0 +1,157 @@
+package txn
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func openStore(t *testing.T) (*Store, string) {
+    t.Helper()
+    dir := t.TempDir()
+    s := &Store{}
+    if _, err := s.Open(filepath.Join(dir, "wal.json")); err != nil { t.Fatal(err) }
+    return s, dir
+}
+
+func writeRecord(t *testing.T, wal string, ops ...op) {
+    t.Helper()
+    b, err := json.Marshal(record{Ops: ops})
+    if err != nil { t.Fatal(err) }
+    if err := os.WriteFile(wal, b, 0600); err != nil { t.Fatal(err) }
+}
+
+func readFile(t *testing.T, path string) string {
+    t.Helper()
+    b, err := os.ReadFile(path)
+    if err != nil { t.Fatal(err) }
+    return string(b)
+}
+
+// TestConcurrentUpdates runs writers that each read the version, bump it and
+// commit content, version and a history line together, the way the shared
+// text does.
+func TestConcurrentUpdates(t *testing.T) {
+    s, dir := openStore(t)
+    cur, ver, hist := filepath.Join(dir, "current.txt"), filepath.Join(dir, "version.txt"), filepath.Join(dir, "history.ndjson")
+    const n = 50
+    got := make([]int, n)
+    var wg sync.WaitGroup
+    for i := 0; i < n; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            err := s.Update(func(tx *Tx) error {
+                v := 0
+                if b, err := os.ReadFile(ver); err == nil { v, _ = strconv.Atoi(string(b)) }
+                v++
+                got[i] = v
+                tx.Write(cur, []byte(fmt.Sprintf("content %d", v)), 0644)
+                tx.Write(ver, []byte(strconv.Itoa(v)), 0644)
+                return tx.Append(hist, []byte(fmt.Sprintf("%d\n", v)), 0644)
+            })
+            if err != nil { t.Error(err) }
+        }(i)
+    }
+    wg.Wait()
+
+    seen := map[int]bool{}
+    for _, v := range got {
+        if v < 1 || v > n || seen[v] { t.Fatalf("versions not distinct and contiguous: %v", got) }
+        seen[v] = true
+    }
+    if v := readFile(t, ver); v != strconv.Itoa(n) { t.Fatalf("version.txt = %q, want %d", v, n) }
+    if c := readFile(t, cur); c != fmt.Sprintf("content %d", n) { t.Fatalf("current.txt = %q does not match version %d", c, n) }
+    f, err := os.Open(hist)
+    if err != nil { t.Fatal(err) }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    for want := 1; want <= n; want++ {
+        if !sc.Scan() { t.Fatalf("history ends after %d lines", want-1) }
+        if sc.Text() != strconv.Itoa(want) { t.Fatalf("history line %d = %q", want, sc.Text()) }
+    }
+    if sc.Scan() { t.Fatalf("extra history line %q", sc.Text()) }
+    if _, err := os.Stat(filepath.Join(dir, "wal.json")); !os.IsNotExist(err) { t.Fatalf("record left behind: %v", err) }
+}
+
+func TestOpenReplaysRecord(t *testing.T) {
+    dir := t.TempDir()
+    wal := filepath.Join(dir, "wal.json")
+    a, b, gone := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "gone.txt")
+    os.WriteFile(a, []byte("torn"), 0644) // the crash hit half way through the commit
+    os.WriteFile(gone, []byte("old"), 0644)
+    os.WriteFile(filepath.Join(dir, tmpPrefix(b)+"1"), []byte("junk"), 0644)
+    writeRecord(t, wal,
+        op{Kind: "write", Path: a, Data: []byte("new a"), Perm: 0644},
+        op{Kind: "write", Path: b, Data: []byte("new b"), Perm: 0600},
+        op{Kind: "remove", Path: gone})
+
+    s := &Store{}
+    replayed, err := s.Open(wal)
+    if err != nil { t.Fatal(err) }
+    if !replayed { t.Fatal("Open did not report a replay") }
+    if got := readFile(t, a); got != "new a" { t.Fatalf("a.txt = %q", got) }
+    if got := readFile(t, b); got != "new b" { t.Fatalf("b.txt = %q", got) }
+    if _, err := os.Stat(gone); !os.IsNotExist(err) { t.Fatal("gone.txt was not removed") }
+    if _, err := os.Stat(wal); !os.IsNotExist(err) { t.Fatal("record was not removed") }
+    entries, _ := os.ReadDir(dir)
+    for _, e := range entries {
+        if strings.Contains(e.Name(), ".txn-") { t.Fatalf("temp file %s left behind", e.Name()) }
+    }
+
+    replayed, err = s.Open(wal)
+    if err != nil || replayed { t.Fatalf("second Open = %v, %v; want nothing to replay", replayed, err) }
+}
+
+func TestOpenDropsUnfinishedRecord(t *testing.T) {
+    dir := t.TempDir()
+    wal := filepath.Join(dir, "wal.json")
+    a := filepath.Join(dir, "a.txt")
+    os.WriteFile(a, []byte("old"), 0644)
+    // The record was still being written: only its temp file exists.
+    os.WriteFile(filepath.Join(dir, tmpPrefix(wal)+"1"), []byte(`{"ops":[{"kind":"write","path":`), 0600)
+
+    replayed, err := (&Store{}).Open(wal)
+    if err != nil || replayed { t.Fatalf("Open = %v, %v; want nothing to replay", replayed, err) }
+    if got := readFile(t, a); got != "old" { t.Fatalf("a.txt = %q, want it untouched", got) }
+    entries, _ := os.ReadDir(dir)
+    if len(entries) != 1 { t.Fatalf("unfinished record not cleared: %d entries", len(entries)) }
+}
+
+func TestReplayTruncatesAppend(t *testing.T) {
+    dir := t.TempDir()
+    wal := filepath.Join(dir, "wal.json")
+    hist := filepath.Join(dir, "history.ndjson")
+    os.WriteFile(hist, []byte("1\n2\n"), 0644)
+    writeRecord(t, wal, op{Kind: "append", Path: hist, Data: []byte("3\n"), Perm: 0644, Offset: 4})
+    // A partial line from the interrupted append sits past the offset.
+    f, _ := os.OpenFile(hist, os.O_WRONLY|os.O_APPEND, 0644)
+    f.WriteString("3\n{\"partial")
+    f.Close()
+
+    s := &Store{}
+    if _, err := s.Open(wal); err != nil { t.Fatal(err) }
+    if got := readFile(t, hist); got != "1\n2\n3\n" { t.Fatalf("history = %q", got) }
+
+    // Replaying the same append twice must not duplicate it.
+    writeRecord(t, wal, op{Kind: "append", Path: hist, Data: []byte("3\n"), Perm: 0644, Offset: 4})
+    if _, err := s.Open(wal); err != nil { t.Fatal(err) }
+    if got := readFile(t, hist); got != "1\n2\n3\n" { t.Fatalf("history after second replay = %q", got) }
+}
+
+func TestUpdateErrorCommitsNothing(t *testing.T) {
+    s, dir := openStore(t)
+    a := filepath.Join(dir, "a.txt")
+    err := s.Update(func(tx *Tx) error {
+        tx.Write(a, []byte("x"), 0644)
+        return fmt.Errorf("abort")
+    })
+    if err == nil { t.Fatal("Update swallowed the error") }
+    if _, err := os.Stat(a); !os.IsNotExist(err) { t.Fatal("aborted write reached disk") }
+}
\ No newline at end of file
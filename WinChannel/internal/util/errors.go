@@ -0,0 +1,94 @@
+package util
+
+import (
+    "context"
+    "log/slog"
+    "net/http"
+)
+
+// Error codes shared by all handlers. Clients should branch on the code and
+// treat the message as human readable text.
+const (
+    CodeBadRequest       = "bad_request"
+    CodeInvalidJSON      = "invalid_json"
+    CodeUnauthorized     = "unauthorized"
+    CodeForbidden        = "forbidden"
+    CodeNotFound         = "not_found"
+    CodeMethodNotAllowed = "method_not_allowed"
+    CodeConflict         = "conflict"
+    CodePayloadTooLarge  = "payload_too_large"
+    CodeTooManyRequests  = "too_many_requests"
+    CodeInternal         = "internal_error"
+    CodeUnavailable      = "unavailable"
+)
+
+// APIError is the body of every error response:
+//
+//    {"ok": false, "error": {"code": "...", "message": "...", "details": ..., "request_id": "..."}}
+type APIError struct {
+    Code      string      `json:"code"`
+    Message   string      `json:"message"`
+    Details   interface{} `json:"details,omitempty"`
+    RequestID string      `json:"request_id,omitempty"`
+}
+
+type errorEnvelope struct {
+    OK    bool     `json:"ok"`
+    Error APIError `json:"error"`
+}
+
+type ctxKey int
+
+const requestIDKey ctxKey = iota
+
+// WithRequestID stores the request ID on the context; the router does this for
+// every request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+    return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID assigned to r, or "" outside the router.
+func RequestID(r *http.Request) string {
+    if r == nil { return "" }
+    id, _ := r.Context().Value(requestIDKey).(string)
+    return id
+}
+
+// Logger returns the default logger tagged with r's request ID, so handler
+// log lines can be matched to the access log and to error responses.
+func Logger(r *http.Request) *slog.Logger {
+    if id := RequestID(r); id != "" { return slog.Default().With("request_id", id) }
+    return slog.Default()
+}
+
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+    WriteErrorDetails(w, r, status, code, message, nil)
+}
+
+func WriteErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.Header().Set("X-Content-Type-Options", "nosniff")
+    w.WriteHeader(status)
+    WriteJSON(w, errorEnvelope{Error: APIError{Code: code, Message: message, Details: details, RequestID: RequestID(r)}})
+}
+
+// BadRequest is a 400 with the generic bad_request code.
+func BadRequest(w http.ResponseWriter, r *http.Request, message string) {
+    WriteError(w, r, http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// BadJSON reports a request body that failed to decode.
+func BadJSON(w http.ResponseWriter, r *http.Request, err error) {
+    WriteErrorDetails(w, r, http.StatusBadRequest, CodeInvalidJSON, "request body is not valid JSON", err.Error())
+}
+
+func NotFound(w http.ResponseWriter, r *http.Request, message string) {
+    WriteError(w, r, http.StatusNotFound, CodeNotFound, message)
+}
+
+// InternalError logs err with the request ID and returns a generic 500 so
+// filesystem paths and other internals are not exposed to clients.
+func InternalError(w http.ResponseWriter, r *http.Request, err error) {
+    Logger(r).Error("request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+    WriteError(w, r, http.StatusInternalServerError, CodeInternal, "internal server error")
+}
\ No newline at end of file
@@ -0,0 +1,60 @@
+package util
+
+import (
+    "net"
+    "sort"
+    "strings"
+    "winchannel/internal/model"
+)
+
+// virtualPrefixes are interface names used by container runtimes, VM
+// hypervisors and OS-internal links; peers on the LAN can't reach them.
+// macOS Internet Sharing (bridge100) is deliberately not listed: hotspot
+// clients connect through it.
+var virtualPrefixes = []string{
+    "docker", "br-", "veth", "virbr", "vmnet", "vboxnet", "vethernet", "cni", "flannel", "podman", "lxc", "lxd",
+    "utun", "awdl", "llw", "anpi", "gif", "stf",
+}
+
+// virtualNames catch adapters by their (Windows) friendly name.
+var virtualNames = []string{"virtualbox", "vmware", "hyper-v", "wsl", "loopback", "pseudo", "teredo", "isatap"}
+
+func isVirtual(name string) bool {
+    n := strings.ToLower(name)
+    for _, p := range virtualPrefixes { if strings.HasPrefix(n, p) { return true } }
+    for _, s := range virtualNames { if strings.Contains(n, s) { return true } }
+    return false
+}
+
+// LocalAddrs enumerates the unicast addresses of every interface that is up,
+// skipping loopback and link-local addresses. Virtual adapters are included
+// only when includeVirtual is set (and are flagged as such). IPv4 comes
+// first, then physical before virtual, then by interface name.
+func LocalAddrs(includeVirtual bool) []model.InterfaceAddr {
+    ifaces, err := net.Interfaces()
+    if err != nil { return nil }
+    var out []model.InterfaceAddr
+    for _, ifc := range ifaces {
+        if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 { continue }
+        virtual := isVirtual(ifc.Name)
+        if virtual && !includeVirtual { continue }
+        addrs, err := ifc.Addrs()
+        if err != nil { continue }
+        for _, a := range addrs {
+            ipn, ok := a.(*net.IPNet)
+            if !ok { continue }
+            ip := ipn.IP
+            if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsMulticast() || ip.IsUnspecified() { continue }
+            family := "ipv4"
+            if ip.To4() == nil { family = "ipv6" }
+            out = append(out, model.InterfaceAddr{Interface: ifc.Name, IP: ip.String(), Family: family, Virtual: virtual})
+        }
+    }
+    sort.SliceStable(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if a.Family != b.Family { return a.Family == "ipv4" }
+        if a.Virtual != b.Virtual { return !a.Virtual }
+        return a.Interface < b.Interface
+    })
+    return out
+}
\ No newline at end of file
@@ -8,6 +8,7 @@ import (
     "path/filepath"
     "strings"
     "time"
+    "winchannel/internal/config"
 )
 
 func WriteJSON(w http.ResponseWriter, v interface{}) {
@@ -37,12 +38,30 @@ func IsSafePath(base, target string) bool {
     return true
 }
 
-func GetLocalIP() string {
-    conn, err := net.Dial("udp", "8.8.8.8:80")
-    if err != nil {
-        return "127.0.0.1"
+// ClientIP returns the caller's address. X-Forwarded-For is only honoured
+// when trust_proxy is set, i.e. when the server sits behind a reverse proxy.
+func ClientIP(r *http.Request) string {
+    if config.Get().TrustProxy {
+        if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+            return strings.TrimSpace(strings.Split(xff, ",")[0])
+        }
     }
-    defer conn.Close()
-    localAddr := conn.LocalAddr().(*net.UDPAddr)
-    return localAddr.IP.String()
+    host, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil { return r.RemoteAddr }
+    return host
+}
+
+// InterfaceIPs lists every local address, virtual adapters included, for
+// certificates that should be valid however the server is reached.
+func InterfaceIPs() []string {
+    var out []string
+    for _, a := range LocalAddrs(true) { out = append(out, a.IP) }
+    return out
+}
+
+// GetLocalIP returns the preferred LAN address, or 127.0.0.1 when the machine
+// has none.
+func GetLocalIP() string {
+    if addrs := LocalAddrs(false); len(addrs) > 0 { return addrs[0].IP }
+    return "127.0.0.1"
 }
\ No newline at end of file
@@ -4,4 +4,8 @@ rem 启用 HTTPS：将 ENABLE_TLS=1 并设置 TLS_CERT/TLS_KEY 路径
 rem set ENABLE_TLS=1
 rem set TLS_CERT=WinChannel\certs\server.crt
 rem set TLS_KEY=WinChannel\certs\server.key
+rem 或使用内置本地 CA 自动签发证书
+rem set TLS_AUTO=1
+rem 数据目录（默认为启动目录下的 storage）
+rem set DATA_DIR=%~dp0storage
 go run "WinChannel\main.go"
\ No newline at end of file
@@ -1,30 +1,152 @@
 package main
 
 import (
+    "context"
+    "crypto/tls"
+    "embed"
+    "encoding/json"
+    "errors"
+    "flag"
     "fmt"
-    "log"
+    "log/slog"
+    "net"
     "net/http"
     "os"
+    "os/signal"
+    "strings"
+    "strconv"
+    "syscall"
     "time"
+    "winchannel/internal/assets"
+    "winchannel/internal/atrest"
+    "winchannel/internal/certs"
+    "winchannel/internal/config"
     "winchannel/internal/dao"
+    "winchannel/internal/handlers"
+    "winchannel/internal/logging"
+    "winchannel/internal/mdns"
     "winchannel/internal/paths"
     "winchannel/internal/router"
+    "winchannel/internal/service"
     "winchannel/internal/util"
 )
 
+// embedded carries the HTML pages and static assets so the binary runs from
+// any directory.
+//
+//go:embed templates static
+var embedded embed.FS
+
+func fatal(msg string, err error) {
+    slog.Error(msg, "err", err)
+    os.Exit(1)
+}
+
 func main() {
+    loader := config.NewLoader(flag.CommandLine)
+    genKey := flag.String("gen-key", "", "write a new encryption master key to this file and exit")
+    rotateKey := flag.String("rotate-key", "", "re-wrap every encrypted file under the data directory with the master key in this file and exit")
+    flag.Parse()
+    if *genKey != "" {
+        if err := atrest.WriteKeyFile(*genKey, atrest.GenerateKey()); err != nil {
+            fmt.Fprintf(os.Stderr, "gen-key: %v\n", err)
+            os.Exit(1)
+        }
+        fmt.Println("wrote", *genKey)
+        return
+    }
+    cfg, err := loader.Load()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+        os.Exit(2)
+    }
+    if loader.PrintConfig {
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        enc.Encode(cfg.Redacted())
+        return
+    }
+    config.Set(cfg)
+    paths.SetStorageDir(cfg.DataDir)
+    storageWarnings := paths.Inspect()
+    if err := assets.Init(embedded, cfg.TemplatesDir, cfg.StaticDir); err != nil {
+        fmt.Fprintf(os.Stderr, "init assets: %v\n", err)
+        os.Exit(1)
+    }
+
     if err := paths.EnsureDirs(); err != nil {
-        log.Fatalf("init dirs: %v", err)
+        fmt.Fprintf(os.Stderr, "init dirs: %v\n", err)
+        os.Exit(1)
+    }
+    if *rotateKey != "" {
+        rotateKeys(cfg.Encryption, *rotateKey)
+        return
+    }
+    var keys *atrest.Keyring
+    if cfg.Encryption.Enabled {
+        if keys, err = loadKeyring(cfg.Encryption, nil); err != nil {
+            fmt.Fprintf(os.Stderr, "init encryption: %v\n", err)
+            os.Exit(1)
+        }
+        atrest.Enable(keys)
+    } else if f, err := atrest.FindEncrypted(paths.StorageDir); err != nil || f != "" {
+        if err == nil { err = fmt.Errorf("%s is encrypted but encryption is not enabled", f) }
+        fmt.Fprintf(os.Stderr, "init encryption: %v\n", err)
+        os.Exit(1)
+    }
+    logFile, err := logging.Setup(logging.OptionsFrom(cfg.Log))
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "init logging: %v\n", err)
+        os.Exit(1)
+    }
+    defer logFile.Close()
+    for _, w := range storageWarnings { slog.Warn(w) }
+    slog.Info("data directory", "path", paths.StorageDir)
+    if keys != nil { slog.Info("encryption at rest enabled", "key_id", keys.ID()) }
+    if replayed, err := dao.OpenStore(); err != nil {
+        fmt.Fprintf(os.Stderr, "recover storage: %v\n", err)
+        os.Exit(1)
+    } else if replayed {
+        slog.Warn("finished a write interrupted by a previous run", "record", paths.WALFile)
     }
     dao.LoadUsers()
+    dao.LoadTokens()
+    if err := dao.LoadTwoFactor(); err != nil {
+        fmt.Fprintf(os.Stderr, "load two-factor settings: %v\n", err)
+        os.Exit(1)
+    }
+    dao.LoadSessions(service.Sessions)
+    if err := dao.LoadTransfers(); err != nil {
+        fmt.Fprintf(os.Stderr, "load transfers: %v\n", err)
+        os.Exit(1)
+    }
+    if err := dao.LoadClipboard(); err != nil {
+        fmt.Fprintf(os.Stderr, "load clipboard: %v\n", err)
+        os.Exit(1)
+    }
+    if err := dao.LoadPublicKeys(); err != nil {
+        fmt.Fprintf(os.Stderr, "load device keys: %v\n", err)
+        os.Exit(1)
+    }
+    if err := dao.LoadEnvelopes(); err != nil {
+        fmt.Fprintf(os.Stderr, "load file envelopes: %v\n", err)
+        os.Exit(1)
+    }
+    if n, _ := service.CleanPartialUploads(handlers.PartialPrefix); n > 0 {
+        slog.Info("removed partial uploads left by a previous run", "files", n)
+    }
+    if n, err := service.PruneTransfers(); err != nil {
+        slog.Warn("prune transfers", "err", err)
+    } else if n > 0 {
+        slog.Info("dropped transfers past retention", "transfers", n)
+    }
 
     mux := http.NewServeMux()
     router.Register(mux)
 
-    portStr := util.GetenvDefault("PORT", "8000")
+    portStr := strconv.Itoa(cfg.Port)
     ip := util.GetLocalIP()
-    fmt.Printf("Local URL: http://localhost:%s/\n", portStr)
-    fmt.Printf("Network URL: http://%s:%s/\n", ip, portStr)
+    scheme := "http"
 
     srv := &http.Server{
         Addr:              ":" + portStr,
@@ -33,15 +155,167 @@ func main() {
         WriteTimeout:      10 * time.Minute,
         ReadHeaderTimeout: 15 * time.Second,
         IdleTimeout:       2 * time.Minute,
+        ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
     }
+    srv.RegisterOnShutdown(service.CloseEvents)
 
-    enableTLS := util.GetenvDefault("ENABLE_TLS", "0") == "1"
-    cert := os.Getenv("TLS_CERT")
-    key := os.Getenv("TLS_KEY")
-    if enableTLS && cert != "" && key != "" {
-        fmt.Printf("HTTPS Enabled. Use https://localhost:%s/ and https://%s:%s/\n", portStr, ip, portStr)
-        log.Fatal(srv.ListenAndServeTLS(cert, key))
+    cert, key := cfg.TLS.Cert, cfg.TLS.Key
+    if cfg.TLS.Enabled { scheme = "https" }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+    if cfg.TLS.Auto {
+        mgr, err := certs.NewManager(paths.TLSDir, func() []string { return certs.DefaultHosts(util.InterfaceIPs()) })
+        if err != nil { fatal("tls auto", err) }
+        srv.TLSConfig = &tls.Config{GetCertificate: mgr.GetCertificate, MinVersion: tls.VersionTLS12}
+        cert, key = "", ""
+        go mgr.Run(ctx.Done())
+        slog.Info("local CA ready; install it on devices to trust this server", "download", scheme+"://"+net.JoinHostPort(ip, portStr)+"/api/tls/ca.crt", "sha256", mgr.CAFingerprint())
+    }
+    slog.Info("listening", "local_url", scheme+"://localhost:"+portStr+"/")
+    for _, a := range util.LocalAddrs(false) {
+        slog.Info("network url", "url", scheme+"://"+net.JoinHostPort(a.IP, portStr)+"/", "interface", a.Interface)
+    }
+
+    if f := loader.File(); f != "" { slog.Info("configuration loaded", "file", f) }
+    go watchReload(loader)
+    var responder *mdns.Responder
+    if cfg.MDNS.Enabled { responder = startMDNS(cfg, scheme) }
+
+    errc := make(chan error, 1)
+    go func() {
+        if scheme == "https" {
+            errc <- srv.ListenAndServeTLS(cert, key)
+        } else {
+            errc <- srv.ListenAndServe()
+        }
+    }()
+    select {
+    case err := <-errc:
+        fatal("server stopped", err)
+    case <-ctx.Done():
+    }
+    stop() // a second signal kills the process immediately
+    if responder != nil { responder.Close() }
+    shutdown(srv)
+}
+
+// loadKeyring reads the configured master key and previous_key_files. A
+// non-nil primary goes in front and seals new files instead.
+func loadKeyring(enc config.Encryption, primary []byte) (*atrest.Keyring, error) {
+    var keys [][]byte
+    if primary != nil { keys = append(keys, primary) }
+    if enc.Key != "" {
+        k, err := atrest.ParseKey(enc.Key)
+        if err != nil { return nil, err }
+        keys = append(keys, k)
     } else {
-        log.Fatal(srv.ListenAndServe())
+        k, err := atrest.ReadKeyFile(enc.KeyFile)
+        if os.IsNotExist(err) { return nil, fmt.Errorf("key file %s does not exist; create one with -gen-key", enc.KeyFile) }
+        if err != nil { return nil, err }
+        keys = append(keys, k)
+    }
+    for _, f := range enc.PreviousKeyFiles {
+        k, err := atrest.ReadKeyFile(f)
+        if err != nil { return nil, err }
+        keys = append(keys, k)
+    }
+    return atrest.NewKeyring(keys[0], keys[1:]...)
+}
+
+// rotateKeys re-wraps the data key of every encrypted file under the data
+// directory with the key in newKeyFile. Content is not re-encrypted, so this
+// is fast, but the server must not be running.
+func rotateKeys(enc config.Encryption, newKeyFile string) {
+    if !enc.Enabled {
+        fmt.Fprintln(os.Stderr, "rotate-key: encryption is not enabled in the configuration")
+        os.Exit(2)
+    }
+    next, err := atrest.ReadKeyFile(newKeyFile)
+    if err != nil { fmt.Fprintf(os.Stderr, "rotate-key: %v\n", err); os.Exit(1) }
+    keys, err := loadKeyring(enc, next)
+    if err != nil { fmt.Fprintf(os.Stderr, "rotate-key: %v\n", err); os.Exit(1) }
+    // A pending write-ahead record holds file contents sealed under the old
+    // key; apply it first so they get re-wrapped too.
+    if _, err := dao.OpenStore(); err != nil { fmt.Fprintf(os.Stderr, "rotate-key: %v\n", err); os.Exit(1) }
+    n, err := keys.RewrapTree(paths.StorageDir)
+    fmt.Printf("re-wrapped %d files under %s with key %s\n", n, paths.StorageDir, keys.ID())
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "some files could not be re-wrapped:\n%v\n", err)
+        os.Exit(1)
+    }
+    fmt.Printf("set encryption.key_file to %s before starting the server\n", newKeyFile)
+}
+
+// startMDNS advertises the server as _winchannel._tcp and _http._tcp under
+// <hostname>.local. Failure (e.g. no multicast route) only disables
+// discovery.
+func startMDNS(cfg *config.Config, scheme string) *mdns.Responder {
+    instance := cfg.MDNS.Instance
+    if instance == "" {
+        h, _ := os.Hostname()
+        instance = "WinChannel on " + h
+    }
+    var ifi *net.Interface
+    if cfg.MDNS.Interface != "" {
+        var err error
+        if ifi, err = net.InterfaceByName(cfg.MDNS.Interface); err != nil { slog.Warn("mdns disabled", "err", err); return nil }
+    }
+    svc := mdns.Service{
+        Instance: instance,
+        Host:     cfg.MDNS.Hostname,
+        Port:     cfg.Port,
+        Text:     []string{"path=/", "scheme=" + scheme, "api=/api/info"},
+        Addrs: func() []net.IP {
+            var ips []net.IP
+            for _, a := range util.LocalAddrs(false) { ips = append(ips, net.ParseIP(a.IP)) }
+            return ips
+        },
+    }
+    r, err := mdns.NewResponder(svc, ifi)
+    if err != nil { slog.Warn("mdns disabled", "err", err); return nil }
+    slog.Info("advertising via mdns", "host", strings.TrimSuffix(r.Host(), "."), "instance", instance, "url", scheme+"://"+strings.TrimSuffix(r.Host(), ".")+":"+strconv.Itoa(cfg.Port)+"/")
+    return r
+}
+
+// watchReload re-reads the configuration on SIGHUP and applies the settings
+// that are safe to change at runtime. An invalid file leaves the running
+// configuration untouched.
+func watchReload(loader *config.Loader) {
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    for range hup {
+        next, err := loader.Load()
+        if err != nil { slog.Error("config reload rejected", "err", err); continue }
+        merged, ignored := config.Get().Reload(next)
+        if err := logging.SetLevel(merged.Log.Level); err != nil { slog.Error("config reload rejected", "err", err); continue }
+        config.Set(merged)
+        if len(ignored) > 0 { slog.Warn("config reload: restart required for some settings", "settings", ignored) }
+        slog.Info("configuration reloaded")
+    }
+}
+
+// shutdown stops accepting connections, waits up to shutdown_timeout_seconds
+// for in-flight requests, then removes upload temp files and writes in-memory
+// state to disk.
+func shutdown(srv *http.Server) {
+    secs := config.Get().ShutdownTimeoutSeconds
+    slog.Info("shutting down", "drain_timeout", time.Duration(secs)*time.Second)
+    service.SetDraining(true)
+
+    ctx, cancel := context.WithTimeout(context.Background(), time.Duration(secs)*time.Second)
+    defer cancel()
+    if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+        slog.Warn("drain timed out, closing remaining connections", "err", err)
+        srv.Close()
+    }
+    if n, err := service.CleanPartialUploads(handlers.PartialPrefix); err != nil {
+        slog.Warn("partial upload cleanup failed", "err", err)
+    } else if n > 0 {
+        slog.Info("removed partial uploads", "files", n)
+    }
+    if err := service.FlushState(); err != nil {
+        slog.Error("flush state", "err", err)
+        return
     }
+    slog.Info("shutdown complete")
 }
\ No newline at end of file
@@ -14,6 +14,19 @@
   const historyList = $('#history-list');
   const passInput = $('#passphrase');
   const encStatus = $('#enc-status');
+  const pairBtn = $('#pair-btn');
+  const pairStatus = $('#pair-status');
+  const pairQr = $('#pair-qr');
+  const devicesList = $('#devices-list');
+  const logoutOthersBtn = $('#logout-others-btn');
+  const sendTo = $('#send-to');
+  const sendDevice = $('#send-device');
+  const sendText = $('#send-text');
+  const sendTextBtn = $('#send-text-btn');
+  const inboxList = $('#inbox-list');
+  const clipPushBtn = $('#clip-push-btn');
+  const clipSearch = $('#clip-search');
+  const clipList = $('#clip-list');
   // Auth & admin controls
   const authUsername = document.querySelector('#auth-username');
   const authPassword = document.querySelector('#auth-password');
@@ -48,9 +61,31 @@
   async function loadInfo(){
     const r = await apiFetch('/api/info');
     const data = await r.json();
-    const [local, network] = data.urls || [];
+    const [local, ...network] = data.urls || [];
     localUrlEl.textContent = local ? ('Local: ' + local) : '';
-    networkUrlEl.textContent = network ? ('Network: ' + network) : '';
+    networkUrlEl.textContent = network.length ? ('Network: ' + network.join('  ')) : '';
+  }
+
+  if (pairBtn) {
+    pairBtn.addEventListener('click', async () => {
+      const r = await apiFetch('/api/pair', { method: 'POST' });
+      const data = await r.json();
+      if (!r.ok) { pairStatus.textContent = '生成失败：' + ((data.error && data.error.message) || r.status); return; }
+      pairQr.innerHTML = data.qr_svg;
+      pairStatus.textContent = '用手机扫码即可登录，有效期至 ' + new Date(data.expires_at).toLocaleTimeString();
+    });
+  }
+
+  // Pairing link page: the token is only redeemed once the user confirms.
+  const pairConfirmBtn = document.querySelector('#btn-pair');
+  if (pairConfirmBtn) {
+    pairConfirmBtn.addEventListener('click', async () => {
+      const token = new URLSearchParams(location.search).get('token') || '';
+      pairConfirmBtn.disabled = true;
+      document.querySelector('#pair-status').textContent = '正在登录…';
+      const r = await apiFetch('/api/pair/redeem', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ token }) });
+      window.location.replace(r.ok ? '/app' : '/login?pair=expired');
+    });
   }
 
   function detectRoot(files){
@@ -110,72 +145,79 @@
       fd.append('zip_file', zipFile, zipFile.name);
       const r = await apiFetch('/api/upload_zip', { method: 'POST', body: fd });
       const data = await r.json();
-      if (statusEl) statusEl.textContent = data.ok ? 'ZIP上传并解压完成' : ('上传失败：' + (data.error || ''));
+      if (statusEl) statusEl.textContent = data.ok ? 'ZIP上传并解压完成' : ('上传失败：' + ((data.error && data.error.message) || ''));
       await loadUploads();
     });
   }
 
   // --- 文本端到端加密（AES-GCM） ---
+  // 密文以 base64 提交，并附带信封（算法、密钥 ID、nonce、salt），
+  // 其他设备用相同口令和信封中的 salt 即可解密。
   let encryptionEnabled = false;
-  let cryptoKey = null;
+  let passphrase = '';
+  const derivedKeys = new Map();
   const te = new TextEncoder();
   const td = new TextDecoder();
   const b64 = {
     encode: (arr) => btoa(String.fromCharCode(...arr)),
     decode: (str) => Uint8Array.from(atob(str), c => c.charCodeAt(0))
   };
-  async function deriveKey(passphrase){
+  function localSalt(){
     const saltKey = 'winchannel_salt';
     let salt = localStorage.getItem(saltKey);
     if (!salt) {
-      const s = crypto.getRandomValues(new Uint8Array(16));
-      salt = b64.encode(s);
+      salt = b64.encode(crypto.getRandomValues(new Uint8Array(16)));
       localStorage.setItem(saltKey, salt);
     }
-    const saltBytes = b64.decode(salt);
+    return salt;
+  }
+  async function keyFor(salt){
+    if (derivedKeys.has(salt)) return derivedKeys.get(salt);
     const baseKey = await crypto.subtle.importKey('raw', te.encode(passphrase), 'PBKDF2', false, ['deriveKey']);
-    cryptoKey = await crypto.subtle.deriveKey(
-      { name: 'PBKDF2', salt: saltBytes, iterations: 100000, hash: 'SHA-256' },
+    const key = await crypto.subtle.deriveKey(
+      { name: 'PBKDF2', salt: b64.decode(salt), iterations: 100000, hash: 'SHA-256' },
       baseKey,
       { name: 'AES-GCM', length: 256 },
       false,
       ['encrypt','decrypt']
     );
-    encryptionEnabled = true;
-    encStatus.textContent = '已开启';
+    derivedKeys.set(salt, key);
+    return key;
+  }
+  async function setPassphrase(val){
+    passphrase = val;
+    derivedKeys.clear();
+    encryptionEnabled = !!val;
+    if (val) await keyFor(localSalt());
+    if (encStatus) encStatus.textContent = val ? '已开启' : '未开启';
   }
-  async function encryptText(text){
-    if (!encryptionEnabled || !cryptoKey) return text;
+  // sealText 返回提交用的 { content, envelope }；未开启加密时只有明文 content。
+  async function sealText(text){
+    if (!encryptionEnabled) return { content: text };
+    const salt = localSalt();
     const iv = crypto.getRandomValues(new Uint8Array(12));
-    const ctBuf = await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, cryptoKey, te.encode(text));
-    const ct = new Uint8Array(ctBuf);
-    return JSON.stringify({ iv: b64.encode(iv), ct: b64.encode(ct) });
+    const ct = await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, await keyFor(salt), te.encode(text));
+    return { content: b64.encode(new Uint8Array(ct)), envelope: { alg: 'A256GCM', kid: 'passphrase', nonce: b64.encode(iv), salt } };
   }
-  async function decryptText(payload){
+  // openText 解密带信封的内容；无信封即明文，无法解密时返回 null。
+  async function openText(content, envelope){
+    if (!envelope) return content;
+    if (!encryptionEnabled || envelope.alg !== 'A256GCM' || !envelope.salt) return null;
     try {
-      const obj = JSON.parse(payload);
-      if (!obj || !obj.iv || !obj.ct) return null;
-      const iv = b64.decode(obj.iv);
-      const ct = b64.decode(obj.ct);
-      const ptBuf = await crypto.subtle.decrypt({ name: 'AES-GCM', iv }, cryptoKey, ct);
-      return td.decode(ptBuf);
+      const pt = await crypto.subtle.decrypt({ name: 'AES-GCM', iv: b64.decode(envelope.nonce) }, await keyFor(envelope.salt), b64.decode(content));
+      return td.decode(pt);
     } catch(e) { return null; }
   }
   if (passInput) {
     passInput.addEventListener('change', async () => {
       const val = passInput.value.trim();
-      if (!val) {
-        encryptionEnabled = false;
-        cryptoKey = null;
-        if (encStatus) encStatus.textContent = '未开启';
-        return;
-      }
-      if (statusEl) statusEl.textContent = '加密口令设置中…';
-      await deriveKey(val);
-      if (statusEl) statusEl.textContent = '加密口令已设置';
+      if (val && statusEl) statusEl.textContent = '加密口令设置中…';
+      await setPassphrase(val);
+      if (val && statusEl) statusEl.textContent = '加密口令已设置';
     });
   }
 
+
   async function loadUploads(){
     if (!uploadsList) return;
     const r = await apiFetch('/api/uploads');
@@ -203,12 +245,132 @@
         });
         li.appendChild(del);
       }
+      const push = document.createElement('button');
+      push.textContent = '推送';
+      push.style.marginLeft = '10px';
+      push.addEventListener('click', () => sendTransfer({ kind: 'upload', upload_id: u.id }));
       li.appendChild(left);
       li.appendChild(btn);
+      li.appendChild(push);
       uploadsList.appendChild(li);
     });
   }
 
+  async function loadDevices(){
+    if (!devicesList) return;
+    const r = await apiFetch('/api/devices');
+    const data = await r.json();
+    devicesList.innerHTML = '';
+    if (sendDevice) sendDevice.innerHTML = '<option value="">所有设备</option>';
+    (data.devices || []).forEach(d => {
+      if (sendDevice && !d.current) {
+        const opt = document.createElement('option');
+        opt.value = d.id;
+        opt.textContent = '我的 ' + d.name;
+        sendDevice.appendChild(opt);
+      }
+      const li = document.createElement('li');
+      const left = document.createElement('div');
+      const seen = d.last_seen ? new Date(d.last_seen).toLocaleString() : '-';
+      left.textContent = `${d.name}${d.current ? '（当前设备）' : ''} · ${d.ip} · 最近活动 ${seen}`;
+      left.title = d.user_agent;
+      li.appendChild(left);
+      if (!d.current) {
+        const btn = document.createElement('button');
+        btn.textContent = '退出登录';
+        btn.addEventListener('click', async () => {
+          if (!confirm(`确定让 ${d.name} 退出登录？`)) return;
+          await apiFetch('/api/devices/revoke', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ id: d.id }) });
+          await loadDevices();
+        });
+        li.appendChild(btn);
+      }
+      devicesList.appendChild(li);
+    });
+  }
+
+  if (logoutOthersBtn) {
+    logoutOthersBtn.addEventListener('click', async () => {
+      if (!confirm('确定退出除本机外的所有设备？')) return;
+      await apiFetch('/api/devices/logout_all', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ keep_current: true }) });
+      await loadDevices();
+    });
+  }
+
+  async function sendTransfer(item){
+    const body = Object.assign({ to: (sendTo && sendTo.value.trim()) || auth.username, to_device: sendDevice ? sendDevice.value : '' }, item);
+    const r = await apiFetch('/api/transfers/send', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) });
+    const data = await r.json();
+    if (statusEl) statusEl.textContent = r.ok ? `已推送给 ${body.to}` : ('推送失败：' + ((data.error && data.error.message) || r.status));
+    return r.ok;
+  }
+
+  if (sendTextBtn) {
+    sendTextBtn.addEventListener('click', async () => {
+      const text = sendText.value;
+      if (!text) return alert('请输入要推送的文本');
+      const sealed = await sealText(text);
+      if (await sendTransfer({ kind: 'text', text: sealed.content, envelope: sealed.envelope })) sendText.value = '';
+    });
+  }
+
+  async function markRead(t){
+    if (t.status === 'read') return;
+    await apiFetch('/api/transfers/read', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ id: t.id }) });
+  }
+
+  async function loadInbox(){
+    if (!inboxList) return;
+    const r = await apiFetch('/api/transfers/inbox');
+    const data = await r.json();
+    inboxList.innerHTML = '';
+    for (const t of (data.transfers || [])) {
+      const li = document.createElement('li');
+      const left = document.createElement('div');
+      const from = t.from + (t.from_device ? `（${t.from_device}）` : '');
+      const text = t.kind === 'text' ? await openText(t.text, t.envelope) : null;
+      const what = t.kind === 'text' ? (text !== null ? text : '🔒 加密文本（需要口令）') : (t.kind === 'file' ? `${t.upload_id}/${t.path}` : `上传 ${t.upload_id}`);
+      left.textContent = `${t.status === 'read' ? '' : '● '}${from}：${what}`;
+      li.appendChild(left);
+      if (t.kind === 'text') {
+        const copy = document.createElement('button');
+        copy.textContent = '复制';
+        copy.disabled = text === null;
+        copy.addEventListener('click', async () => { await navigator.clipboard.writeText(text); await markRead(t); await loadInbox(); });
+        li.appendChild(copy);
+      } else {
+        const a = document.createElement('a');
+        a.textContent = '下载';
+        a.href = `/api/download/${encodeURIComponent(t.upload_id)}` + (t.kind === 'file' ? `?path=${encodeURIComponent(t.path)}` : '');
+        a.addEventListener('click', () => { markRead(t).then(loadInbox); });
+        li.appendChild(a);
+      }
+      const del = document.createElement('button');
+      del.textContent = '删除';
+      del.style.marginLeft = '10px';
+      del.addEventListener('click', async () => {
+        await apiFetch('/api/transfers/delete', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ id: t.id }) });
+        await loadInbox();
+      });
+      li.appendChild(del);
+      inboxList.appendChild(li);
+    }
+  }
+
+  function listenEvents(){
+    if (!window.EventSource) return;
+    const es = new EventSource('/api/events');
+    es.addEventListener('transfer', (e) => {
+      const t = JSON.parse(e.data);
+      if (statusEl) statusEl.textContent = `收到来自 ${t.from} 的推送`;
+      loadInbox();
+    });
+    es.addEventListener('transfer.receipt', (e) => {
+      const rc = JSON.parse(e.data);
+      if (statusEl) statusEl.textContent = `${rc.to} ${rc.status === 'read' ? '已读' : '已接收'}你的推送`;
+    });
+  }
+
   async function fetchTextState(){
     if (!editor || !versionEl) return { version: 0, content: '' };
     const r = await apiFetch('/api/text/state');
@@ -216,12 +378,8 @@
     versionEl.textContent = data.version || 0;
     if (!document.activeElement || document.activeElement !== editor) {
       const raw = data.content || '';
-      if (encryptionEnabled && cryptoKey) {
-        const dec = await decryptText(raw);
-        editor.value = dec !== null ? dec : raw;
-      } else {
-        editor.value = raw;
-      }
+      const dec = await openText(raw, data.envelope);
+      editor.value = dec !== null ? dec : raw;
     }
     return data;
   }
@@ -233,8 +391,7 @@
       if (statusEl) statusEl.textContent = '编辑中…';
       if (typingTimer) clearTimeout(typingTimer);
       typingTimer = setTimeout(async () => {
-        const encrypted = await encryptText(editor.value);
-        const body = { content: encrypted, client_id: clientId };
+        const body = Object.assign({ client_id: clientId }, await sealText(editor.value));
         const r = await apiFetch('/api/text/update', {
           method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body)
         });
@@ -263,6 +420,59 @@
     }
   }
 
+  async function clipPost(url, body){
+    const r = await apiFetch(url, { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(body) });
+    return r.json();
+  }
+
+  async function loadClipboard(){
+    if (!clipList) return;
+    const q = clipSearch ? clipSearch.value.trim() : '';
+    const r = await apiFetch('/api/clipboard?limit=50' + (q ? '&q=' + encodeURIComponent(q) : ''));
+    const data = await r.json();
+    clipList.innerHTML = '';
+    for (const sn of (data.items || [])) {
+      const dec = await openText(sn.content, sn.envelope);
+      const text = dec !== null ? dec : '🔒 加密片段（需要口令）';
+      const li = document.createElement('li');
+      const left = document.createElement('div');
+      const preview = text.length > 80 ? text.slice(0, 80) + '…' : text;
+      left.textContent = `${sn.pinned ? '📌 ' : ''}${preview} · ${sn.source || sn.username} · ${new Date(sn.created_at).toLocaleString()}`;
+      left.title = text;
+      li.appendChild(left);
+      const actions = [
+        [sn.pinned ? '取消置顶' : '置顶', () => clipPost('/api/clipboard/pin', { id: sn.id, pinned: !sn.pinned })],
+        ['填入编辑器', () => clipPost('/api/clipboard/restore', { id: sn.id, client_id: clientId }).then(fetchTextState)],
+        ['复制', () => dec !== null && navigator.clipboard.writeText(text)],
+        ['删除', () => clipPost('/api/clipboard/delete', { id: sn.id })],
+      ];
+      actions.forEach(([label, fn]) => {
+        const b = document.createElement('button');
+        b.textContent = label;
+        b.style.marginLeft = '6px';
+        b.addEventListener('click', async () => { await fn(); await loadClipboard(); });
+        li.appendChild(b);
+      });
+      clipList.appendChild(li);
+    }
+  }
+
+  if (clipPushBtn) {
+    clipPushBtn.addEventListener('click', async () => {
+      if (!editor.value) return alert('编辑器为空');
+      const data = await clipPost('/api/clipboard/push', Object.assign({ client_id: clientId }, await sealText(editor.value)));
+      if (statusEl) statusEl.textContent = data.ok ? '已存入剪贴板历史' : '保存失败';
+      await loadClipboard();
+    });
+  }
+  if (clipSearch) {
+    let searchTimer = null;
+    clipSearch.addEventListener('input', () => {
+      if (searchTimer) clearTimeout(searchTimer);
+      searchTimer = setTimeout(loadClipboard, 300);
+    });
+  }
+
   if (editor) {
     setInterval(async () => {
       const data = await fetchTextState();
@@ -311,12 +521,20 @@
     const u = (authUsername.value || '').trim();
     const p = authPassword.value || '';
     if (!u || !p) return alert('请输入用户名与密码');
-    const r = await apiFetch('/api/auth/login', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ username: u, password: p }) });
+    let r = await apiFetch('/api/auth/login', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ username: u, password: p }) });
     if (r.ok) {
-      try { await r.json(); } catch(e) {}
+      let d = {};
+      try { d = await r.json(); } catch(e) {}
+      if (d.two_factor_required) {
+        const code = (prompt('请输入验证器中的 6 位验证码（或恢复码）') || '').trim();
+        if (!code) return;
+        r = await apiFetch('/api/auth/2fa/verify', { method: 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify({ code }) });
+        if (!r.ok) return alert(r.status === 429 ? '登录尝试过多，请稍后再试' : '验证码错误或已过期');
+      }
       setTimeout(() => { window.location.replace('/app'); }, 50);
       return;
-    } else { alert('登录失败'); }
+    } else if (r.status === 429) { alert('登录尝试过多，请稍后再试'); }
+    else { alert('登录失败：用户名或密码错误'); }
   });
   btnLogout && btnLogout.addEventListener('click', async () => {
     const r = await apiFetch('/api/auth/logout', { method: 'POST' });
@@ -341,9 +559,28 @@
     else { alert('新建失败'); }
   });
 
-  // Fetch wrapper to include credentials
-  function apiFetch(url, opts){
-    return fetch(url, Object.assign({ credentials: 'include' }, opts || {}));
+  // Fetch wrapper to include credentials and, for state-changing requests,
+  // the CSRF token echoed from its cookie (double-submit).
+  function readCookie(name){
+    const m = document.cookie.match(new RegExp('(?:^|; )' + name + '=([^;]*)'));
+    return m ? decodeURIComponent(m[1]) : '';
+  }
+  async function csrfToken(){
+    let tok = readCookie('CSRF_TOKEN');
+    if (!tok) {
+      const r = await fetch('/api/csrf', { credentials: 'include' });
+      const d = await r.json();
+      tok = d.csrf_token || '';
+    }
+    return tok;
+  }
+  async function apiFetch(url, opts){
+    opts = Object.assign({ credentials: 'include' }, opts || {});
+    const method = (opts.method || 'GET').toUpperCase();
+    if (method !== 'GET' && method !== 'HEAD') {
+      opts.headers = Object.assign({}, opts.headers || {}, { 'X-CSRF-Token': await csrfToken() });
+    }
+    return fetch(url, opts);
   }
 
   function setupUsersPage(){
@@ -407,6 +644,7 @@
     await refreshAuth();
     if (isLoginPage) {
       if (auth.authenticated) { window.location.href = '/app'; return; }
+      if (authStatus && new URLSearchParams(location.search).get('pair') === 'expired') authStatus.textContent = '二维码已失效，请重新生成或使用密码登录';
       return;
     }
     if (!auth.authenticated) { return; }
@@ -417,6 +655,10 @@
     }
     if (isAppPage) {
       await loadUploads();
+      await loadDevices();
+      await loadInbox();
+      await loadClipboard();
+      listenEvents();
       const state = await fetchTextState();
       lastVersion = state.version || 0;
       await fetchHistory();